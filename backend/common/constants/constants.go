@@ -6,6 +6,7 @@ const (
 	ORDER_STATUS_CANCELED       = "canceled"
 	ORDER_STATUS_REJECTED       = "rejected"
 	ORDER_STATUS_REJECTED_BY_USER = "rejected_by_user"
+	ORDER_STATUS_PAID           = "paid"
 
 	// Order Status Codes - SELLER DISPATCH
 	ORDER_STATUS_SELLER_NOTIFIED         = "seller_notified"
@@ -37,6 +38,7 @@ var OrderStatusCodes = struct {
 	CANCELED                 string
 	REJECTED                 string
 	REJECTED_BY_USER         string
+	PAID                     string
 	SELLER_NOTIFIED          string
 	SELLER_PROCESSING        string
 	SELLER_WAITING_DISPATCH  string
@@ -58,6 +60,7 @@ var OrderStatusCodes = struct {
 	CANCELED:                 ORDER_STATUS_CANCELED,
 	REJECTED:                 ORDER_STATUS_REJECTED,
 	REJECTED_BY_USER:         ORDER_STATUS_REJECTED_BY_USER,
+	PAID:                     ORDER_STATUS_PAID,
 	SELLER_NOTIFIED:          ORDER_STATUS_SELLER_NOTIFIED,
 	SELLER_PROCESSING:        ORDER_STATUS_SELLER_PROCESSING,
 	SELLER_WAITING_DISPATCH:  ORDER_STATUS_SELLER_WAITING_DISPATCH,
@@ -82,6 +85,11 @@ const (
 	EVENT_ORDER_UPDATED  = "order.updated"
 	EVENT_PRODUCT_CREATED = "product.created"
 	EVENT_PRODUCT_DELETED = "product.deleted"
+	EVENT_PRODUCT_PUBLISHED   = "product.published"
+	EVENT_PRODUCT_UNPUBLISHED = "product.unpublished"
+	EVENT_WISHLIST_PRICE_DROP     = "wishlist.price_drop"
+	EVENT_WISHLIST_BACK_IN_STOCK  = "wishlist.back_in_stock"
+	EVENT_PRODUCTS_LOW_STOCK = "products.low_stock"
 )
 
 var EventNames = struct {
@@ -89,11 +97,21 @@ var EventNames = struct {
 	ORDER_UPDATED  string
 	PRODUCT_CREATED string
 	PRODUCT_DELETED string
+	PRODUCT_PUBLISHED   string
+	PRODUCT_UNPUBLISHED string
+	WISHLIST_PRICE_DROP    string
+	WISHLIST_BACK_IN_STOCK string
+	PRODUCTS_LOW_STOCK string
 }{
 	ORDER_CREATED:  EVENT_ORDER_CREATED,
 	ORDER_UPDATED:  EVENT_ORDER_UPDATED,
 	PRODUCT_CREATED: EVENT_PRODUCT_CREATED,
 	PRODUCT_DELETED: EVENT_PRODUCT_DELETED,
+	PRODUCT_PUBLISHED:   EVENT_PRODUCT_PUBLISHED,
+	PRODUCT_UNPUBLISHED: EVENT_PRODUCT_UNPUBLISHED,
+	WISHLIST_PRICE_DROP:    EVENT_WISHLIST_PRICE_DROP,
+	WISHLIST_BACK_IN_STOCK: EVENT_WISHLIST_BACK_IN_STOCK,
+	PRODUCTS_LOW_STOCK: EVENT_PRODUCTS_LOW_STOCK,
 }
 
 const (
@@ -118,5 +136,6 @@ const (
 	CHAT_RESOURCE_PRODUCTS = "products"
 	CHAT_RESOURCE_MESSAGES = "messages"
 	CHAT_RESOURCE_THREADS  = "threads"
+	CHAT_RESOURCE_WISHLIST = "wishlist"
 )
 
@@ -56,12 +56,7 @@ func AuthMiddleware(userService users.UserService) gin.HandlerFunc {
 
 func AdminKeyMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		expected := config.Get().AdminAPIKey
-		provided := c.GetHeader("X-Admin-API-Key")
-		if provided == "" {
-			provided = c.Query("admin_key")
-		}
-		if expected == "" || provided == "" || provided != expected {
+		if !IsAdminRequest(c) {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			return
 		}
@@ -69,3 +64,14 @@ func AdminKeyMiddleware() gin.HandlerFunc {
 	}
 }
 
+// IsAdminRequest reports whether the request carries the configured admin API key, in the
+// X-Admin-API-Key header or the admin_key query parameter
+func IsAdminRequest(c *gin.Context) bool {
+	expected := config.Get().AdminAPIKey
+	provided := c.GetHeader("X-Admin-API-Key")
+	if provided == "" {
+		provided = c.Query("admin_key")
+	}
+	return expected != "" && provided == expected
+}
+
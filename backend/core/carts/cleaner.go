@@ -0,0 +1,53 @@
+package carts
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// GuestCartCleaner periodically deletes abandoned guest carts
+type GuestCartCleaner struct {
+	service CartService
+	ticker  *time.Ticker
+	stop    chan bool
+}
+
+func NewGuestCartCleaner(service CartService, interval time.Duration) *GuestCartCleaner {
+	c := &GuestCartCleaner{
+		service: service,
+		ticker:  time.NewTicker(interval),
+		stop:    make(chan bool),
+	}
+	go func() {
+		for {
+			select {
+			case <-c.ticker.C:
+				c.run()
+			case <-c.stop:
+				c.ticker.Stop()
+				return
+			}
+		}
+	}()
+	return c
+}
+
+func (c *GuestCartCleaner) run() {
+	deleted, err := c.service.CleanupGuestCarts(context.Background())
+	if err != nil {
+		logrus.Errorf("Failed to clean up guest carts: %v", err)
+		return
+	}
+	if deleted > 0 {
+		logrus.Infof("Deleted %d abandoned guest carts", deleted)
+	}
+}
+
+// Stop stops the cleaner goroutine
+func (c *GuestCartCleaner) Stop() {
+	if c.stop != nil {
+		close(c.stop)
+	}
+}
@@ -0,0 +1,132 @@
+package carts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"ecommerce-backend/core/products"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+// CartTokenHeader carries the guest cart token on /cart requests and on sign in
+const CartTokenHeader = "X-Cart-Token"
+
+type CartController struct {
+	service   CartService
+	authMW    gin.HandlerFunc
+	validator *validator.Validate
+}
+
+func NewCartController(s CartService, authMW gin.HandlerFunc) *CartController {
+	return &CartController{
+		service:   s,
+		authMW:    authMW,
+		validator: validator.New(),
+	}
+}
+
+func (c *CartController) RegisterRoutes(r *gin.Engine) {
+	// Guest carts, identified by the X-Cart-Token header
+	g := r.Group("/cart")
+	g.GET("", c.Get)
+	g.POST("/items", c.AddItem)
+	g.PUT("/items/:itemId", c.UpdateItem)
+	g.DELETE("/items/:itemId", c.RemoveItem)
+
+	ug := r.Group("/user/cart")
+	if c.authMW != nil {
+		ug.Use(c.authMW)
+	}
+	ug.GET("", c.Get)
+	ug.POST("/items", c.AddItem)
+	ug.PUT("/items/:itemId", c.UpdateItem)
+	ug.DELETE("/items/:itemId", c.RemoveItem)
+}
+
+// owner reads the signed-in user set by the auth middleware, falling back to the guest token
+func (c *CartController) owner(ctx *gin.Context) CartOwner {
+	if userID, ok := ctx.Get("user_id"); ok {
+		if id, ok := userID.(uuid.UUID); ok {
+			return CartOwner{UserID: id.String()}
+		}
+	}
+	return CartOwner{Token: ctx.GetHeader(CartTokenHeader)}
+}
+
+func (c *CartController) Get(ctx *gin.Context) {
+	cart, err := c.service.Get(context.Background(), c.owner(ctx))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, cart)
+}
+
+func (c *CartController) AddItem(ctx *gin.Context) {
+	var req AddItemRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cart, err := c.service.AddItem(context.Background(), c.owner(ctx), req)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if cart.Token != "" {
+		ctx.Header(CartTokenHeader, cart.Token)
+	}
+	ctx.JSON(http.StatusOK, cart)
+}
+
+func (c *CartController) UpdateItem(ctx *gin.Context) {
+	var req UpdateItemRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cart, err := c.service.UpdateItem(context.Background(), c.owner(ctx), ctx.Param("itemId"), req.Quantity)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, cart)
+}
+
+func (c *CartController) RemoveItem(ctx *gin.Context) {
+	cart, err := c.service.RemoveItem(context.Background(), c.owner(ctx), ctx.Param("itemId"))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, cart)
+}
+
+func (c *CartController) Name() string {
+	return "carts"
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrVariantRequired), errors.Is(err, ErrCartFull):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrCartNotFound), errors.Is(err, ErrItemNotFound), errors.Is(err, ErrVariantNotFound),
+		errors.Is(err, products.ErrProductNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, products.ErrInsufficientStock):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
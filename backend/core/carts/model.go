@@ -0,0 +1,111 @@
+package carts
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"ecommerce-backend/core/products"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCartNotFound    = errors.New("cart not found")
+	ErrItemNotFound    = errors.New("cart item not found")
+	ErrVariantNotFound = errors.New("variant not found")
+	ErrVariantRequired = errors.New("variant_id is required for products with variants")
+	ErrCartFull        = errors.New("cart has too many lines")
+)
+
+const (
+	maxCartLines    = 100
+	maxLineQuantity = 99
+	// Guest carts untouched for this long are deleted
+	guestCartRetention = 30 * 24 * time.Hour
+)
+
+// Cart belongs either to a signed-in user or to a guest holding its token
+type Cart struct {
+	ID        string     `gorm:"primaryKey" json:"id"`
+	UserID    string     `gorm:"uniqueIndex:idx_carts_user,where:user_id <> ''" json:"user_id,omitempty"`
+	Token     string     `gorm:"uniqueIndex:idx_carts_token,where:token <> ''" json:"-"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime;index" json:"updated_at"`
+	Items     []CartItem `gorm:"foreignKey:CartID" json:"items"`
+}
+
+// CartItem is one product or variant line. Price is the unit price when the shopper last set the
+// line, so reads can flag price changes since then.
+type CartItem struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	CartID    string    `gorm:"uniqueIndex:idx_cart_items_line;not null" json:"cart_id"`
+	ProductID string    `gorm:"uniqueIndex:idx_cart_items_line;not null" json:"product_id"`
+	VariantID string    `gorm:"uniqueIndex:idx_cart_items_line;not null;default:''" json:"variant_id"`
+	Quantity  int       `gorm:"not null" json:"quantity"`
+	Price     int       `gorm:"not null;default:0" json:"price"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (c *Cart) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return
+}
+
+func (i *CartItem) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+	return
+}
+
+// CartOwner identifies a cart by signed-in user or by guest token. UserID wins when both are set.
+type CartOwner struct {
+	UserID string
+	Token  string
+}
+
+func (o CartOwner) isGuest() bool {
+	return o.UserID == ""
+}
+
+// newCartToken returns an unguessable guest cart token
+func newCartToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type AddItemRequest struct {
+	ProductID string `json:"product_id" validate:"required"`
+	VariantID string `json:"variant_id"`
+	Quantity  int    `json:"quantity" validate:"gte=1,lte=99"`
+}
+
+type UpdateItemRequest struct {
+	Quantity int `json:"quantity" validate:"gte=0,lte=99"` // 0 removes the line
+}
+
+// CartItemResponse is a line priced against the catalogue at read time
+type CartItemResponse struct {
+	ID string `json:"id"`
+	products.CartLineStatus
+	SKU        string            `json:"sku,omitempty"`
+	Name       string            `json:"name"`
+	Image      string            `json:"image"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	LineTotal  int               `json:"line_total"`
+}
+
+type CartResponse struct {
+	Token     string             `json:"token,omitempty"` // guest carts only; send it back as X-Cart-Token
+	Items     []CartItemResponse `json:"items"`
+	ItemCount int                `json:"item_count"`
+	Subtotal  int                `json:"subtotal"` // active lines at current prices
+	Valid     bool               `json:"valid"`    // no line changed since the shopper last set it
+}
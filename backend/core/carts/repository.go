@@ -0,0 +1,174 @@
+package carts
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CartRepository interface {
+	// GetByOwner returns the owner's cart with its lines in the order they were added
+	GetByOwner(ctx context.Context, owner CartOwner) (*Cart, error)
+	Create(ctx context.Context, cart *Cart) error
+	// SetItem sets the quantity and price of the line, adding it if the cart has none for the item
+	SetItem(ctx context.Context, item *CartItem) error
+	UpdateItem(ctx context.Context, cartID, itemID string, quantity, price int) error
+	DeleteItem(ctx context.Context, cartID, itemID string) error
+	// Merge moves the guest cart's lines into the user's cart, adding quantities of shared lines,
+	// and deletes the guest cart. A missing guest cart is not an error.
+	Merge(ctx context.Context, token, userID string) error
+	// DeleteStaleGuestCarts removes guest carts not updated since before
+	DeleteStaleGuestCarts(ctx context.Context, before time.Time) (int64, error)
+}
+
+type cartRepository struct {
+	db *gorm.DB
+}
+
+func NewCartRepository(db *gorm.DB) CartRepository {
+	return &cartRepository{db: db}
+}
+
+func orderedItems(db *gorm.DB) *gorm.DB {
+	return db.Order("cart_items.created_at ASC, cart_items.id")
+}
+
+func (r *cartRepository) GetByOwner(ctx context.Context, owner CartOwner) (*Cart, error) {
+	return getByOwner(r.db.WithContext(ctx), owner)
+}
+
+func getByOwner(db *gorm.DB, owner CartOwner) (*Cart, error) {
+	query := db.Preload("Items", orderedItems)
+	if owner.isGuest() {
+		if owner.Token == "" {
+			return nil, ErrCartNotFound
+		}
+		query = query.Where("token = ?", owner.Token)
+	} else {
+		query = query.Where("user_id = ?", owner.UserID)
+	}
+	var cart Cart
+	err := query.First(&cart).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCartNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+func (r *cartRepository) Create(ctx context.Context, cart *Cart) error {
+	return r.db.WithContext(ctx).Create(cart).Error
+}
+
+func (r *cartRepository) SetItem(ctx context.Context, item *CartItem) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "cart_id"}, {Name: "product_id"}, {Name: "variant_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"quantity", "price"}),
+		}).Create(item).Error
+		if err != nil {
+			return err
+		}
+		return touch(tx, item.CartID)
+	})
+}
+
+func (r *cartRepository) UpdateItem(ctx context.Context, cartID, itemID string, quantity, price int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&CartItem{}).Where("id = ? AND cart_id = ?", itemID, cartID).
+			Updates(map[string]interface{}{"quantity": quantity, "price": price})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrItemNotFound
+		}
+		return touch(tx, cartID)
+	})
+}
+
+func (r *cartRepository) DeleteItem(ctx context.Context, cartID, itemID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND cart_id = ?", itemID, cartID).Delete(&CartItem{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrItemNotFound
+		}
+		return touch(tx, cartID)
+	})
+}
+
+func (r *cartRepository) Merge(ctx context.Context, token, userID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		guest, err := getByOwner(tx.Clauses(clause.Locking{Strength: "UPDATE"}), CartOwner{Token: token})
+		if errors.Is(err, ErrCartNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cart, err := getByOwner(tx, CartOwner{UserID: userID})
+		if errors.Is(err, ErrCartNotFound) {
+			// Adopt the guest cart as it is
+			return tx.Model(&Cart{}).Where("id = ?", guest.ID).
+				Updates(map[string]interface{}{"user_id": userID, "token": "", "updated_at": time.Now()}).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		lines := make(map[string]CartItem, len(cart.Items))
+		for _, item := range cart.Items {
+			lines[item.ProductID+"/"+item.VariantID] = item
+		}
+		for _, item := range guest.Items {
+			existing, ok := lines[item.ProductID+"/"+item.VariantID]
+			if !ok {
+				if len(lines) >= maxCartLines {
+					continue
+				}
+				lines[item.ProductID+"/"+item.VariantID] = item
+				err = tx.Model(&CartItem{}).Where("id = ?", item.ID).Update("cart_id", cart.ID).Error
+			} else {
+				err = tx.Model(&CartItem{}).Where("id = ?", existing.ID).
+					Update("quantity", min(existing.Quantity+item.Quantity, maxLineQuantity)).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("cart_id = ?", guest.ID).Delete(&CartItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&Cart{}, "id = ?", guest.ID).Error; err != nil {
+			return err
+		}
+		return touch(tx, cart.ID)
+	})
+}
+
+func (r *cartRepository) DeleteStaleGuestCarts(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stale := tx.Model(&Cart{}).Select("id").Where("token <> '' AND updated_at < ?", before)
+		if err := tx.Where("cart_id IN (?)", stale).Delete(&CartItem{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("token <> '' AND updated_at < ?", before).Delete(&Cart{})
+		deleted = res.RowsAffected
+		return res.Error
+	})
+	return deleted, err
+}
+
+// touch marks the cart as updated so active guest carts are not cleaned up
+func touch(tx *gorm.DB, cartID string) error {
+	return tx.Model(&Cart{}).Where("id = ?", cartID).Update("updated_at", time.Now()).Error
+}
@@ -0,0 +1,248 @@
+package carts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"ecommerce-backend/core/products"
+	"github.com/google/uuid"
+)
+
+type CartService interface {
+	// Get returns the owner's cart priced now; an owner without a cart gets an empty one
+	Get(ctx context.Context, owner CartOwner) (*CartResponse, error)
+	// AddItem adds quantity to the line, creating the cart (and a guest token) when needed
+	AddItem(ctx context.Context, owner CartOwner, req AddItemRequest) (*CartResponse, error)
+	// UpdateItem sets the line's quantity; zero removes it
+	UpdateItem(ctx context.Context, owner CartOwner, itemID string, quantity int) (*CartResponse, error)
+	RemoveItem(ctx context.Context, owner CartOwner, itemID string) (*CartResponse, error)
+	// MergeGuestCart implements users.CartMerger
+	MergeGuestCart(ctx context.Context, token string, userID uuid.UUID) error
+	CleanupGuestCarts(ctx context.Context) (int64, error)
+}
+
+type cartService struct {
+	repo        CartRepository
+	productRepo products.ProductRepository
+}
+
+func NewCartService(repo CartRepository, productRepo products.ProductRepository) CartService {
+	return &cartService{
+		repo:        repo,
+		productRepo: productRepo,
+	}
+}
+
+func (s *cartService) Get(ctx context.Context, owner CartOwner) (*CartResponse, error) {
+	cart, err := s.repo.GetByOwner(ctx, owner)
+	if errors.Is(err, ErrCartNotFound) {
+		return &CartResponse{Items: []CartItemResponse{}, Valid: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.price(ctx, cart)
+}
+
+func (s *cartService) AddItem(ctx context.Context, owner CartOwner, req AddItemRequest) (*CartResponse, error) {
+	cart, err := s.getOrCreate(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	quantity := req.Quantity
+	for _, item := range cart.Items {
+		if item.ProductID == req.ProductID && item.VariantID == req.VariantID {
+			quantity += item.Quantity
+			break
+		}
+	}
+	if quantity == req.Quantity && len(cart.Items) >= maxCartLines {
+		return nil, ErrCartFull
+	}
+	price, err := s.checkLine(ctx, req.ProductID, req.VariantID, quantity)
+	if err != nil {
+		return nil, err
+	}
+	item := &CartItem{CartID: cart.ID, ProductID: req.ProductID, VariantID: req.VariantID, Quantity: quantity, Price: price}
+	if err := s.repo.SetItem(ctx, item); err != nil {
+		return nil, err
+	}
+	return s.reload(ctx, cart)
+}
+
+func (s *cartService) UpdateItem(ctx context.Context, owner CartOwner, itemID string, quantity int) (*CartResponse, error) {
+	if quantity == 0 {
+		return s.RemoveItem(ctx, owner, itemID)
+	}
+	cart, item, err := s.findItem(ctx, owner, itemID)
+	if err != nil {
+		return nil, err
+	}
+	price, err := s.checkLine(ctx, item.ProductID, item.VariantID, quantity)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateItem(ctx, cart.ID, itemID, quantity, price); err != nil {
+		return nil, err
+	}
+	return s.reload(ctx, cart)
+}
+
+func (s *cartService) RemoveItem(ctx context.Context, owner CartOwner, itemID string) (*CartResponse, error) {
+	cart, _, err := s.findItem(ctx, owner, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.DeleteItem(ctx, cart.ID, itemID); err != nil {
+		return nil, err
+	}
+	return s.reload(ctx, cart)
+}
+
+func (s *cartService) MergeGuestCart(ctx context.Context, token string, userID uuid.UUID) error {
+	if token == "" {
+		return nil
+	}
+	return s.repo.Merge(ctx, token, userID.String())
+}
+
+func (s *cartService) CleanupGuestCarts(ctx context.Context) (int64, error) {
+	return s.repo.DeleteStaleGuestCarts(ctx, time.Now().Add(-guestCartRetention))
+}
+
+func (s *cartService) getOrCreate(ctx context.Context, owner CartOwner) (*Cart, error) {
+	cart, err := s.repo.GetByOwner(ctx, owner)
+	if !errors.Is(err, ErrCartNotFound) {
+		return cart, err
+	}
+	cart = &Cart{UserID: owner.UserID}
+	if owner.isGuest() {
+		// Unknown tokens are replaced rather than trusted, so clients cannot pick their own
+		if cart.Token, err = newCartToken(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.Create(ctx, cart); err != nil {
+		if owner.isGuest() {
+			return nil, err
+		}
+		// Another request created the user's cart first
+		return s.repo.GetByOwner(ctx, owner)
+	}
+	return cart, nil
+}
+
+func (s *cartService) findItem(ctx context.Context, owner CartOwner, itemID string) (*Cart, *CartItem, error) {
+	cart, err := s.repo.GetByOwner(ctx, owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range cart.Items {
+		if cart.Items[i].ID == itemID {
+			return cart, &cart.Items[i], nil
+		}
+	}
+	return nil, nil, ErrItemNotFound
+}
+
+// checkLine verifies the item can be bought in quantity now and returns its unit price
+func (s *cartService) checkLine(ctx context.Context, productID, variantID string, quantity int) (int, error) {
+	found, err := s.productRepo.GetByIDs(ctx, []string{productID})
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if len(found) == 0 || !found[0].IsVisible(now) {
+		return 0, products.ErrProductNotFound
+	}
+	p := &found[0]
+	if variantID == "" {
+		if p.HasActiveVariants() {
+			return 0, ErrVariantRequired
+		}
+		if p.TracksStock() && p.Available() < quantity {
+			return 0, products.ErrInsufficientStock
+		}
+		return p.PriceAt(now), nil
+	}
+	for _, v := range p.Variants {
+		if v.ID != variantID || !v.IsActive {
+			continue
+		}
+		if !v.InStock || p.TracksStock() && v.Available() < quantity {
+			return 0, products.ErrInsufficientStock
+		}
+		return v.PriceAt(now), nil
+	}
+	return 0, ErrVariantNotFound
+}
+
+func (s *cartService) reload(ctx context.Context, cart *Cart) (*CartResponse, error) {
+	fresh, err := s.repo.GetByOwner(ctx, CartOwner{UserID: cart.UserID, Token: cart.Token})
+	if err != nil {
+		return nil, err
+	}
+	return s.price(ctx, fresh)
+}
+
+// price recomputes every line against the catalogue
+func (s *cartService) price(ctx context.Context, cart *Cart) (*CartResponse, error) {
+	lines := make([]products.CartLine, len(cart.Items))
+	ids := make([]string, len(cart.Items))
+	for i, item := range cart.Items {
+		lines[i] = products.CartLine{ProductID: item.ProductID, VariantID: item.VariantID, Quantity: item.Quantity, Price: item.Price}
+		ids[i] = item.ProductID
+	}
+	found, err := s.productRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*products.Product, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+	validation := products.ValidateCart(lines, byID, time.Now())
+
+	resp := &CartResponse{Items: make([]CartItemResponse, len(cart.Items)), Valid: validation.Valid}
+	if cart.UserID == "" {
+		resp.Token = cart.Token
+	}
+	for i, item := range cart.Items {
+		status := validation.Items[i]
+		line := CartItemResponse{ID: item.ID, CartLineStatus: status}
+		if p, ok := byID[item.ProductID]; ok {
+			line.Name = p.Name
+			if len(p.Images) > 0 {
+				line.Image = p.Images[0].ImageURL
+			}
+			for _, v := range p.Variants {
+				if v.ID == item.VariantID {
+					line.SKU = v.SKU
+					if v.ImageURL != "" {
+						line.Image = v.ImageURL
+					}
+					line.Attributes = attributeMap(v.Attributes)
+				}
+			}
+		}
+		if status.Active {
+			line.LineTotal = status.CurrentPrice * item.Quantity
+			resp.Subtotal += line.LineTotal
+			resp.ItemCount += item.Quantity
+		}
+		resp.Items[i] = line
+	}
+	return resp, nil
+}
+
+func attributeMap(raw []byte) map[string]string {
+	var pairs []map[string]string
+	_ = json.Unmarshal(raw, &pairs)
+	attrs := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		attrs[pair["name"]] = pair["value"]
+	}
+	return attrs
+}
@@ -0,0 +1,148 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"ecommerce-backend/common/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type CategoryController struct {
+	service   CategoryService
+	validator *validator.Validate
+}
+
+func NewCategoryController(s CategoryService) *CategoryController {
+	return &CategoryController{
+		service:   s,
+		validator: validator.New(),
+	}
+}
+
+type CategoryRequest struct {
+	ParentID    *string `json:"parent_id"`
+	Name        string  `json:"name" validate:"required"`
+	Slug        string  `json:"slug"`
+	Description string  `json:"description"`
+	SortOrder   int     `json:"sort_order"`
+	IsActive    bool    `json:"is_active"`
+}
+
+func (c *CategoryController) RegisterRoutes(r *gin.Engine) {
+	group := r.Group("/categories")
+	group.GET("", c.ListCategories)
+	group.GET(":id", c.GetCategory)
+	group.POST("", middleware.AdminKeyMiddleware(), c.CreateCategory)
+	group.PUT(":id", middleware.AdminKeyMiddleware(), c.UpdateCategory)
+	group.DELETE(":id", middleware.AdminKeyMiddleware(), c.DeleteCategory)
+}
+
+// ListCategories returns the category tree, or a flat list with ?flat=true
+func (c *CategoryController) ListCategories(ctx *gin.Context) {
+	includeInactive := isAdminRequest(ctx)
+	if ctx.Query("flat") == "true" {
+		list, err := c.service.ListCategories(context.Background(), includeInactive)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, list)
+		return
+	}
+	tree, err := c.service.CategoryTree(context.Background(), includeInactive)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, tree)
+}
+
+// GetCategory accepts either the category ID or its slug
+func (c *CategoryController) GetCategory(ctx *gin.Context) {
+	category, err := c.service.GetCategory(context.Background(), ctx.Param("id"))
+	if err != nil || (!category.IsActive && !isAdminRequest(ctx)) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "category not found"})
+		return
+	}
+	ctx.JSON(http.StatusOK, category)
+}
+
+func (c *CategoryController) CreateCategory(ctx *gin.Context) {
+	var req CategoryRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category, err := c.service.CreateCategory(context.Background(), req.toCategory(""))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, category)
+}
+
+func (c *CategoryController) UpdateCategory(ctx *gin.Context) {
+	var req CategoryRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category, err := c.service.UpdateCategory(context.Background(), req.toCategory(ctx.Param("id")))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, category)
+}
+
+func (c *CategoryController) DeleteCategory(ctx *gin.Context) {
+	if err := c.service.DeleteCategory(context.Background(), ctx.Param("id")); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deleted": true})
+}
+
+func (c *CategoryController) Name() string {
+	return "categories"
+}
+
+func (r CategoryRequest) toCategory(id string) *Category {
+	return &Category{
+		ID:          id,
+		ParentID:    r.ParentID,
+		Name:        r.Name,
+		Slug:        r.Slug,
+		Description: r.Description,
+		SortOrder:   r.SortOrder,
+		IsActive:    r.IsActive,
+	}
+}
+
+func isAdminRequest(ctx *gin.Context) bool {
+	return ctx.GetHeader("X-Admin-API-Key") != "" || ctx.Query("admin_key") != ""
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrCategoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrCategoryInUse), errors.Is(err, ErrSlugTaken):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidParent), errors.Is(err, ErrEmptySlug):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
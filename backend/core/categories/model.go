@@ -0,0 +1,63 @@
+package categories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryInUse    = errors.New("category still has subcategories or products")
+	ErrInvalidParent    = errors.New("category cannot be moved under itself or its descendants")
+	ErrSlugTaken        = errors.New("category slug already in use")
+	ErrEmptySlug        = errors.New("category slug is empty")
+)
+
+// Category is a node in the catalogue tree. Root categories have a nil ParentID.
+type Category struct {
+	ID          string    `gorm:"primaryKey" json:"id"`
+	ParentID    *string   `gorm:"index" json:"parent_id,omitempty"`
+	Name        string    `gorm:"not null" json:"name"`
+	Slug        string    `gorm:"uniqueIndex;not null" json:"slug"`
+	Description string    `gorm:"type:text" json:"description"`
+	SortOrder   int       `gorm:"default:0" json:"sort_order"`
+	IsActive    bool      `gorm:"default:true" json:"is_active"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (c *Category) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return
+}
+
+// CategoryNode is a category with its children, ordered by SortOrder then Name
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// BuildTree nests a flat, already ordered list. Children of missing parents become roots.
+func BuildTree(list []Category) []*CategoryNode {
+	nodes := make(map[string]*CategoryNode, len(list))
+	for _, c := range list {
+		nodes[c.ID] = &CategoryNode{Category: c, Children: []*CategoryNode{}}
+	}
+	roots := make([]*CategoryNode, 0)
+	for _, c := range list {
+		node := nodes[c.ID]
+		if c.ParentID != nil {
+			if parent, ok := nodes[*c.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
@@ -0,0 +1,158 @@
+package categories
+
+import (
+	"context"
+	"errors"
+
+	"ecommerce-backend/common/slug"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type CategoryRepository interface {
+	Create(ctx context.Context, category *Category) error
+	Update(ctx context.Context, category *Category) error
+	Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*Category, error)
+	// GetByRef looks a category up by ID first, then by slug
+	GetByRef(ctx context.Context, ref string) (*Category, error)
+	List(ctx context.Context, includeInactive bool) ([]Category, error)
+	// DescendantIDs returns id and every category below it
+	DescendantIDs(ctx context.Context, id string, includeInactive bool) ([]string, error)
+	CountChildren(ctx context.Context, id string) (int64, error)
+	CountProducts(ctx context.Context, id string) (int64, error)
+	// MigrateLegacy turns free-form product category strings into categories and links the products
+	MigrateLegacy(ctx context.Context) error
+}
+
+type categoryRepository struct {
+	db *gorm.DB
+}
+
+func NewCategoryRepository(db *gorm.DB) CategoryRepository {
+	return &categoryRepository{db: db}
+}
+
+func (r *categoryRepository) Create(ctx context.Context, category *Category) error {
+	return r.db.WithContext(ctx).Create(category).Error
+}
+
+func (r *categoryRepository) Update(ctx context.Context, category *Category) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Category{}).Where("id = ?", category.ID).
+			Updates(map[string]interface{}{
+				"parent_id":   category.ParentID,
+				"name":        category.Name,
+				"slug":        category.Slug,
+				"description": category.Description,
+				"sort_order":  category.SortOrder,
+				"is_active":   category.IsActive,
+			}).Error
+		if err != nil {
+			return err
+		}
+		// products.category mirrors the slug for display and legacy clients
+		return tx.Table("products").Where("category_id = ?", category.ID).Update("category", category.Slug).Error
+	})
+}
+
+func (r *categoryRepository) Delete(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&Category{}).Error
+}
+
+func (r *categoryRepository) GetByID(ctx context.Context, id string) (*Category, error) {
+	var category Category
+	if err := r.db.WithContext(ctx).First(&category, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *categoryRepository) GetByRef(ctx context.Context, ref string) (*Category, error) {
+	category, err := r.GetByID(ctx, ref)
+	if !errors.Is(err, ErrCategoryNotFound) {
+		return category, err
+	}
+	var bySlug Category
+	if err := r.db.WithContext(ctx).First(&bySlug, "slug = ?", ref).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+	return &bySlug, nil
+}
+
+func (r *categoryRepository) List(ctx context.Context, includeInactive bool) ([]Category, error) {
+	var list []Category
+	db := r.db.WithContext(ctx).Model(&Category{})
+	if !includeInactive {
+		db = db.Where("is_active = ?", true)
+	}
+	if err := db.Order("sort_order ASC, name ASC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *categoryRepository) DescendantIDs(ctx context.Context, id string, includeInactive bool) ([]string, error) {
+	activeOnly := ""
+	if !includeInactive {
+		activeOnly = " AND c.is_active"
+	}
+	var ids []string
+	err := r.db.WithContext(ctx).Raw(`WITH RECURSIVE tree AS (
+		SELECT id FROM categories WHERE id = ?
+		UNION
+		SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id`+activeOnly+`
+	) SELECT id FROM tree`, id).Scan(&ids).Error
+	return ids, err
+}
+
+func (r *categoryRepository) CountChildren(ctx context.Context, id string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&Category{}).Where("parent_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+func (r *categoryRepository) CountProducts(ctx context.Context, id string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Table("products").Where("category_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+func (r *categoryRepository) MigrateLegacy(ctx context.Context) error {
+	var names []string
+	err := r.db.WithContext(ctx).Table("products").
+		Where("(category_id IS NULL OR category_id = '') AND category <> ''").
+		Distinct("category").Pluck("category", &names).Error
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		s := slug.Make(name)
+		if s == "" {
+			continue
+		}
+		var category Category
+		err := r.db.WithContext(ctx).Where("slug = ?", s).First(&category).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			category = Category{Name: name, Slug: s, IsActive: true}
+			err = r.db.WithContext(ctx).Create(&category).Error
+		}
+		if err != nil {
+			return err
+		}
+		res := r.db.WithContext(ctx).Table("products").
+			Where("(category_id IS NULL OR category_id = '') AND category = ?", name).
+			Updates(map[string]interface{}{"category_id": category.ID, "category": category.Slug})
+		if res.Error != nil {
+			return res.Error
+		}
+		logrus.Infof("migrated %d products from category string %q to category %s", res.RowsAffected, name, category.Slug)
+	}
+	return nil
+}
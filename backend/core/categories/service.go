@@ -0,0 +1,119 @@
+package categories
+
+import (
+	"context"
+	"errors"
+
+	"ecommerce-backend/common/slug"
+)
+
+type CategoryService interface {
+	CreateCategory(ctx context.Context, category *Category) (*Category, error)
+	UpdateCategory(ctx context.Context, category *Category) (*Category, error)
+	DeleteCategory(ctx context.Context, id string) error
+	GetCategory(ctx context.Context, ref string) (*Category, error)
+	ListCategories(ctx context.Context, includeInactive bool) ([]Category, error)
+	CategoryTree(ctx context.Context, includeInactive bool) ([]*CategoryNode, error)
+}
+
+type categoryService struct {
+	repo CategoryRepository
+}
+
+func NewCategoryService(repo CategoryRepository) CategoryService {
+	return &categoryService{repo: repo}
+}
+
+func (s *categoryService) CreateCategory(ctx context.Context, category *Category) (*Category, error) {
+	if err := s.prepare(ctx, category); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, category); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+func (s *categoryService) UpdateCategory(ctx context.Context, category *Category) (*Category, error) {
+	if _, err := s.repo.GetByID(ctx, category.ID); err != nil {
+		return nil, err
+	}
+	if err := s.prepare(ctx, category); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, category); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, category.ID)
+}
+
+func (s *categoryService) DeleteCategory(ctx context.Context, id string) error {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return err
+	}
+	children, err := s.repo.CountChildren(ctx, id)
+	if err != nil {
+		return err
+	}
+	products, err := s.repo.CountProducts(ctx, id)
+	if err != nil {
+		return err
+	}
+	if children > 0 || products > 0 {
+		return ErrCategoryInUse
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *categoryService) GetCategory(ctx context.Context, ref string) (*Category, error) {
+	return s.repo.GetByRef(ctx, ref)
+}
+
+func (s *categoryService) ListCategories(ctx context.Context, includeInactive bool) ([]Category, error) {
+	return s.repo.List(ctx, includeInactive)
+}
+
+func (s *categoryService) CategoryTree(ctx context.Context, includeInactive bool) ([]*CategoryNode, error) {
+	list, err := s.repo.List(ctx, includeInactive)
+	if err != nil {
+		return nil, err
+	}
+	return BuildTree(list), nil
+}
+
+// prepare normalises the slug and checks it is free and that the parent keeps the tree acyclic
+func (s *categoryService) prepare(ctx context.Context, category *Category) error {
+	if category.Slug == "" {
+		category.Slug = category.Name
+	}
+	category.Slug = slug.Make(category.Slug)
+	if category.Slug == "" {
+		return ErrEmptySlug
+	}
+	if existing, err := s.repo.GetByRef(ctx, category.Slug); err == nil && existing.ID != category.ID {
+		return ErrSlugTaken
+	} else if err != nil && !errors.Is(err, ErrCategoryNotFound) {
+		return err
+	}
+
+	if category.ParentID == nil || *category.ParentID == "" {
+		category.ParentID = nil
+		return nil
+	}
+	if _, err := s.repo.GetByID(ctx, *category.ParentID); err != nil {
+		return err
+	}
+	if category.ID == "" {
+		return nil
+	}
+	below, err := s.repo.DescendantIDs(ctx, category.ID, true)
+	if err != nil {
+		return err
+	}
+	for _, id := range below {
+		if id == *category.ParentID {
+			return ErrInvalidParent
+		}
+	}
+	return nil
+}
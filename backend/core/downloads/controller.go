@@ -0,0 +1,187 @@
+package downloads
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"ecommerce-backend/common/middleware"
+	"ecommerce-backend/core/products"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type DownloadController struct {
+	service        DownloadService
+	authMW         gin.HandlerFunc
+	maxUploadBytes int64
+}
+
+func NewDownloadController(s DownloadService, authMW gin.HandlerFunc, maxUploadBytes int64) *DownloadController {
+	return &DownloadController{
+		service:        s,
+		authMW:         authMW,
+		maxUploadBytes: maxUploadBytes,
+	}
+}
+
+func (c *DownloadController) RegisterRoutes(r *gin.Engine) {
+	files := r.Group("/products")
+	files.POST(":id/files", middleware.AdminKeyMiddleware(), c.UploadFiles)
+	files.GET(":id/files", middleware.AdminKeyMiddleware(), c.ListFiles)
+	files.DELETE(":id/files/:file_id", middleware.AdminKeyMiddleware(), c.DeleteFile)
+
+	ug := r.Group("/user/orders")
+	if c.authMW != nil {
+		ug.Use(c.authMW)
+	}
+	ug.GET(":id/downloads", c.ListMine)
+
+	// Signed links work without a session so they can be opened in any browser or download manager
+	r.GET("/downloads/:id", c.Download)
+}
+
+// UploadFiles attaches every multipart "file" part to the digital product
+func (c *DownloadController) UploadFiles(ctx *gin.Context) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, 2*c.maxUploadBytes)
+	reader, err := ctx.Request.MultipartReader()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "expected a multipart form with file fields"})
+		return
+	}
+
+	uploaded := make([]*ProductFile, 0)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if part.FormName() != "file" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		// Each part goes straight to storage; it is never held in memory
+		file, err := c.service.UploadFile(ctx.Request.Context(), ctx.Param("id"), part.FileName(), &sizeLimit{r: part, n: c.maxUploadBytes})
+		part.Close()
+		if err != nil {
+			ctx.JSON(errorStatus(err), gin.H{"error": err.Error(), "file": part.FileName()})
+			return
+		}
+		uploaded = append(uploaded, file)
+	}
+	if len(uploaded) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "no file uploaded"})
+		return
+	}
+	ctx.JSON(http.StatusOK, uploaded)
+}
+
+// sizeLimit reads at most n bytes of r and fails with ErrFileTooLarge past them
+type sizeLimit struct {
+	r io.Reader
+	n int64
+}
+
+func (l *sizeLimit) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return 0, ErrFileTooLarge
+	}
+	return n, err
+}
+
+func (c *DownloadController) ListFiles(ctx *gin.Context) {
+	files, err := c.service.ListFiles(context.Background(), ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, files)
+}
+
+func (c *DownloadController) DeleteFile(ctx *gin.Context) {
+	if err := c.service.DeleteFile(context.Background(), ctx.Param("id"), ctx.Param("file_id")); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deleted": true})
+}
+
+// ListMine returns the downloads of one of the user's orders. Links expire quickly, so clients
+// should fetch this list right before offering the downloads.
+func (c *DownloadController) ListMine(ctx *gin.Context) {
+	val, ok := ctx.Get("user_id")
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	userUUID, ok := val.(uuid.UUID)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user"})
+		return
+	}
+	list, err := c.service.ListForOrder(context.Background(), ctx.Param("id"), userUUID.String())
+	if errors.Is(err, ErrDownloadNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Header("Cache-Control", "private, no-store")
+	ctx.JSON(http.StatusOK, list)
+}
+
+// Download streams the file behind a signed link and counts the download
+func (c *DownloadController) Download(ctx *gin.Context) {
+	body, size, file, err := c.service.Open(context.Background(), ctx.Param("id"), ctx.Query("expires"), ctx.Query("signature"))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+	ctx.DataFromReader(http.StatusOK, size, file.ContentType, body, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": file.FileName}),
+		"Cache-Control":       "private, no-store",
+	})
+}
+
+func (c *DownloadController) Name() string {
+	return "downloads"
+}
+
+// MaxUploadBytes converts the configured limit, defaulting to 100 MB
+func MaxUploadBytes(mb int) int64 {
+	if mb <= 0 {
+		mb = 100
+	}
+	return int64(mb) << 20
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrFileNotFound), errors.Is(err, ErrDownloadNotFound), errors.Is(err, products.ErrProductNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNotDigital):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrFileTooLarge), errors.As(err, new(*http.MaxBytesError)):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrLinkExpired):
+		return http.StatusForbidden
+	case errors.Is(err, ErrDownloadExpired), errors.Is(err, ErrDownloadRevoked), errors.Is(err, ErrDownloadLimit):
+		return http.StatusGone
+	default:
+		return http.StatusInternalServerError
+	}
+}
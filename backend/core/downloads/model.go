@@ -0,0 +1,94 @@
+package downloads
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFileNotFound     = errors.New("file not found")
+	ErrFileTooLarge     = errors.New("file is too large")
+	ErrNotDigital       = errors.New("files can only be attached to digital products")
+	ErrDownloadNotFound = errors.New("download not found")
+	ErrInvalidSignature = errors.New("invalid download link")
+	ErrLinkExpired      = errors.New("download link expired; request a new one from the order")
+	ErrDownloadExpired  = errors.New("download has expired")
+	ErrDownloadRevoked  = errors.New("download is no longer available")
+	ErrDownloadLimit    = errors.New("download limit reached")
+)
+
+// ProductFile is a file delivered to the buyers of a digital product, stored under "<product id>/<id>"
+type ProductFile struct {
+	ID          string    `gorm:"primaryKey" json:"id"`
+	ProductID   string    `gorm:"index;not null" json:"product_id"`
+	FileName    string    `gorm:"not null" json:"file_name"`
+	ContentType string    `gorm:"not null" json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (f *ProductFile) BeforeCreate(tx *gorm.DB) (err error) {
+	if f.ID == "" {
+		f.ID = uuid.New().String()
+	}
+	return
+}
+
+func (f *ProductFile) key() string {
+	return f.ProductID + "/" + f.ID
+}
+
+func (ProductFile) TableName() string {
+	return "product_files"
+}
+
+// Download entitles the buyer of an order to one file of a digital item. Its ID goes into the
+// signed links handed to the buyer; every download through them counts against MaxDownloads.
+type Download struct {
+	ID               string     `gorm:"primaryKey" json:"id"`
+	OrderID          string     `gorm:"uniqueIndex:idx_order_downloads_file;not null" json:"order_id"`
+	FileID           string     `gorm:"uniqueIndex:idx_order_downloads_file;not null" json:"file_id"`
+	ProductID        string     `gorm:"not null" json:"product_id"`
+	UserID           string     `gorm:"index" json:"user_id"`
+	MaxDownloads     int        `gorm:"not null;default:0" json:"max_downloads"` // 0 for unlimited
+	DownloadCount    int        `gorm:"not null;default:0" json:"download_count"`
+	ExpiresAt        *time.Time `json:"expires_at"` // nil never expires
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	LastDownloadedAt *time.Time `json:"last_downloaded_at,omitempty"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (Download) TableName() string {
+	return "order_downloads"
+}
+
+// usable returns why the download cannot be used at now, or nil
+func (d *Download) usable(now time.Time) error {
+	switch {
+	case d.RevokedAt != nil:
+		return ErrDownloadRevoked
+	case d.ExpiresAt != nil && !now.Before(*d.ExpiresAt):
+		return ErrDownloadExpired
+	case d.MaxDownloads > 0 && d.DownloadCount >= d.MaxDownloads:
+		return ErrDownloadLimit
+	}
+	return nil
+}
+
+// DownloadResponse describes a download to its buyer. URL is only set while the download can be used.
+type DownloadResponse struct {
+	ID            string     `json:"id"`
+	ProductID     string     `json:"product_id"`
+	FileID        string     `json:"file_id"`
+	FileName      string     `json:"file_name"`
+	Size          int64      `json:"size"`
+	URL           string     `json:"url,omitempty"`
+	URLExpiresAt  *time.Time `json:"url_expires_at,omitempty"`
+	DownloadCount int        `json:"download_count"`
+	MaxDownloads  int        `json:"max_downloads"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	Status        string     `json:"status"` // "available", or why it is not: "revoked", "expired", "limit_reached"
+}
@@ -0,0 +1,118 @@
+package downloads
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DownloadRepository interface {
+	CreateFile(ctx context.Context, file *ProductFile) error
+	GetFile(ctx context.Context, id string) (*ProductFile, error)
+	ListFiles(ctx context.Context, productIDs ...string) ([]ProductFile, error)
+	DeleteFile(ctx context.Context, id string) error
+	// Grant creates the downloads an order lacks and reinstates revoked ones
+	Grant(ctx context.Context, downloads []Download) error
+	Revoke(ctx context.Context, orderID string, at time.Time) error
+	GetByID(ctx context.Context, id string) (*Download, error)
+	ListByOrder(ctx context.Context, orderID string) ([]Download, error)
+	// Consume counts one download at now unless the download was revoked, expired or used up
+	// meanwhile, which returns false
+	Consume(ctx context.Context, id string, now time.Time) (bool, error)
+}
+
+type downloadRepository struct {
+	db *gorm.DB
+}
+
+func NewDownloadRepository(db *gorm.DB) DownloadRepository {
+	return &downloadRepository{db: db}
+}
+
+func (r *downloadRepository) CreateFile(ctx context.Context, file *ProductFile) error {
+	return r.db.WithContext(ctx).Create(file).Error
+}
+
+func (r *downloadRepository) GetFile(ctx context.Context, id string) (*ProductFile, error) {
+	var file ProductFile
+	err := r.db.WithContext(ctx).First(&file, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func (r *downloadRepository) ListFiles(ctx context.Context, productIDs ...string) ([]ProductFile, error) {
+	var files []ProductFile
+	err := r.db.WithContext(ctx).Where("product_id IN ?", productIDs).Order("created_at, id").Find(&files).Error
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (r *downloadRepository) DeleteFile(ctx context.Context, id string) error {
+	res := r.db.WithContext(ctx).Where("id = ?", id).Delete(&ProductFile{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrFileNotFound
+	}
+	return nil
+}
+
+func (r *downloadRepository) Grant(ctx context.Context, downloads []Download) error {
+	if len(downloads) == 0 {
+		return nil
+	}
+	// Counts and expiry survive a revoke, so granting again does not reset them
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "order_id"}, {Name: "file_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"revoked_at": nil}),
+	}).Create(&downloads).Error
+}
+
+func (r *downloadRepository) Revoke(ctx context.Context, orderID string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&Download{}).
+		Where("order_id = ? AND revoked_at IS NULL", orderID).
+		Update("revoked_at", at).Error
+}
+
+func (r *downloadRepository) GetByID(ctx context.Context, id string) (*Download, error) {
+	var download Download
+	err := r.db.WithContext(ctx).First(&download, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDownloadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &download, nil
+}
+
+func (r *downloadRepository) ListByOrder(ctx context.Context, orderID string) ([]Download, error) {
+	var downloads []Download
+	err := r.db.WithContext(ctx).Where("order_id = ?", orderID).Order("created_at, id").Find(&downloads).Error
+	if err != nil {
+		return nil, err
+	}
+	return downloads, nil
+}
+
+func (r *downloadRepository) Consume(ctx context.Context, id string, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&Download{}).
+		Where("id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", id, now).
+		Where("max_downloads = 0 OR download_count < max_downloads").
+		Updates(map[string]interface{}{
+			"download_count":     gorm.Expr("download_count + 1"),
+			"last_downloaded_at": now,
+		})
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,293 @@
+package downloads
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"ecommerce-backend/core/media"
+	"ecommerce-backend/core/orders"
+	"ecommerce-backend/core/products"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type DownloadService interface {
+	// UploadFile streams r to storage as a file of the digital product
+	UploadFile(ctx context.Context, productID, fileName string, r io.Reader) (*ProductFile, error)
+	ListFiles(ctx context.Context, productID string) ([]ProductFile, error)
+	DeleteFile(ctx context.Context, productID, fileID string) error
+	// GrantDownloads and RevokeDownloads implement orders.DownloadGranter
+	GrantDownloads(ctx context.Context, order *orders.Order) error
+	RevokeDownloads(ctx context.Context, orderID string) error
+	// ListForOrder returns the downloads of the user's order with freshly signed links
+	ListForOrder(ctx context.Context, orderID, userID string) ([]DownloadResponse, error)
+	// Open checks a signed link, counts the download and streams its file
+	Open(ctx context.Context, id, expires, signature string) (io.ReadCloser, int64, *ProductFile, error)
+}
+
+type DownloadConfig struct {
+	BaseURL string
+	// Secret signs the links; they stay valid for LinkTTL
+	Secret  []byte
+	LinkTTL time.Duration
+	// MaxDownloads and Expiry apply to each download granted from now on; 0 lifts the limit
+	MaxDownloads int
+	Expiry       time.Duration
+}
+
+type downloadService struct {
+	repo        DownloadRepository
+	orderRepo   orders.OrderRepository
+	productRepo products.ProductRepository
+	storage     media.Storage
+	config      *DownloadConfig
+}
+
+func NewDownloadService(repo DownloadRepository, orderRepo orders.OrderRepository, productRepo products.ProductRepository, storage media.Storage, config *DownloadConfig) DownloadService {
+	return &downloadService{
+		repo:        repo,
+		orderRepo:   orderRepo,
+		productRepo: productRepo,
+		storage:     storage,
+		config:      config,
+	}
+}
+
+func (s *downloadService) UploadFile(ctx context.Context, productID, fileName string, r io.Reader) (*ProductFile, error) {
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, products.ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !product.Digital {
+		return nil, ErrNotDigital
+	}
+	data := bufio.NewReader(r)
+	contentType := mime.TypeByExtension(filepath.Ext(fileName))
+	if contentType == "" {
+		head, _ := data.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+	file := &ProductFile{
+		ID:          uuid.New().String(),
+		ProductID:   productID,
+		FileName:    filepath.Base(fileName),
+		ContentType: contentType,
+	}
+	w, err := s.storage.Create(ctx, file.key())
+	if err != nil {
+		return nil, err
+	}
+	file.Size, err = io.Copy(w, data)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = s.storage.Delete(ctx, file.key())
+		return nil, err
+	}
+	if err := s.repo.CreateFile(ctx, file); err != nil {
+		_ = s.storage.Delete(ctx, file.key())
+		return nil, err
+	}
+	return file, nil
+}
+
+func (s *downloadService) ListFiles(ctx context.Context, productID string) ([]ProductFile, error) {
+	return s.repo.ListFiles(ctx, productID)
+}
+
+// DeleteFile removes the file for good; buyers who were granted it can no longer download it
+func (s *downloadService) DeleteFile(ctx context.Context, productID, fileID string) error {
+	file, err := s.repo.GetFile(ctx, fileID)
+	if err != nil {
+		return err
+	}
+	if file.ProductID != productID {
+		return ErrFileNotFound
+	}
+	if err := s.repo.DeleteFile(ctx, file.ID); err != nil {
+		return err
+	}
+	return s.storage.Delete(ctx, file.key())
+}
+
+// GrantDownloads gives the buyer one download per file of every digital item in the order.
+// Files attached later are picked up when the order reaches a granting status again.
+func (s *downloadService) GrantDownloads(ctx context.Context, order *orders.Order) error {
+	var items []orders.OrderItem
+	_ = json.Unmarshal(order.ItemsJSON, &items)
+	var productIDs []string
+	for _, it := range items {
+		if it.Digital {
+			productIDs = append(productIDs, it.ProductID)
+		}
+	}
+	if len(productIDs) == 0 {
+		return nil
+	}
+	files, err := s.repo.ListFiles(ctx, productIDs...)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var expiresAt *time.Time
+	if s.config.Expiry > 0 {
+		t := now.Add(s.config.Expiry)
+		expiresAt = &t
+	}
+	downloads := make([]Download, 0, len(files))
+	for _, f := range files {
+		downloads = append(downloads, Download{
+			ID:           uuid.New().String(),
+			OrderID:      order.ID,
+			FileID:       f.ID,
+			ProductID:    f.ProductID,
+			UserID:       order.UserID,
+			MaxDownloads: s.config.MaxDownloads,
+			ExpiresAt:    expiresAt,
+		})
+	}
+	return s.repo.Grant(ctx, downloads)
+}
+
+func (s *downloadService) RevokeDownloads(ctx context.Context, orderID string) error {
+	return s.repo.Revoke(ctx, orderID, time.Now())
+}
+
+func (s *downloadService) ListForOrder(ctx context.Context, orderID, userID string) ([]DownloadResponse, error) {
+	if _, err := s.orderRepo.GetByIDAndUser(ctx, orderID, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDownloadNotFound
+		}
+		return nil, err
+	}
+	downloads, err := s.repo.ListByOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]DownloadResponse, 0, len(downloads))
+	if len(downloads) == 0 {
+		return resp, nil
+	}
+	productIDs := make([]string, 0, len(downloads))
+	for _, d := range downloads {
+		productIDs = append(productIDs, d.ProductID)
+	}
+	files, err := s.repo.ListFiles(ctx, productIDs...)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*ProductFile, len(files))
+	for i := range files {
+		byID[files[i].ID] = &files[i]
+	}
+	now := time.Now()
+	for _, d := range downloads {
+		file := byID[d.FileID]
+		if file == nil {
+			// Removed by an admin
+			continue
+		}
+		r := DownloadResponse{
+			ID:            d.ID,
+			ProductID:     d.ProductID,
+			FileID:        d.FileID,
+			FileName:      file.FileName,
+			Size:          file.Size,
+			DownloadCount: d.DownloadCount,
+			MaxDownloads:  d.MaxDownloads,
+			ExpiresAt:     d.ExpiresAt,
+			Status:        downloadStatus(d.usable(now)),
+		}
+		if r.Status == "available" {
+			r.URL, r.URLExpiresAt = s.signedURL(&d, now)
+		}
+		resp = append(resp, r)
+	}
+	return resp, nil
+}
+
+func downloadStatus(err error) string {
+	switch {
+	case err == nil:
+		return "available"
+	case errors.Is(err, ErrDownloadRevoked):
+		return "revoked"
+	case errors.Is(err, ErrDownloadExpired):
+		return "expired"
+	default:
+		return "limit_reached"
+	}
+}
+
+// signedURL links to the download for LinkTTL, never beyond the download's own expiry
+func (s *downloadService) signedURL(d *Download, now time.Time) (string, *time.Time) {
+	expires := now.Add(s.config.LinkTTL).Truncate(time.Second)
+	if d.ExpiresAt != nil && d.ExpiresAt.Before(expires) {
+		expires = d.ExpiresAt.Truncate(time.Second)
+	}
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", s.sign(d.ID, expires.Unix()))
+	return s.config.BaseURL + "/downloads/" + url.PathEscape(d.ID) + "?" + query.Encode(), &expires
+}
+
+func (s *downloadService) sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, s.config.Secret)
+	mac.Write([]byte(id + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *downloadService) Open(ctx context.Context, id, expires, signature string) (io.ReadCloser, int64, *ProductFile, error) {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(s.sign(id, expiresAt))) {
+		return nil, 0, nil, ErrInvalidSignature
+	}
+	now := time.Now()
+	if now.Unix() >= expiresAt {
+		return nil, 0, nil, ErrLinkExpired
+	}
+	download, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if err := download.usable(now); err != nil {
+		return nil, 0, nil, err
+	}
+	file, err := s.repo.GetFile(ctx, download.FileID)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	body, size, err := s.storage.Open(ctx, file.key())
+	if errors.Is(err, media.ErrObjectNotFound) {
+		return nil, 0, nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	// Counted only once the file is ready to stream, so a missing file never uses up a download
+	consumed, err := s.repo.Consume(ctx, id, now)
+	if err == nil && !consumed {
+		err = ErrDownloadLimit
+	}
+	if err != nil {
+		body.Close()
+		return nil, 0, nil, err
+	}
+	return body, size, file, nil
+}
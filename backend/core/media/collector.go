@@ -0,0 +1,52 @@
+package media
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ImageCollector periodically garbage-collects unreferenced images
+type ImageCollector struct {
+	service ImageService
+	ticker  *time.Ticker
+	stop    chan bool
+}
+
+func NewImageCollector(service ImageService, interval time.Duration) *ImageCollector {
+	c := &ImageCollector{
+		service: service,
+		ticker:  time.NewTicker(interval),
+		stop:    make(chan bool),
+	}
+	go func() {
+		for {
+			select {
+			case <-c.ticker.C:
+				c.run()
+			case <-c.stop:
+				c.ticker.Stop()
+				return
+			}
+		}
+	}()
+	return c
+}
+
+func (c *ImageCollector) run() {
+	deleted, err := c.service.CollectGarbage(context.Background())
+	if err != nil {
+		logrus.Errorf("Failed to collect unreferenced images: %v", err)
+	}
+	if deleted > 0 {
+		logrus.Infof("Collected %d unreferenced images", deleted)
+	}
+}
+
+// Stop stops the collector goroutine
+func (c *ImageCollector) Stop() {
+	if c.stop != nil {
+		close(c.stop)
+	}
+}
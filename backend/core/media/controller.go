@@ -0,0 +1,140 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"ecommerce-backend/common/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+type ImageController struct {
+	service        ImageService
+	maxUploadBytes int64
+}
+
+func NewImageController(s ImageService, maxUploadBytes int64) *ImageController {
+	return &ImageController{
+		service:        s,
+		maxUploadBytes: maxUploadBytes,
+	}
+}
+
+func (c *ImageController) RegisterRoutes(r *gin.Engine) {
+	group := r.Group("/media/images")
+	group.POST("", middleware.AdminKeyMiddleware(), c.Upload)
+	group.POST("/gc", middleware.AdminKeyMiddleware(), c.CollectGarbage)
+	group.GET(":id", c.Get)
+	group.GET(":id/:rendition", c.Serve)
+}
+
+// Upload stores every multipart "file" part and returns their URLs in the same order
+func (c *ImageController) Upload(ctx *gin.Context) {
+	// Leave room for the multipart framing of several files
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, 4*c.maxUploadBytes)
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "expected a multipart form with file fields"})
+		return
+	}
+	files := form.File["file"]
+	if len(files) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "no file uploaded"})
+		return
+	}
+
+	uploaded := make([]*ImageResponse, 0, len(files))
+	for _, header := range files {
+		if header.Size > c.maxUploadBytes {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": ErrImageTooLarge.Error(), "file": header.Filename})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "file": header.Filename})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(file, c.maxUploadBytes+1))
+		file.Close()
+		if err == nil && int64(len(data)) > c.maxUploadBytes {
+			err = ErrImageTooLarge
+		}
+		if err != nil {
+			ctx.JSON(errorStatus(err), gin.H{"error": err.Error(), "file": header.Filename})
+			return
+		}
+		image, err := c.service.Upload(context.Background(), header.Filename, data)
+		if err != nil {
+			ctx.JSON(errorStatus(err), gin.H{"error": err.Error(), "file": header.Filename})
+			return
+		}
+		uploaded = append(uploaded, image)
+	}
+	ctx.JSON(http.StatusOK, uploaded)
+}
+
+func (c *ImageController) Get(ctx *gin.Context) {
+	image, err := c.service.Get(context.Background(), ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, image)
+}
+
+// Serve streams a rendition. Stored bytes never change for an ID, so responses are cached for a year.
+func (c *ImageController) Serve(ctx *gin.Context) {
+	id, rendition := ctx.Param("id"), ctx.Param("rendition")
+	etag := `"` + id + "-" + rendition + `"`
+	if ctx.GetHeader("If-None-Match") == etag {
+		ctx.Header("ETag", etag)
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	body, size, image, err := c.service.Open(context.Background(), id, rendition)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer body.Close()
+	ctx.DataFromReader(http.StatusOK, size, image.contentType(rendition), body, map[string]string{
+		"Cache-Control": "public, max-age=31536000, immutable",
+		"ETag":          etag,
+	})
+}
+
+func (c *ImageController) CollectGarbage(ctx *gin.Context) {
+	deleted, err := c.service.CollectGarbage(context.Background())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "deleted": deleted})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+func (c *ImageController) Name() string {
+	return "media"
+}
+
+// MaxUploadBytes converts the configured limit, defaulting to 10 MB
+func MaxUploadBytes(mb int) int64 {
+	if mb <= 0 {
+		mb = 10
+	}
+	return int64(mb) << 20
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrImageNotFound), errors.Is(err, ErrUnknownRendition), errors.Is(err, ErrObjectNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrUnsupportedType), errors.Is(err, ErrImageDimensionZero):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
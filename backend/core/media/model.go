@@ -0,0 +1,72 @@
+package media
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrImageNotFound      = errors.New("image not found")
+	ErrUnsupportedType    = errors.New("unsupported image type; use jpeg, png, gif or webp")
+	ErrImageTooLarge      = errors.New("image is too large")
+	ErrUnknownRendition   = errors.New("unknown rendition")
+	ErrImageDimensionZero = errors.New("image has no pixels")
+)
+
+// Renditions served for every image. The original keeps the uploaded bytes; the others are
+// downscaled copies that never exceed their bounding box.
+const (
+	RenditionOriginal  = "original"
+	RenditionMedium    = "medium"
+	RenditionThumbnail = "thumb"
+)
+
+var renditionSizes = map[string]int{
+	RenditionMedium:    800,
+	RenditionThumbnail: 200,
+}
+
+// Image is an uploaded file and its renditions, stored under "<id>/<rendition>"
+type Image struct {
+	ID            string    `gorm:"primaryKey" json:"id"`
+	FileName      string    `json:"file_name"`
+	ContentType   string    `gorm:"not null" json:"content_type"`           // of the original
+	RenditionType string    `gorm:"not null" json:"rendition_content_type"` // of medium and thumb
+	Width         int       `json:"width"`
+	Height        int       `json:"height"`
+	Size          int64     `json:"size"`
+	CreatedAt     time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+func (i *Image) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+	return
+}
+
+func (i *Image) key(rendition string) string {
+	return i.ID + "/" + rendition
+}
+
+func (i *Image) contentType(rendition string) string {
+	if rendition == RenditionOriginal {
+		return i.ContentType
+	}
+	return i.RenditionType
+}
+
+// ImageResponse carries the public URLs to put in product images
+type ImageResponse struct {
+	Image
+	URL          string `json:"url"`
+	MediumURL    string `json:"medium_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (Image) TableName() string {
+	return "media_images"
+}
@@ -0,0 +1,95 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxPixels bounds decoded images so a small, highly compressed upload cannot exhaust memory
+const maxPixels = 40_000_000
+
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// sniff detects the content type from the bytes themselves, ignoring what the client claimed
+func sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !allowedTypes[contentType] {
+		return "", ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// renderAll decodes data and encodes one downscaled copy per rendition size. Opaque images become
+// JPEG; images that may carry transparency become PNG.
+func renderAll(data []byte) (renditions map[string][]byte, contentType string, width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, 0, ErrUnsupportedType
+	}
+	if cfg.Width == 0 || cfg.Height == 0 {
+		return nil, "", 0, 0, ErrImageDimensionZero
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, "", 0, 0, ErrImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, 0, ErrUnsupportedType
+	}
+
+	opaque := false
+	if o, ok := src.(interface{ Opaque() bool }); ok {
+		opaque = o.Opaque()
+	}
+	contentType = "image/png"
+	if opaque {
+		contentType = "image/jpeg"
+	}
+
+	renditions = make(map[string][]byte, len(renditionSizes))
+	for name, size := range renditionSizes {
+		var buf bytes.Buffer
+		scaled := fit(src, size)
+		if opaque {
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, scaled)
+		}
+		if err != nil {
+			return nil, "", 0, 0, err
+		}
+		renditions[name] = buf.Bytes()
+	}
+	return renditions, contentType, cfg.Width, cfg.Height, nil
+}
+
+// fit scales src down to fit a size x size box, keeping the aspect ratio and never upscaling
+func fit(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	if w >= h {
+		h = max(1, h*size/w)
+		w = size
+	} else {
+		w = max(1, w*size/h)
+		h = size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,69 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ImageRepository interface {
+	Create(ctx context.Context, image *Image) error
+	GetByID(ctx context.Context, id string) (*Image, error)
+	// ListUnreferenced returns images created before olderThan that no product or variant uses
+	ListUnreferenced(ctx context.Context, olderThan time.Time) ([]Image, error)
+	// DeleteIfUnreferenced deletes the row unless a product started using it meanwhile
+	DeleteIfUnreferenced(ctx context.Context, id string) (bool, error)
+}
+
+type imageRepository struct {
+	db *gorm.DB
+}
+
+func NewImageRepository(db *gorm.DB) ImageRepository {
+	return &imageRepository{db: db}
+}
+
+// referencedSQL lists the IDs of the images product images, variant images and revision snapshots
+// point at. Rolling back to a revision brings its image URLs back, so their files must outlive it.
+// Soft-deleted products keep their rows, so their images survive until the product is purged.
+const referencedSQL = `SELECT substring(url FROM '/media/images/([^/]+)/') AS id FROM (
+		SELECT image_url AS url FROM product_images
+		UNION SELECT image_url FROM product_variants
+		UNION SELECT jsonb_path_query(snapshot, '$.images[*].url') #>> '{}' FROM product_revisions
+		UNION SELECT jsonb_path_query(snapshot, '$.variants[*].image_url') #>> '{}' FROM product_revisions
+	) urls`
+
+// unreferencedSQL matches images none of referencedSQL points at, joining on the image ID
+const unreferencedSQL = `NOT EXISTS (SELECT 1 FROM (` + referencedSQL + `) referenced WHERE referenced.id = media_images.id)`
+
+func (r *imageRepository) Create(ctx context.Context, image *Image) error {
+	return r.db.WithContext(ctx).Create(image).Error
+}
+
+func (r *imageRepository) GetByID(ctx context.Context, id string) (*Image, error) {
+	var image Image
+	err := r.db.WithContext(ctx).First(&image, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+func (r *imageRepository) ListUnreferenced(ctx context.Context, olderThan time.Time) ([]Image, error) {
+	var images []Image
+	err := r.db.WithContext(ctx).Where("created_at < ?", olderThan).Where(unreferencedSQL).Find(&images).Error
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func (r *imageRepository) DeleteIfUnreferenced(ctx context.Context, id string) (bool, error) {
+	res := r.db.WithContext(ctx).Where("id = ?", id).Where(unreferencedSQL).Delete(&Image{})
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,129 @@
+package media
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type ImageService interface {
+	Upload(ctx context.Context, fileName string, data []byte) (*ImageResponse, error)
+	Get(ctx context.Context, id string) (*ImageResponse, error)
+	// Open streams one rendition of an image
+	Open(ctx context.Context, id, rendition string) (io.ReadCloser, int64, *Image, error)
+	// CollectGarbage removes images no product references, sparing recent uploads
+	CollectGarbage(ctx context.Context) (int, error)
+}
+
+type ImageConfig struct {
+	BaseURL string
+	// GCGrace keeps fresh uploads alive until an admin has had time to attach them to a product
+	GCGrace time.Duration
+}
+
+type imageService struct {
+	repo    ImageRepository
+	storage Storage
+	config  *ImageConfig
+}
+
+func NewImageService(repo ImageRepository, storage Storage, config *ImageConfig) ImageService {
+	return &imageService{
+		repo:    repo,
+		storage: storage,
+		config:  config,
+	}
+}
+
+func (s *imageService) Upload(ctx context.Context, fileName string, data []byte) (*ImageResponse, error) {
+	contentType, err := sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	renditions, renditionType, width, height, err := renderAll(data)
+	if err != nil {
+		return nil, err
+	}
+
+	image := &Image{
+		ID:            uuid.New().String(),
+		FileName:      fileName,
+		ContentType:   contentType,
+		RenditionType: renditionType,
+		Width:         width,
+		Height:        height,
+		Size:          int64(len(data)),
+	}
+	renditions[RenditionOriginal] = data
+	for name, content := range renditions {
+		if err := s.storage.Put(ctx, image.key(name), content); err != nil {
+			_ = s.storage.Delete(ctx, image.ID)
+			return nil, err
+		}
+	}
+	if err := s.repo.Create(ctx, image); err != nil {
+		// Clean up files if database save fails
+		_ = s.storage.Delete(ctx, image.ID)
+		return nil, err
+	}
+	return s.response(image), nil
+}
+
+func (s *imageService) Get(ctx context.Context, id string) (*ImageResponse, error) {
+	image, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.response(image), nil
+}
+
+func (s *imageService) Open(ctx context.Context, id, rendition string) (io.ReadCloser, int64, *Image, error) {
+	if _, ok := renditionSizes[rendition]; !ok && rendition != RenditionOriginal {
+		return nil, 0, nil, ErrUnknownRendition
+	}
+	image, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	body, size, err := s.storage.Open(ctx, image.key(rendition))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return body, size, image, nil
+}
+
+func (s *imageService) CollectGarbage(ctx context.Context) (int, error) {
+	images, err := s.repo.ListUnreferenced(ctx, time.Now().Add(-s.config.GCGrace))
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, image := range images {
+		ok, err := s.repo.DeleteIfUnreferenced(ctx, image.ID)
+		if err != nil {
+			return deleted, err
+		}
+		if !ok {
+			continue
+		}
+		if err := s.storage.Delete(ctx, image.ID); err != nil {
+			logrus.Warnf("failed to delete files of image %s: %v", image.ID, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (s *imageService) response(image *Image) *ImageResponse {
+	base := strings.TrimSuffix(s.config.BaseURL, "/") + "/media/images/" + image.ID + "/"
+	return &ImageResponse{
+		Image:        *image,
+		URL:          base + RenditionOriginal,
+		MediumURL:    base + RenditionMedium,
+		ThumbnailURL: base + RenditionThumbnail,
+	}
+}
@@ -0,0 +1,125 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrObjectNotFound = errors.New("stored object not found")
+
+// Storage keeps image bytes under slash separated keys. Implementations must be safe for
+// concurrent use; LocalStorage is the only one so far.
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Create streams an object to key; it is stored once the writer is closed
+	Create(ctx context.Context, key string) (io.WriteCloser, error)
+	// Open returns the object and its size in bytes
+	Open(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	// Delete removes every object whose key starts with prefix
+	Delete(ctx context.Context, prefix string) error
+}
+
+// NewStorage builds the storage backend named in the configuration
+func NewStorage(backend, path string) (Storage, error) {
+	switch backend {
+	case "", "local":
+		return NewLocalStorage(path), nil
+	default:
+		return nil, fmt.Errorf("unknown image storage backend %q", backend)
+	}
+}
+
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{root: root}
+}
+
+// path maps a key inside root, refusing keys that would escape it
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	// Write then rename so readers never see a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to save image: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *LocalStorage) Create(ctx context.Context, key string) (io.WriteCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %v", err)
+	}
+	return &localWriter{File: f, path: path}, nil
+}
+
+// localWriter writes to a temporary file renamed into place on Close, so readers never see a partial file
+type localWriter struct {
+	*os.File
+	path string
+}
+
+func (w *localWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		return err
+	}
+	return os.Rename(w.File.Name(), w.path)
+}
+
+func (s *LocalStorage) Open(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// Delete treats prefix as a directory, which is how images lay out their renditions
+func (s *LocalStorage) Delete(ctx context.Context, prefix string) error {
+	path, err := s.path(prefix)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
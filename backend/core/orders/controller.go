@@ -2,14 +2,21 @@ package orders
 
 import (
     "context"
+    "crypto/sha256"
+    "encoding/hex"
     "encoding/json"
+    "errors"
     "ecommerce-backend/common/middleware"
+    "ecommerce-backend/core/carts"
     "ecommerce-backend/core/products"
+    "ecommerce-backend/core/promotions"
+    "ecommerce-backend/core/shipping"
     "ecommerce-backend/core/users"
     "github.com/gin-gonic/gin"
     "github.com/go-playground/validator/v10"
     "github.com/google/uuid"
     "github.com/sirupsen/logrus"
+    "gorm.io/gorm"
     "net/http"
     "strconv"
     "time"
@@ -21,12 +28,23 @@ type Controller struct {
     authMW      gin.HandlerFunc
     productRepo products.ProductRepository
     userRepo    users.UserRepository
+    // idempotencyKeys keeps the responses to order creations for idempotencyTTL; nil ignores Idempotency-Key
+    idempotencyKeys IdempotencyRepository
+    idempotencyTTL  time.Duration
 }
 
 func NewController(s OrderService, authMW gin.HandlerFunc, pr products.ProductRepository, ur users.UserRepository) *Controller {
     return &Controller{svc: s, validate: validator.New(), authMW: authMW, productRepo: pr, userRepo: ur}
 }
 
+// NewControllerWithIdempotency keeps order creation responses for ttl, a day when not set
+func NewControllerWithIdempotency(s OrderService, authMW gin.HandlerFunc, pr products.ProductRepository, ur users.UserRepository, keys IdempotencyRepository, ttl time.Duration) *Controller {
+    if ttl <= 0 {
+        ttl = 24 * time.Hour
+    }
+    return &Controller{svc: s, validate: validator.New(), authMW: authMW, productRepo: pr, userRepo: ur, idempotencyKeys: keys, idempotencyTTL: ttl}
+}
+
 type createOrderItem struct {
     ProductID string `json:"product_id" validate:"required"`
     VariantID string `json:"variant_id"`
@@ -36,25 +54,38 @@ type createOrderItem struct {
 }
 
 type createOrderRequest struct {
-    UserID        string            `json:"user_id"`
-    Items         []createOrderItem `json:"items" validate:"required,dive"`
-    Shipping      ShippingAddress   `json:"shipping"`
-    FrontendTotal int               `json:"total" validate:"gte=0"`
+    Items            []createOrderItem `json:"items" validate:"required,dive"`
+    Shipping         ShippingAddress   `json:"shipping"`
+    FrontendTotal    int               `json:"total" validate:"gte=0"`
+    Codes            []string          `json:"codes" validate:"max=5"` // coupon codes, applied in order
+    ShippingMethodID string            `json:"shipping_method_id"`     // from POST /shipping/quote; not needed when nothing ships
+}
+
+// previewOrderRequest is an order not placed yet. Tax is worked out for the shipping address, and
+// is 0 until it has a country; shipping is added once a method is chosen.
+type previewOrderRequest struct {
+    Items            []createOrderItem `json:"items" validate:"required,dive"`
+    Shipping         ShippingAddress   `json:"shipping"`
+    Codes            []string          `json:"codes" validate:"max=5"`
+    ShippingMethodID string            `json:"shipping_method_id"`
 }
 
 func (c *Controller) RegisterRoutes(r *gin.Engine) {
     g := r.Group("/orders")
     g.POST("", c.Create)
+    g.POST("preview", c.Preview)
     g.GET("", middleware.AdminKeyMiddleware(), c.List)
     g.GET(":id", middleware.AdminKeyMiddleware(), c.Get)
     g.POST(":id/status", middleware.AdminKeyMiddleware(), c.AppendStatus)
     g.GET(":id/status", middleware.AdminKeyMiddleware(), c.ListStatuses)
+    g.GET(":id/next-statuses", middleware.AdminKeyMiddleware(), c.NextStatuses)
 
     ug := r.Group("/user/orders")
     if c.authMW != nil {
         ug.Use(c.authMW)
     }
     ug.POST("", c.CreateForUser)
+    ug.POST("preview", c.PreviewMine)
     ug.GET("", c.ListMine)
     ug.GET(":id", c.GetMine)
     ug.GET(":id/status", c.ListStatusesMine)
@@ -76,23 +107,36 @@ func (c *Controller) Create(ctx *gin.Context) {
     for i, it := range req.Items {
         items[i] = OrderItem{ProductID: it.ProductID, VariantID: it.VariantID, VariantSKU: it.VariantSKU, Quantity: it.Quantity, Price: it.Price}
     }
-    id, backendTotal, err := c.svc.Create(context.Background(), req.UserID, items, req.Shipping, req.FrontendTotal)
-    if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
+    c.respondOnce(ctx, guestIdempotencyScope(ctx), req, func() (int, gin.H) {
+        // Guests cannot say who they are; orders of signed-in shoppers go through CreateForUser
+        o, err := c.svc.Create(ctx.Request.Context(), "", items, req.Shipping, req.ShippingMethodID, req.FrontendTotal, req.Codes)
+        if err != nil {
+            return createErrorStatus(err), gin.H{"error": err.Error()}
+        }
+        // log comparison for admin observability
+        m := map[string]any{"order_id": o.ID, "frontend_total": req.FrontendTotal, "backend_total": o.BackendTotal}
+        b, _ := json.Marshal(m)
+        logrus.WithField("type", "order_total_check").Info(string(b))
+        return http.StatusOK, createdResponse(o)
+    })
+}
+
+// guestIdempotencyScope keeps the Idempotency-Keys of guests apart by their cart token when they
+// send one.
+func guestIdempotencyScope(ctx *gin.Context) string {
+    if token := ctx.GetHeader(carts.CartTokenHeader); token != "" {
+        return "orders:cart:" + token
     }
-    // log comparison for admin observability
-    m := map[string]any{"order_id": id, "frontend_total": req.FrontendTotal, "backend_total": backendTotal}
-    b, _ := json.Marshal(m)
-    logrus.WithField("type", "order_total_check").Info(string(b))
-    ctx.JSON(http.StatusOK, gin.H{"id": id, "backend_total": backendTotal})
+    return "orders"
 }
 
 // User-scoped endpoints
 type createOrderRequestAuthed struct {
-    Items         []createOrderItem `json:"items" validate:"required,dive"`
-    Shipping      ShippingAddress   `json:"shipping"`
-    FrontendTotal int               `json:"total" validate:"gte=0"`
+    Items            []createOrderItem `json:"items" validate:"required,dive"`
+    Shipping         ShippingAddress   `json:"shipping"`
+    FrontendTotal    int               `json:"total" validate:"gte=0"`
+    Codes            []string          `json:"codes" validate:"max=5"`
+    ShippingMethodID string            `json:"shipping_method_id"`
 }
 
 func (c *Controller) CreateForUser(ctx *gin.Context) {
@@ -119,15 +163,87 @@ func (c *Controller) CreateForUser(ctx *gin.Context) {
     for i, it := range req.Items {
         items[i] = OrderItem{ProductID: it.ProductID, VariantID: it.VariantID, VariantSKU: it.VariantSKU, Quantity: it.Quantity, Price: it.Price}
     }
-    id, backendTotal, err := c.svc.Create(context.Background(), userUUID.String(), items, req.Shipping, req.FrontendTotal)
+    c.respondOnce(ctx, "user/orders:"+userUUID.String(), req, func() (int, gin.H) {
+        o, err := c.svc.Create(ctx.Request.Context(), userUUID.String(), items, req.Shipping, req.ShippingMethodID, req.FrontendTotal, req.Codes)
+        if err != nil {
+            return createErrorStatus(err), gin.H{"error": err.Error()}
+        }
+        m := map[string]any{"order_id": o.ID, "frontend_total": req.FrontendTotal, "backend_total": o.BackendTotal}
+        b, _ := json.Marshal(m)
+        logrus.WithField("type", "order_total_check").Info(string(b))
+        return http.StatusOK, createdResponse(o)
+    })
+}
+
+// createdResponse is the reply to a placed order
+func createdResponse(o *Order) gin.H {
+    return gin.H{"id": o.ID, "subtotal": o.Subtotal, "discount_total": o.DiscountTotal, "tax_total": o.TaxTotal, "tax_inclusive": o.TaxInclusive, "shipping_cost": o.ShippingCost, "backend_total": o.BackendTotal}
+}
+
+func (c *Controller) Preview(ctx *gin.Context) {
+    var req previewOrderRequest
+    if err := ctx.ShouldBindJSON(&req); err != nil {
+        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    // Guests cannot say who they are, so codes limited per user need the signed-in route
+    c.preview(ctx, "", req)
+}
+
+func (c *Controller) PreviewMine(ctx *gin.Context) {
+    userIDVal, ok := ctx.Get("user_id")
+    if !ok {
+        ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+        return
+    }
+    userUUID, ok := userIDVal.(uuid.UUID)
+    if !ok {
+        ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user"})
+        return
+    }
+    var req previewOrderRequest
+    if err := ctx.ShouldBindJSON(&req); err != nil {
+        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.preview(ctx, userUUID.String(), req)
+}
+
+// preview answers with the totals the order would have, coupon codes applied and tax added
+func (c *Controller) preview(ctx *gin.Context, userID string, req previewOrderRequest) {
+    if err := c.validate.Struct(req); err != nil {
+        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    items := make([]OrderItem, len(req.Items))
+    for i, it := range req.Items {
+        items[i] = OrderItem{ProductID: it.ProductID, VariantID: it.VariantID, VariantSKU: it.VariantSKU, Quantity: it.Quantity, Price: it.Price}
+    }
+    pricing, err := c.svc.Preview(context.Background(), userID, items, req.Shipping, req.ShippingMethodID, req.Codes)
     if err != nil {
-        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        ctx.JSON(createErrorStatus(err), gin.H{"error": err.Error()})
         return
     }
-    m := map[string]any{"order_id": id, "frontend_total": req.FrontendTotal, "backend_total": backendTotal}
-    b, _ := json.Marshal(m)
-    logrus.WithField("type", "order_total_check").Info(string(b))
-    ctx.JSON(http.StatusOK, gin.H{"id": id, "backend_total": backendTotal})
+    ctx.JSON(http.StatusOK, pricing)
+}
+
+// createErrorStatus maps order creation failures the shopper can act on to 409, and refused coupon codes,
+// shipping methods and guest digital items to 400
+func createErrorStatus(err error) int {
+    var codeErr *promotions.CodeError
+    if errors.As(err, &codeErr) {
+        return http.StatusBadRequest
+    }
+    if errors.Is(err, products.ErrInsufficientStock) {
+        return http.StatusConflict
+    }
+    if errors.Is(err, ErrVariantNotMatched) || errors.Is(err, ErrDigitalNeedsAccount) {
+        return http.StatusBadRequest
+    }
+    if errors.Is(err, shipping.ErrNoZone) || errors.Is(err, shipping.ErrMethodRequired) || errors.Is(err, shipping.ErrMethodUnavailable) {
+        return http.StatusBadRequest
+    }
+    return http.StatusInternalServerError
 }
 
 func (c *Controller) ListMine(ctx *gin.Context) {
@@ -209,7 +325,7 @@ func (c *Controller) CancelMine(ctx *gin.Context) {
     }
     id := ctx.Param("id")
     if err := c.svc.UserCancel(context.Background(), id, userUUID.String()); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        ctx.JSON(statusErrorStatus(err), gin.H{"error": err.Error()})
         return
     }
     ctx.JSON(http.StatusOK, gin.H{"cancelled": true})
@@ -228,7 +344,7 @@ func (c *Controller) RequestRefund(ctx *gin.Context) {
     }
     id := ctx.Param("id")
     if err := c.svc.RequestRefund(context.Background(), id, userUUID.String()); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        ctx.JSON(statusErrorStatus(err), gin.H{"error": err.Error()})
         return
     }
     ctx.JSON(http.StatusOK, gin.H{"requested": true})
@@ -250,16 +366,28 @@ func (c *Controller) Get(ctx *gin.Context) {
         ProductName string            `json:"product_name"`
         VariantPrice int              `json:"variant_price"`
         VariantAttrs map[string]string `json:"variant_attributes"`
+        Discount     int               `json:"discount"`
+        TaxClass     string            `json:"tax_class"`
+        Tax          int               `json:"tax"`
     }
     type adminDetail struct {
-        ID            string         `json:"id"`
-        UserID        string         `json:"user_id"`
-        BackendTotal  int            `json:"backend_total"`
-        FrontendTotal int            `json:"frontend_total"`
-        CurrentStatus string         `json:"current_status"`
-        CreatedAt     string         `json:"created_at"`
-        Items         []enrichedItem `json:"items"`
-        Shipping      any            `json:"shipping"`
+        ID               string         `json:"id"`
+        UserID           string         `json:"user_id"`
+        BackendTotal     int            `json:"backend_total"`
+        FrontendTotal    int            `json:"frontend_total"`
+        CurrentStatus    string         `json:"current_status"`
+        CreatedAt        string         `json:"created_at"`
+        Items            []enrichedItem `json:"items"`
+        Shipping         any            `json:"shipping"`
+        Subtotal         int            `json:"subtotal"`
+        DiscountTotal    int            `json:"discount_total"`
+        Discounts        any            `json:"discounts"`
+        TaxTotal         int            `json:"tax_total"`
+        TaxInclusive     bool           `json:"tax_inclusive"`
+        TaxLines         any            `json:"tax_lines"`
+        ShippingMethodID string         `json:"shipping_method_id"`
+        ShippingMethod   string         `json:"shipping_method"`
+        ShippingCost     int            `json:"shipping_cost"`
     }
     var items []OrderItem
     _ = json.Unmarshal(o.ItemsJSON, &items)
@@ -271,6 +399,9 @@ func (c *Controller) Get(ctx *gin.Context) {
             VariantSKU: it.VariantSKU,
             Quantity: it.Quantity,
             Price: it.Price,
+            Discount: it.Discount,
+            TaxClass: it.TaxClass,
+            Tax: it.Tax,
         }
         if p, err := c.productRepo.GetByID(context.Background(), it.ProductID); err == nil {
             ei.ProductName = p.Name
@@ -296,6 +427,10 @@ func (c *Controller) Get(ctx *gin.Context) {
     }
     var shipping any
     _ = json.Unmarshal(o.ShippingJSON, &shipping)
+    var discounts any
+    _ = json.Unmarshal(o.DiscountsJSON, &discounts)
+    var taxLines any
+    _ = json.Unmarshal(o.TaxLinesJSON, &taxLines)
     resp := adminDetail{
         ID: o.ID,
         UserID: o.UserID,
@@ -305,6 +440,15 @@ func (c *Controller) Get(ctx *gin.Context) {
         CreatedAt: o.CreatedAt.Format(time.RFC3339),
         Items: enriched,
         Shipping: shipping,
+        Subtotal: o.Subtotal,
+        DiscountTotal: o.DiscountTotal,
+        Discounts: discounts,
+        TaxTotal: o.TaxTotal,
+        TaxInclusive: o.TaxInclusive,
+        TaxLines: taxLines,
+        ShippingMethodID: o.ShippingMethodID,
+        ShippingMethod: o.ShippingMethod,
+        ShippingCost: o.ShippingCost,
     }
     ctx.JSON(http.StatusOK, resp)
 }
@@ -366,7 +510,7 @@ func (c *Controller) AppendStatus(ctx *gin.Context) {
         return
     }
     if err := c.svc.AppendStatus(context.Background(), id, req.Status, req.Reason); err != nil {
-        ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        ctx.JSON(statusErrorStatus(err), gin.H{"error": err.Error()})
         return
     }
     ctx.JSON(http.StatusOK, gin.H{"updated": true})
@@ -382,6 +526,92 @@ func (c *Controller) ListStatuses(ctx *gin.Context) {
     ctx.JSON(http.StatusOK, list)
 }
 
+// NextStatuses lists the statuses the order may move to, for the admin UI to offer
+func (c *Controller) NextStatuses(ctx *gin.Context) {
+    current, next, err := c.svc.NextStatuses(context.Background(), ctx.Param("id"))
+    if err != nil {
+        ctx.JSON(statusErrorStatus(err), gin.H{"error": err.Error()})
+        return
+    }
+    ctx.JSON(http.StatusOK, gin.H{"current_status": current, "next_statuses": next})
+}
+
+// statusErrorStatus maps a rejected status change to 409 and a missing order to 404
+func statusErrorStatus(err error) int {
+    switch {
+    case errors.Is(err, ErrInvalidTransition):
+        return http.StatusConflict
+    case errors.Is(err, gorm.ErrRecordNotFound):
+        return http.StatusNotFound
+    default:
+        return http.StatusBadRequest
+    }
+}
+
 func (c *Controller) Name() string { return "orders" }
 
+// requestFingerprint hashes the decoded request, so retries match however the JSON is laid out
+func requestFingerprint(req any) (string, error) {
+    b, err := json.Marshal(req)
+    if err != nil {
+        return "", err
+    }
+    sum := sha256.Sum256(b)
+    return hex.EncodeToString(sum[:]), nil
+}
 
+// respondOnce answers with create unless the request carries an Idempotency-Key seen before in scope:
+// the same request then gets the stored response, a different one a conflict. Only successful
+// responses are stored; after a failure the key is released so the shopper can retry with it.
+func (c *Controller) respondOnce(ctx *gin.Context, scope string, req any, create func() (int, gin.H)) {
+    key := ctx.GetHeader(IdempotencyKeyHeader)
+    if key == "" || c.idempotencyKeys == nil {
+        status, body := create()
+        ctx.JSON(status, body)
+        return
+    }
+    if len(key) > maxIdempotencyKeyLength {
+        ctx.JSON(http.StatusBadRequest, gin.H{"error": ErrIdempotencyKeyTooLong.Error()})
+        return
+    }
+    fingerprint, err := requestFingerprint(req)
+    if err != nil {
+        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    now := time.Now()
+    claim := &IdempotencyKey{Key: key, Scope: scope, Fingerprint: fingerprint, CreatedAt: now, ExpiresAt: now.Add(c.idempotencyTTL)}
+    existing, err := c.idempotencyKeys.Claim(ctx.Request.Context(), claim)
+    if err != nil {
+        ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if existing != nil {
+        switch {
+        case existing.Fingerprint != claim.Fingerprint:
+            ctx.JSON(http.StatusConflict, gin.H{"error": ErrIdempotencyKeyReused.Error()})
+        case existing.StatusCode == 0:
+            ctx.JSON(http.StatusConflict, gin.H{"error": ErrIdempotencyKeyInUse.Error()})
+        default:
+            ctx.Header(IdempotentReplayedHeader, "true")
+            ctx.Data(existing.StatusCode, "application/json; charset=utf-8", existing.ResponseBody)
+        }
+        return
+    }
+
+    status, body := create()
+    stored, err := json.Marshal(body)
+    switch {
+    case err != nil:
+        // A response that cannot be stored cannot be replayed either, so the key is freed
+        err = errors.Join(err, c.idempotencyKeys.Release(ctx.Request.Context(), key, scope))
+    case status >= 200 && status < 300:
+        err = c.idempotencyKeys.Complete(ctx.Request.Context(), key, scope, status, stored)
+    default:
+        err = c.idempotencyKeys.Release(ctx.Request.Context(), key, scope)
+    }
+    if err != nil {
+        logrus.Errorf("Failed to update idempotency key for %s: %v", scope, err)
+    }
+    ctx.JSON(status, body)
+}
@@ -0,0 +1,238 @@
+package orders
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+
+    "ecommerce-backend/core/carts"
+
+    "github.com/gin-gonic/gin"
+)
+
+// memoryIdempotencyKeys keeps idempotency keys in a map, like the table does
+type memoryIdempotencyKeys struct {
+    keys map[string]*IdempotencyKey
+}
+
+func newMemoryIdempotencyKeys() *memoryIdempotencyKeys {
+    return &memoryIdempotencyKeys{keys: make(map[string]*IdempotencyKey)}
+}
+
+func (m *memoryIdempotencyKeys) Claim(_ context.Context, key *IdempotencyKey) (*IdempotencyKey, error) {
+    if existing, ok := m.keys[key.Scope+"/"+key.Key]; ok {
+        return existing, nil
+    }
+    stored := *key
+    m.keys[key.Scope+"/"+key.Key] = &stored
+    return nil, nil
+}
+
+func (m *memoryIdempotencyKeys) Complete(_ context.Context, key, scope string, status int, body []byte) error {
+    k := m.keys[scope+"/"+key]
+    k.StatusCode = status
+    k.ResponseBody = body
+    return nil
+}
+
+func (m *memoryIdempotencyKeys) Release(_ context.Context, key, scope string) error {
+    delete(m.keys, scope+"/"+key)
+    return nil
+}
+
+func (m *memoryIdempotencyKeys) DeleteExpired(context.Context, time.Time) (int64, error) {
+    return 0, nil
+}
+
+type onceRequest struct {
+    ProductID string `json:"product_id"`
+    Quantity  int    `json:"quantity"`
+}
+
+// respondOnceWith runs respondOnce for req sent with key, counting the calls to create
+func respondOnceWith(c *Controller, key string, req onceRequest, status int, calls *int) *httptest.ResponseRecorder {
+    w := httptest.NewRecorder()
+    ctx, _ := gin.CreateTestContext(w)
+    ctx.Request = httptest.NewRequest(http.MethodPost, "/orders", nil)
+    if key != "" {
+        ctx.Request.Header.Set(IdempotencyKeyHeader, key)
+    }
+    c.respondOnce(ctx, "user-1", req, func() (int, gin.H) {
+        *calls++
+        if status >= 300 {
+            return status, gin.H{"error": "out of stock"}
+        }
+        return status, gin.H{"order_id": "order-" + strconv.Itoa(*calls)}
+    })
+    return w
+}
+
+func TestRespondOnce(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    req := onceRequest{ProductID: "a", Quantity: 1}
+
+    t.Run("requests without a key always create", func(t *testing.T) {
+        c := NewControllerWithIdempotency(nil, nil, nil, nil, newMemoryIdempotencyKeys(), time.Hour)
+        calls := 0
+        respondOnceWith(c, "", req, http.StatusCreated, &calls)
+        respondOnceWith(c, "", req, http.StatusCreated, &calls)
+        if calls != 2 {
+            t.Fatalf("create called %d times, want 2", calls)
+        }
+    })
+
+    t.Run("a retry replays the stored response", func(t *testing.T) {
+        keys := newMemoryIdempotencyKeys()
+        c := NewControllerWithIdempotency(nil, nil, nil, nil, keys, time.Hour)
+        calls := 0
+        first := respondOnceWith(c, "k1", req, http.StatusCreated, &calls)
+        retry := respondOnceWith(c, "k1", req, http.StatusCreated, &calls)
+        if calls != 1 {
+            t.Fatalf("create called %d times, want 1", calls)
+        }
+        if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+            t.Errorf("retry = %d %s, want %d %s", retry.Code, retry.Body, first.Code, first.Body)
+        }
+        if first.Header().Get(IdempotentReplayedHeader) != "" || retry.Header().Get(IdempotentReplayedHeader) != "true" {
+            t.Errorf("%s header = %q then %q, want none then true", IdempotentReplayedHeader,
+                first.Header().Get(IdempotentReplayedHeader), retry.Header().Get(IdempotentReplayedHeader))
+        }
+        stored := keys.keys["user-1/k1"]
+        if stored == nil || stored.StatusCode != http.StatusCreated || stored.ExpiresAt.Sub(stored.CreatedAt) != time.Hour {
+            t.Errorf("stored key = %+v, want it completed with a 1h expiry", stored)
+        }
+    })
+
+    t.Run("keys are scoped", func(t *testing.T) {
+        keys := newMemoryIdempotencyKeys()
+        c := NewControllerWithIdempotency(nil, nil, nil, nil, keys, time.Hour)
+        calls := 0
+        respondOnceWith(c, "k1", req, http.StatusCreated, &calls)
+        w := httptest.NewRecorder()
+        ctx, _ := gin.CreateTestContext(w)
+        ctx.Request = httptest.NewRequest(http.MethodPost, "/orders", nil)
+        ctx.Request.Header.Set(IdempotencyKeyHeader, "k1")
+        c.respondOnce(ctx, "user-2", req, func() (int, gin.H) {
+            calls++
+            return http.StatusCreated, gin.H{}
+        })
+        if calls != 2 {
+            t.Fatalf("create called %d times, want 2", calls)
+        }
+    })
+
+    tests := []struct {
+        name    string
+        key     string
+        claimed *IdempotencyKey // already in the repository under user-1/k1
+        status  int             // returned by create
+        want    int
+        wantErr error
+        calls   int
+        kept    bool // whether the key is still held afterwards
+    }{
+        {
+            name:    "a different request with the same key conflicts",
+            key:     "k1",
+            claimed: &IdempotencyKey{Key: "k1", Scope: "user-1", Fingerprint: "other", StatusCode: http.StatusCreated},
+            status:  http.StatusCreated,
+            want:    http.StatusConflict,
+            wantErr: ErrIdempotencyKeyReused,
+            kept:    true,
+        },
+        {
+            name:    "a request still in progress conflicts",
+            key:     "k1",
+            claimed: &IdempotencyKey{Key: "k1", Scope: "user-1"},
+            status:  http.StatusCreated,
+            want:    http.StatusConflict,
+            wantErr: ErrIdempotencyKeyInUse,
+            kept:    true,
+        },
+        {
+            name:   "a failed request frees its key",
+            key:    "k1",
+            status: http.StatusBadRequest,
+            want:   http.StatusBadRequest,
+            calls:  1,
+        },
+        {
+            name:    "keys past the length limit are refused",
+            key:     strings.Repeat("k", maxIdempotencyKeyLength+1),
+            status:  http.StatusCreated,
+            want:    http.StatusBadRequest,
+            wantErr: ErrIdempotencyKeyTooLong,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            keys := newMemoryIdempotencyKeys()
+            if tt.claimed != nil {
+                if tt.claimed.Fingerprint == "" {
+                    tt.claimed.Fingerprint, _ = requestFingerprint(req)
+                }
+                keys.keys["user-1/k1"] = tt.claimed
+            }
+            c := NewControllerWithIdempotency(nil, nil, nil, nil, keys, time.Hour)
+            calls := 0
+            w := respondOnceWith(c, tt.key, req, tt.status, &calls)
+            if w.Code != tt.want {
+                t.Errorf("status = %d, want %d", w.Code, tt.want)
+            }
+            if tt.wantErr != nil {
+                var body struct {
+                    Error string `json:"error"`
+                }
+                if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error != tt.wantErr.Error() {
+                    t.Errorf("body = %s, want error %q", w.Body, tt.wantErr)
+                }
+            }
+            if calls != tt.calls {
+                t.Errorf("create called %d times, want %d", calls, tt.calls)
+            }
+            if _, kept := keys.keys["user-1/k1"]; kept != tt.kept {
+                t.Errorf("key held = %v, want %v", kept, tt.kept)
+            }
+        })
+    }
+}
+
+func TestRequestFingerprint(t *testing.T) {
+    a, err := requestFingerprint(onceRequest{ProductID: "a", Quantity: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    same, _ := requestFingerprint(onceRequest{ProductID: "a", Quantity: 1})
+    other, _ := requestFingerprint(onceRequest{ProductID: "a", Quantity: 2})
+    if a != same {
+        t.Errorf("equal requests fingerprint as %s and %s", a, same)
+    }
+    if a == other {
+        t.Errorf("different requests share the fingerprint %s", a)
+    }
+    if _, err := requestFingerprint(func() {}); err == nil {
+        t.Error("requestFingerprint of a func = nil error, want one")
+    }
+}
+
+func TestGuestIdempotencyScope(t *testing.T) {
+    scope := func(token string) string {
+        ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+        ctx.Request = httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"user_id": "someone-else"}`))
+        if token != "" {
+            ctx.Request.Header.Set(carts.CartTokenHeader, token)
+        }
+        return guestIdempotencyScope(ctx)
+    }
+    if got := scope(""); got != "orders" {
+        t.Errorf("scope without a cart token = %q, want orders", got)
+    }
+    if a, b := scope("cart-a"), scope("cart-b"); a == b || a == scope("") {
+        t.Errorf("scopes of two carts = %q and %q, want them apart and apart from guests without one", a, b)
+    }
+}
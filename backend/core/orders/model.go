@@ -2,7 +2,12 @@ package orders
 
 import (
     "encoding/json"
+    "errors"
+    "fmt"
     "ecommerce-backend/common/constants"
+    "ecommerce-backend/core/products"
+    "ecommerce-backend/core/promotions"
+    "ecommerce-backend/core/tax"
     "github.com/google/uuid"
     "gorm.io/datatypes"
     "gorm.io/gorm"
@@ -15,6 +20,23 @@ type OrderItem struct {
     VariantSKU string `json:"variant_sku"`
     Quantity  int    `json:"quantity"`
     Price     int    `json:"price"` // price per unit from frontend for audit
+    UnitPrice    int `json:"unit_price"`    // price per unit charged, sale applied, set by the backend
+    RegularPrice int `json:"regular_price"` // price per unit without the sale, set by the backend
+    Components []OrderItemComponent `json:"components,omitempty"` // bundle composition at order time, set by the backend
+    Digital    bool                 `json:"digital,omitempty"`    // delivered as downloads, set by the backend
+    Discount   int                  `json:"discount,omitempty"`   // taken off the line by coupon codes, set by the backend
+    TaxClass   string               `json:"tax_class,omitempty"`  // of the product at order time, set by the backend
+    Tax        int                  `json:"tax,omitempty"`        // charged on the line after its discount, set by the backend
+}
+
+// OrderItemComponent is one component of a bundle line as it was sold
+type OrderItemComponent struct {
+    ProductID  string `json:"product_id"`
+    VariantID  string `json:"variant_id"`
+    VariantSKU string `json:"variant_sku"`
+    Name       string `json:"name"`
+    Quantity   int    `json:"quantity"`   // per bundle
+    UnitPrice  int    `json:"unit_price"` // price of the component on its own at order time
 }
 
 type ShippingAddress struct {
@@ -36,7 +58,20 @@ type Order struct {
     FrontendTotal  int            `json:"frontend_total"`  // provided by client for audit
     BackendTotal   int            `json:"backend_total"`   // computed from products table
     CurrentStatus  string         `json:"current_status"`
+    StockState     string         `gorm:"index" json:"stock_state"` // where the order's items sit in the stock ledger
     CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
+    // Subtotal is the lines before discounts; BackendTotal is what remains after DiscountTotal, with tax and shipping
+    Subtotal       int            `json:"subtotal"`
+    DiscountTotal  int            `json:"discount_total"`
+    DiscountsJSON  datatypes.JSON `json:"discounts_json"` // coupon codes applied, with the amount taken off each line
+    // TaxTotal comes on top of what remains after discounts, or is already part of it when TaxInclusive
+    TaxTotal       int            `json:"tax_total"`
+    TaxInclusive   bool           `json:"tax_inclusive"`
+    TaxLinesJSON   datatypes.JSON `json:"tax_lines_json"` // tax charged per rate
+    // ShippingCost is what the chosen method charged, 0 when a coupon code made shipping free
+    ShippingMethodID string `json:"shipping_method_id"`
+    ShippingMethod   string `json:"shipping_method"`
+    ShippingCost     int    `json:"shipping_cost"`
 }
 
 func (o *Order) BeforeCreate(tx *gorm.DB) (err error) {
@@ -56,6 +91,114 @@ func (o *Order) SetShipping(addr ShippingAddress) {
     o.ShippingJSON = b
 }
 
+func (o *Order) SetDiscounts(applied []promotions.AppliedPromotion) {
+    b, _ := json.Marshal(applied)
+    o.DiscountsJSON = b
+}
+
+func (o *Order) SetTaxLines(lines []tax.TaxLine) {
+    b, _ := json.Marshal(lines)
+    o.TaxLinesJSON = b
+}
+
+// StockLines aggregates the order items per product/variant for the stock ledger
+func (o *Order) StockLines() []products.StockLine {
+    var items []OrderItem
+    _ = json.Unmarshal(o.ItemsJSON, &items)
+    return stockLines(items)
+}
+
+func stockLines(items []OrderItem) []products.StockLine {
+    index := make(map[string]int)
+    lines := make([]products.StockLine, 0, len(items))
+    add := func(productID, variantID string, quantity int) {
+        key := productID + "/" + variantID
+        if i, ok := index[key]; ok {
+            lines[i].Quantity += quantity
+            return
+        }
+        index[key] = len(lines)
+        lines = append(lines, products.StockLine{ProductID: productID, VariantID: variantID, Quantity: quantity})
+    }
+    for _, it := range items {
+        // Digital products are sold as downloads and keep no stock
+        if it.Digital {
+            continue
+        }
+        // Bundles hold no stock; their components are reserved instead
+        if len(it.Components) > 0 {
+            for _, c := range it.Components {
+                add(c.ProductID, c.VariantID, c.Quantity*it.Quantity)
+            }
+            continue
+        }
+        add(it.ProductID, it.VariantID, it.Quantity)
+    }
+    return lines
+}
+
+// bundleComponents snapshots the composition of a bundle as sold at now
+func bundleComponents(p *products.Product, now time.Time) ([]OrderItemComponent, error) {
+    components := make([]OrderItemComponent, 0, len(p.Components))
+    for i := range p.Components {
+        c := &p.Components[i]
+        if !c.Sellable() {
+            return nil, fmt.Errorf("%w: a component of %s is no longer sold", products.ErrInsufficientStock, p.Name)
+        }
+        component := OrderItemComponent{ProductID: c.ProductID, VariantID: c.VariantID, Name: c.Product.Name, Quantity: c.Quantity, UnitPrice: c.PriceAt(now)}
+        if v := c.Variant(); v != nil {
+            component.VariantSKU = v.SKU
+        }
+        components = append(components, component)
+    }
+    return components, nil
+}
+
+// Stock states of an order. Orders created before stock tracking have an empty state and are never moved.
+const (
+    StockStateReserved  = "reserved"  // held against on hand, still available to release
+    StockStateCommitted = "committed" // goods left the warehouse, on hand already reduced
+    StockStateReleased  = "released"  // reservation dropped or returned goods put back on hand
+)
+
+// Statuses after which the goods have physically left the warehouse
+var stockCommitStatuses = map[string]struct{}{
+    constants.ORDER_STATUS_SELLER_DISPATCHED:      {},
+    constants.ORDER_STATUS_AGENT_PICKED:           {},
+    constants.ORDER_STATUS_AGENT_TRANSPORTING:     {},
+    constants.ORDER_STATUS_AGENT_OUT_FOR_DELIVERY: {},
+    constants.ORDER_STATUS_ORDER_DELIVERED:        {},
+}
+
+// Statuses that end the sale; reserved stock is released and committed stock is restocked
+var stockReleaseStatuses = map[string]struct{}{
+    constants.ORDER_STATUS_CANCELED:                  {},
+    constants.ORDER_STATUS_REJECTED:                  {},
+    constants.ORDER_STATUS_REJECTED_BY_USER:          {},
+    constants.ORDER_STATUS_USER_CANCELLED:            {},
+    constants.ORDER_STATUS_USER_CANCELLED_ON_ARRIVAL: {},
+    constants.ORDER_STATUS_USER_RETURNED:             {},
+    constants.ORDER_STATUS_USER_RETURN_RECEIVED:      {},
+}
+
+// Statuses that hand out the downloads of digital items: payment confirmed or the order delivered
+var downloadGrantStatuses = map[string]struct{}{
+    constants.ORDER_STATUS_PAID:            {},
+    constants.ORDER_STATUS_ORDER_DELIVERED: {},
+}
+
+// Statuses that take the downloads back: the sale ended or the money was returned
+var downloadRevokeStatuses = map[string]struct{}{
+    constants.ORDER_STATUS_CANCELED:                  {},
+    constants.ORDER_STATUS_REJECTED:                  {},
+    constants.ORDER_STATUS_REJECTED_BY_USER:          {},
+    constants.ORDER_STATUS_USER_CANCELLED:            {},
+    constants.ORDER_STATUS_USER_CANCELLED_ON_ARRIVAL: {},
+    constants.ORDER_STATUS_USER_RETURNED:             {},
+    constants.ORDER_STATUS_USER_RETURN_RECEIVED:      {},
+    constants.ORDER_STATUS_USER_REFUND_PROCESSED:     {},
+}
+
 type OrderStatusEvent struct {
     ID        uint      `gorm:"primaryKey" json:"id"`
     OrderID   string    `gorm:"index" json:"order_id"`
@@ -70,6 +213,7 @@ var AllowedStatuses = map[string]struct{}{
     constants.ORDER_STATUS_CANCELED:                 {},
     constants.ORDER_STATUS_REJECTED:                 {},
     constants.ORDER_STATUS_REJECTED_BY_USER:         {},
+    constants.ORDER_STATUS_PAID:                     {},
     constants.ORDER_STATUS_SELLER_NOTIFIED:          {},
     constants.ORDER_STATUS_SELLER_PROCESSING:        {},
     constants.ORDER_STATUS_SELLER_WAITING_DISPATCH:  {},
@@ -88,4 +232,186 @@ var AllowedStatuses = map[string]struct{}{
     constants.ORDER_STATUS_USER_REFUND_PROCESSED:     {},
 }
 
+// StatusTransitions is the order lifecycle: the statuses an order may move to from each status.
+// Statuses without an entry end the order.
+var StatusTransitions = map[string][]string{
+    constants.ORDER_STATUS_PENDING: {
+        constants.ORDER_STATUS_PAID,
+        constants.ORDER_STATUS_SELLER_NOTIFIED,
+        constants.ORDER_STATUS_CANCELED,
+        constants.ORDER_STATUS_REJECTED,
+        constants.ORDER_STATUS_USER_CANCELLED,
+    },
+    constants.ORDER_STATUS_PAID: {
+        constants.ORDER_STATUS_SELLER_NOTIFIED,
+        constants.ORDER_STATUS_CANCELED,
+        constants.ORDER_STATUS_REJECTED,
+        constants.ORDER_STATUS_USER_CANCELLED,
+    },
+    constants.ORDER_STATUS_SELLER_NOTIFIED: {
+        constants.ORDER_STATUS_SELLER_PROCESSING,
+        constants.ORDER_STATUS_CANCELED,
+        constants.ORDER_STATUS_REJECTED,
+        constants.ORDER_STATUS_USER_CANCELLED,
+    },
+    constants.ORDER_STATUS_SELLER_PROCESSING: {
+        constants.ORDER_STATUS_SELLER_WAITING_DISPATCH,
+        constants.ORDER_STATUS_SELLER_DISPATCHED,
+        constants.ORDER_STATUS_CANCELED,
+        constants.ORDER_STATUS_REJECTED,
+        constants.ORDER_STATUS_USER_CANCELLED,
+    },
+    constants.ORDER_STATUS_SELLER_WAITING_DISPATCH: {
+        constants.ORDER_STATUS_SELLER_DISPATCHED,
+        constants.ORDER_STATUS_CANCELED,
+        constants.ORDER_STATUS_USER_CANCELLED,
+    },
+    constants.ORDER_STATUS_SELLER_DISPATCHED: {
+        constants.ORDER_STATUS_AGENT_PICKED,
+        constants.ORDER_STATUS_USER_CANCELLED,
+    },
+    constants.ORDER_STATUS_AGENT_PICKED: {
+        constants.ORDER_STATUS_AGENT_TRANSPORTING,
+        constants.ORDER_STATUS_AGENT_OUT_FOR_DELIVERY,
+        constants.ORDER_STATUS_USER_CANCELLED,
+    },
+    constants.ORDER_STATUS_AGENT_TRANSPORTING: {
+        constants.ORDER_STATUS_AGENT_OUT_FOR_DELIVERY,
+        constants.ORDER_STATUS_USER_CANCELLED,
+    },
+    constants.ORDER_STATUS_AGENT_OUT_FOR_DELIVERY: {
+        constants.ORDER_STATUS_ORDER_DELIVERED,
+        constants.ORDER_STATUS_USER_CANCELLED_ON_ARRIVAL,
+        constants.ORDER_STATUS_REJECTED_BY_USER,
+    },
+    constants.ORDER_STATUS_ORDER_DELIVERED: {
+        constants.ORDER_STATUS_USER_RETURNING,
+        constants.ORDER_STATUS_USER_RETURNED,
+    },
+    constants.ORDER_STATUS_USER_RETURNING: {
+        constants.ORDER_STATUS_USER_RETURNED,
+        constants.ORDER_STATUS_USER_RETURN_RECEIVED,
+    },
+    constants.ORDER_STATUS_USER_RETURNED: {
+        constants.ORDER_STATUS_USER_RETURN_RECEIVED,
+    },
+    constants.ORDER_STATUS_USER_RETURN_RECEIVED: {
+        constants.ORDER_STATUS_USER_REFUND_INITIATED,
+    },
+    constants.ORDER_STATUS_USER_REFUND_INITIATED: {
+        constants.ORDER_STATUS_USER_REFUND_PROCESSED,
+        constants.ORDER_STATUS_USER_REFUND_FAILED,
+    },
+    constants.ORDER_STATUS_USER_REFUND_FAILED: {
+        constants.ORDER_STATUS_USER_REFUND_INITIATED,
+    },
+}
+
+var ErrInvalidTransition = errors.New("invalid status transition")
 
+// ErrVariantNotMatched rejects an item of a product sold as variants that none of them matches
+var ErrVariantNotMatched = errors.New("choose one of the product's variants")
+
+// ErrDigitalNeedsAccount rejects digital items in guest checkout: their downloads are only handed out
+// to the account that placed the order
+var ErrDigitalNeedsAccount = errors.New("sign in to buy digital products")
+
+// TransitionError rejects a status change that StatusTransitions does not allow.
+// It matches ErrInvalidTransition with errors.Is.
+type TransitionError struct {
+    From string
+    To   string
+}
+
+func (e *TransitionError) Error() string {
+    return fmt.Sprintf("cannot move order from %s to %s", e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+    return ErrInvalidTransition
+}
+
+// NextStatuses lists the statuses an order in status may move to, in lifecycle order.
+// Orders from before statuses were tracked have none and count as pending.
+func NextStatuses(status string) []string {
+    if status == "" {
+        status = constants.ORDER_STATUS_PENDING
+    }
+    next := StatusTransitions[status]
+    if next == nil {
+        return []string{}
+    }
+    return append([]string(nil), next...)
+}
+
+// CheckTransition returns a *TransitionError unless an order may move from -> to
+func CheckTransition(from, to string) error {
+    for _, next := range NextStatuses(from) {
+        if next == to {
+            return nil
+        }
+    }
+    return &TransitionError{From: from, To: to}
+}
+
+// IsDigital reports whether every item of the order is delivered as downloads
+func (o *Order) IsDigital() bool {
+    var items []OrderItem
+    _ = json.Unmarshal(o.ItemsJSON, &items)
+    for _, it := range items {
+        if !it.Digital {
+            return false
+        }
+    }
+    return len(items) > 0
+}
+
+// NextStatuses lists the statuses the order may move to. Digital orders have nothing to ship,
+// so once paid they may also go straight to delivered.
+func (o *Order) NextStatuses() []string {
+    next := NextStatuses(o.CurrentStatus)
+    if o.CurrentStatus == constants.ORDER_STATUS_PAID && o.IsDigital() {
+        next = append(next[:1], append([]string{constants.ORDER_STATUS_ORDER_DELIVERED}, next[1:]...)...)
+    }
+    return next
+}
+
+// CheckTransition returns a *TransitionError unless the order may move to status
+func (o *Order) CheckTransition(status string) error {
+    for _, next := range o.NextStatuses() {
+        if next == status {
+            return nil
+        }
+    }
+    return &TransitionError{From: o.CurrentStatus, To: status}
+}
+
+const (
+    IdempotencyKeyHeader     = "Idempotency-Key"
+    IdempotentReplayedHeader = "Idempotent-Replayed"
+    maxIdempotencyKeyLength  = 255
+    // A request holding a key for longer than this is taken to have died, and its key is free again
+    idempotencyLockTimeout = time.Minute
+)
+
+var (
+    ErrIdempotencyKeyReused  = errors.New("idempotency key was already used for a different request")
+    ErrIdempotencyKeyInUse   = errors.New("a request with this idempotency key is still in progress")
+    ErrIdempotencyKeyTooLong = errors.New("idempotency key is too long")
+)
+
+// IdempotencyKey remembers an order creation sent with an Idempotency-Key header, so retries of
+// the same request get the original response back instead of creating another order.
+type IdempotencyKey struct {
+    Key          string         `gorm:"primaryKey"`
+    Scope        string         `gorm:"primaryKey"`         // endpoint and user the key was sent with
+    Fingerprint  string         `gorm:"not null"`           // hash of the request body
+    StatusCode   int            `gorm:"not null;default:0"` // 0 while the request is in progress
+    ResponseBody datatypes.JSON
+    CreatedAt    time.Time      `gorm:"not null"`
+    ExpiresAt    time.Time      `gorm:"index;not null"`
+}
+
+func (IdempotencyKey) TableName() string {
+    return "order_idempotency_keys"
+}
@@ -0,0 +1,184 @@
+package orders
+
+import (
+    "encoding/json"
+    "errors"
+    "reflect"
+    "testing"
+
+    "ecommerce-backend/common/constants"
+    "ecommerce-backend/core/products"
+)
+
+func testOrder(t *testing.T, status string, items ...OrderItem) *Order {
+    t.Helper()
+    b, err := json.Marshal(items)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &Order{CurrentStatus: status, ItemsJSON: b}
+}
+
+func TestCheckTransition(t *testing.T) {
+    tests := []struct {
+        name    string
+        from    string
+        to      string
+        allowed bool
+    }{
+        {"pending may be paid", constants.ORDER_STATUS_PENDING, constants.ORDER_STATUS_PAID, true},
+        {"no status is pending", "", constants.ORDER_STATUS_PAID, true},
+        {"paid notifies the seller", constants.ORDER_STATUS_PAID, constants.ORDER_STATUS_SELLER_NOTIFIED, true},
+        {"paid may be cancelled", constants.ORDER_STATUS_PAID, constants.ORDER_STATUS_USER_CANCELLED, true},
+        {"paid is not delivered without shipping", constants.ORDER_STATUS_PAID, constants.ORDER_STATUS_ORDER_DELIVERED, false},
+        {"pending cannot skip to dispatched", constants.ORDER_STATUS_PENDING, constants.ORDER_STATUS_SELLER_DISPATCHED, false},
+        {"delivered may be returned", constants.ORDER_STATUS_ORDER_DELIVERED, constants.ORDER_STATUS_USER_RETURNING, true},
+        {"delivered cannot be cancelled", constants.ORDER_STATUS_ORDER_DELIVERED, constants.ORDER_STATUS_CANCELED, false},
+        {"cancelled ends the order", constants.ORDER_STATUS_CANCELED, constants.ORDER_STATUS_PENDING, false},
+        {"unknown statuses go nowhere", "LOST", constants.ORDER_STATUS_PAID, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := CheckTransition(tt.from, tt.to)
+            if tt.allowed {
+                if err != nil {
+                    t.Fatalf("CheckTransition = %v, want nil", err)
+                }
+                return
+            }
+            var terr *TransitionError
+            if !errors.As(err, &terr) || terr.From != tt.from || terr.To != tt.to {
+                t.Fatalf("CheckTransition = %v, want a *TransitionError from %q to %q", err, tt.from, tt.to)
+            }
+            if !errors.Is(err, ErrInvalidTransition) {
+                t.Errorf("CheckTransition = %v, want it to wrap ErrInvalidTransition", err)
+            }
+        })
+    }
+}
+
+// NextStatuses hands out a copy, so callers cannot change the lifecycle
+func TestNextStatusesCopies(t *testing.T) {
+    next := NextStatuses(constants.ORDER_STATUS_PAID)
+    next[0] = constants.ORDER_STATUS_ORDER_DELIVERED
+    if got := StatusTransitions[constants.ORDER_STATUS_PAID][0]; got != constants.ORDER_STATUS_SELLER_NOTIFIED {
+        t.Fatalf("StatusTransitions changed to %q", got)
+    }
+    if got := NextStatuses(constants.ORDER_STATUS_CANCELED); got == nil || len(got) != 0 {
+        t.Errorf("NextStatuses of a final status = %#v, want empty", got)
+    }
+}
+
+func TestOrderNextStatuses(t *testing.T) {
+    physical := OrderItem{ProductID: "book", Quantity: 1}
+    ebook := OrderItem{ProductID: "ebook", Quantity: 1, Digital: true}
+    tests := []struct {
+        name   string
+        status string
+        items  []OrderItem
+        want   []string
+    }{
+        {
+            name:   "a paid digital order may be delivered",
+            status: constants.ORDER_STATUS_PAID,
+            items:  []OrderItem{ebook},
+            want: []string{
+                constants.ORDER_STATUS_SELLER_NOTIFIED,
+                constants.ORDER_STATUS_ORDER_DELIVERED,
+                constants.ORDER_STATUS_CANCELED,
+                constants.ORDER_STATUS_REJECTED,
+                constants.ORDER_STATUS_USER_CANCELLED,
+            },
+        },
+        {
+            name:   "a paid physical order is shipped first",
+            status: constants.ORDER_STATUS_PAID,
+            items:  []OrderItem{physical},
+            want:   StatusTransitions[constants.ORDER_STATUS_PAID],
+        },
+        {
+            name:   "a paid mixed order is shipped first",
+            status: constants.ORDER_STATUS_PAID,
+            items:  []OrderItem{ebook, physical},
+            want:   StatusTransitions[constants.ORDER_STATUS_PAID],
+        },
+        {
+            name:   "a pending digital order is paid first",
+            status: constants.ORDER_STATUS_PENDING,
+            items:  []OrderItem{ebook},
+            want:   StatusTransitions[constants.ORDER_STATUS_PENDING],
+        },
+        {
+            name:   "an order without items is not digital",
+            status: constants.ORDER_STATUS_PAID,
+            want:   StatusTransitions[constants.ORDER_STATUS_PAID],
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            o := testOrder(t, tt.status, tt.items...)
+            if got := o.NextStatuses(); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("NextStatuses = %v, want %v", got, tt.want)
+            }
+            for _, status := range tt.want {
+                if err := o.CheckTransition(status); err != nil {
+                    t.Errorf("CheckTransition(%s) = %v, want nil", status, err)
+                }
+            }
+        })
+    }
+
+    if err := testOrder(t, constants.ORDER_STATUS_PAID, physical).CheckTransition(constants.ORDER_STATUS_ORDER_DELIVERED); !errors.Is(err, ErrInvalidTransition) {
+        t.Errorf("CheckTransition of a physical order to delivered = %v, want ErrInvalidTransition", err)
+    }
+    if got := StatusTransitions[constants.ORDER_STATUS_PAID]; len(got) != 4 {
+        t.Errorf("StatusTransitions of paid changed to %v", got)
+    }
+}
+
+func TestStockLines(t *testing.T) {
+    tests := []struct {
+        name  string
+        items []OrderItem
+        want  []products.StockLine
+    }{
+        {
+            name:  "one line per item",
+            items: []OrderItem{{ProductID: "a", Quantity: 2}, {ProductID: "b", VariantID: "b-red", Quantity: 1}},
+            want:  []products.StockLine{{ProductID: "a", Quantity: 2}, {ProductID: "b", VariantID: "b-red", Quantity: 1}},
+        },
+        {
+            name:  "the same variant adds up",
+            items: []OrderItem{{ProductID: "a", VariantID: "a-s", Quantity: 2}, {ProductID: "a", VariantID: "a-m", Quantity: 1}, {ProductID: "a", VariantID: "a-s", Quantity: 3}},
+            want:  []products.StockLine{{ProductID: "a", VariantID: "a-s", Quantity: 5}, {ProductID: "a", VariantID: "a-m", Quantity: 1}},
+        },
+        {
+            name: "bundles reserve their components per bundle",
+            items: []OrderItem{
+                {ProductID: "kit", Quantity: 3, Components: []OrderItemComponent{{ProductID: "a", Quantity: 2}, {ProductID: "b", VariantID: "b-red", Quantity: 1}}},
+                {ProductID: "a", Quantity: 1},
+            },
+            want: []products.StockLine{{ProductID: "a", Quantity: 7}, {ProductID: "b", VariantID: "b-red", Quantity: 3}},
+        },
+        {
+            name:  "digital items keep no stock",
+            items: []OrderItem{{ProductID: "ebook", Quantity: 1, Digital: true}, {ProductID: "a", Quantity: 1}},
+            want:  []products.StockLine{{ProductID: "a", Quantity: 1}},
+        },
+        {
+            name:  "no items",
+            items: nil,
+            want:  []products.StockLine{},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := stockLines(tt.items); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("stockLines = %+v, want %+v", got, tt.want)
+            }
+            if got := testOrder(t, "", tt.items...).StockLines(); !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("Order.StockLines = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
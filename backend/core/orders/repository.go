@@ -2,7 +2,12 @@ package orders
 
 import (
     "context"
+    "ecommerce-backend/core/products"
+    "ecommerce-backend/core/promotions"
+    "gorm.io/datatypes"
     "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+    "time"
 )
 
 type OrderRepository interface {
@@ -12,6 +17,14 @@ type OrderRepository interface {
     PaginatedList(ctx context.Context, skip, take int) ([]Order, int64, error)
     PaginatedListByUser(ctx context.Context, userID string, skip, take int) ([]Order, int64, error)
     UpdateCurrentStatus(ctx context.Context, id string, status string) error
+    // TransitionStatus sets the current status to "to" only while it is still "from",
+    // so of two concurrent status changes only one applies. It reports whether it did.
+    TransitionStatus(ctx context.Context, id, from, to string) (bool, error)
+    // CreateReserving reserves the order's stock, uses up its coupon codes and inserts the order in one transaction
+    CreateReserving(ctx context.Context, order *Order, redemptions []promotions.Redemption) error
+    // MoveStock switches the order's stock state from -> to and runs move in the same transaction.
+    // It is a no-op when the order is no longer in the from state, so concurrent moves apply once.
+    MoveStock(ctx context.Context, id, from, to string, move func(stock products.StockRepository, lines []products.StockLine) error) error
 }
 
 type OrderStatusRepository interface {
@@ -81,6 +94,42 @@ func (r *orderRepository) UpdateCurrentStatus(ctx context.Context, id string, st
     return r.db.WithContext(ctx).Model(&Order{}).Where("id = ?", id).Update("current_status", status).Error
 }
 
+func (r *orderRepository) TransitionStatus(ctx context.Context, id, from, to string) (bool, error) {
+    res := r.db.WithContext(ctx).Model(&Order{}).Where("id = ? AND current_status = ?", id, from).Update("current_status", to)
+    return res.RowsAffected > 0, res.Error
+}
+
+func (r *orderRepository) CreateReserving(ctx context.Context, order *Order, redemptions []promotions.Redemption) error {
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        if err := products.NewStockRepository(tx).Reserve(ctx, order.StockLines()); err != nil {
+            return err
+        }
+        // The promotions are locked while their limits are checked, so two orders cannot both take a code's last use
+        if err := promotions.NewPromotionRepository(tx).Redeem(ctx, redemptions); err != nil {
+            return err
+        }
+        order.StockState = StockStateReserved
+        return tx.Create(order).Error
+    })
+}
+
+func (r *orderRepository) MoveStock(ctx context.Context, id, from, to string, move func(stock products.StockRepository, lines []products.StockLine) error) error {
+    return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        res := tx.Model(&Order{}).Where("id = ? AND stock_state = ?", id, from).Update("stock_state", to)
+        if res.Error != nil {
+            return res.Error
+        }
+        if res.RowsAffected == 0 {
+            return nil
+        }
+        var o Order
+        if err := tx.First(&o, "id = ?", id).Error; err != nil {
+            return err
+        }
+        return move(products.NewStockRepository(tx), o.StockLines())
+    })
+}
+
 func (r *orderStatusRepository) Append(ctx context.Context, ev *OrderStatusEvent) error {
     return r.db.WithContext(ctx).Create(ev).Error
 }
@@ -93,4 +142,57 @@ func (r *orderStatusRepository) ListByOrder(ctx context.Context, orderID string)
     return list, nil
 }
 
+type IdempotencyRepository interface {
+    // Claim stores the key unless a live one with the same key and scope exists, which it returns instead.
+    // Expired keys and keys held longer than the lock timeout are replaced.
+    Claim(ctx context.Context, key *IdempotencyKey) (*IdempotencyKey, error)
+    // Complete records the response sent for a claimed key
+    Complete(ctx context.Context, key, scope string, status int, body []byte) error
+    // Release frees a claimed key so the request can be retried with it
+    Release(ctx context.Context, key, scope string) error
+    DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+    db *gorm.DB
+}
 
+func NewIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+    return &idempotencyRepository{db: db}
+}
+
+func (r *idempotencyRepository) Claim(ctx context.Context, key *IdempotencyKey) (*IdempotencyKey, error) {
+    var existing *IdempotencyKey
+    err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("key = ? AND scope = ?", key.Key, key.Scope).
+            Where("expires_at <= ? OR (status_code = 0 AND created_at <= ?)", key.CreatedAt, key.CreatedAt.Add(-idempotencyLockTimeout)).
+            Delete(&IdempotencyKey{}).Error; err != nil {
+            return err
+        }
+        res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+        if res.Error != nil || res.RowsAffected > 0 {
+            return res.Error
+        }
+        var found IdempotencyKey
+        if err := tx.First(&found, "key = ? AND scope = ?", key.Key, key.Scope).Error; err != nil {
+            return err
+        }
+        existing = &found
+        return nil
+    })
+    return existing, err
+}
+
+func (r *idempotencyRepository) Complete(ctx context.Context, key, scope string, status int, body []byte) error {
+    return r.db.WithContext(ctx).Model(&IdempotencyKey{}).Where("key = ? AND scope = ?", key, scope).
+        Updates(map[string]interface{}{"status_code": status, "response_body": datatypes.JSON(body)}).Error
+}
+
+func (r *idempotencyRepository) Release(ctx context.Context, key, scope string) error {
+    return r.db.WithContext(ctx).Where("key = ? AND scope = ? AND status_code = 0", key, scope).Delete(&IdempotencyKey{}).Error
+}
+
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+    res := r.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&IdempotencyKey{})
+    return res.RowsAffected, res.Error
+}
@@ -4,8 +4,14 @@ import (
     "context"
     "ecommerce-backend/common/constants"
     "ecommerce-backend/core/products"
+    "ecommerce-backend/core/promotions"
+    "ecommerce-backend/core/shipping"
+    "ecommerce-backend/core/tax"
     "errors"
+    "fmt"
+    "github.com/google/uuid"
     "github.com/sirupsen/logrus"
+    "time"
 )
 
 type EventEmitter interface {
@@ -20,14 +26,64 @@ type ThreadCreator interface {
     CreateThreadForOrder(ctx context.Context, orderID string) error
 }
 
+// DownloadGranter hands out the files of an order's digital items and takes them back.
+// Both must be safe to repeat.
+type DownloadGranter interface {
+    GrantDownloads(ctx context.Context, order *Order) error
+    RevokeDownloads(ctx context.Context, orderID string) error
+}
+
+// StockWatcher hears about the stock lines an order has just reserved
+type StockWatcher interface {
+    StockReserved(ctx context.Context, lines []products.StockLine)
+}
+
+// Promotions prices coupon codes against an order's lines and gives their uses back once its sale ends
+type Promotions interface {
+    Quote(ctx context.Context, userID string, codes []string, lines []promotions.Line) (*promotions.Quote, error)
+    Release(ctx context.Context, orderID string) error
+}
+
+// TaxCalculator works out the tax on an order's lines from where it ships to
+type TaxCalculator interface {
+    Calculate(ctx context.Context, addr tax.Address, lines []tax.Line) (*tax.Result, error)
+}
+
+// ShippingQuoter prices the shipping methods an order's lines can go to an address by
+type ShippingQuoter interface {
+    Quote(ctx context.Context, addr shipping.Address, lines []shipping.Line) (*shipping.Quote, error)
+}
+
+// Pricing is what an order comes to, coupon codes applied, tax worked out and shipping added
+type Pricing struct {
+    Subtotal       int                           `json:"subtotal"`
+    Discount       int                           `json:"discount"`
+    Tax            int                           `json:"tax"`
+    TaxInclusive   bool                          `json:"tax_inclusive"` // prices already contain Tax
+    Total          int                           `json:"total"`
+    FreeShipping   bool                          `json:"free_shipping"`
+    LineDiscounts  []int                         `json:"line_discounts"`
+    LineTaxes      []int                         `json:"line_taxes"`
+    Promotions     []promotions.AppliedPromotion `json:"promotions"`
+    TaxLines       []tax.TaxLine                 `json:"tax_lines"`
+    Shipping       int                           `json:"shipping"`
+    ShippingMethod *shipping.Option              `json:"shipping_method,omitempty"` // the method chosen, with its cost before FreeShipping
+}
+
 type OrderService interface {
-    Create(ctx context.Context, userID string, items []OrderItem, ship ShippingAddress, frontendTotal int) (string, int, error)
+    // Create prices the items, applies the coupon codes, adds tax and the cost of shipping by method
+    // and places the order, reserving its stock. method may only be empty when nothing needs shipping.
+    Create(ctx context.Context, userID string, items []OrderItem, ship ShippingAddress, method string, frontendTotal int, codes []string) (*Order, error)
+    // Preview prices the order like Create; shipping is left out until a method is chosen
+    Preview(ctx context.Context, userID string, items []OrderItem, ship ShippingAddress, method string, codes []string) (*Pricing, error)
     Get(ctx context.Context, id string) (*Order, error)
     List(ctx context.Context, skip, take int) ([]Order, int64, error)
     GetByUser(ctx context.Context, id string, userID string) (*Order, error)
     ListByUser(ctx context.Context, userID string, skip, take int) ([]Order, int64, error)
     AppendStatus(ctx context.Context, id string, status, reason string) error
     ListStatuses(ctx context.Context, id string) ([]OrderStatusEvent, error)
+    // NextStatuses returns the order's current status and the statuses it may move to next
+    NextStatuses(ctx context.Context, id string) (string, []string, error)
     UserCancel(ctx context.Context, id, userID string) error
     RequestRefund(ctx context.Context, id, userID string) error
 }
@@ -39,135 +95,193 @@ type orderService struct {
     eventEmitter  EventEmitter
     sseEmitter    SSEEventEmitter
     threadCreator ThreadCreator
+    downloads     DownloadGranter
+    stockWatchers []StockWatcher
+    promotions    Promotions
+    taxes         TaxCalculator
+    shipping      ShippingQuoter
 }
 
-func NewOrderService(or OrderRepository, sr OrderStatusRepository, pr products.ProductRepository) OrderService {
-    return &orderService{ordersRepo: or, statusRepo: sr, productRepo: pr, eventEmitter: nil, sseEmitter: nil, threadCreator: nil}
-}
-
-func NewOrderServiceWithEvents(or OrderRepository, sr OrderStatusRepository, pr products.ProductRepository, emitter EventEmitter) OrderService {
-    return &orderService{ordersRepo: or, statusRepo: sr, productRepo: pr, eventEmitter: emitter, sseEmitter: nil, threadCreator: nil}
+// OrderServiceOptions are what an order service works with besides its repositories; any left nil is skipped
+type OrderServiceOptions struct {
+    Events        EventEmitter
+    SSE           SSEEventEmitter
+    Threads       ThreadCreator
+    Downloads     DownloadGranter
+    Promotions    Promotions
+    Taxes         TaxCalculator
+    Shipping      ShippingQuoter
+    StockWatchers []StockWatcher
 }
 
-func NewOrderServiceWithChat(or OrderRepository, sr OrderStatusRepository, pr products.ProductRepository, emitter EventEmitter, sse SSEEventEmitter, tc ThreadCreator) OrderService {
-    return &orderService{ordersRepo: or, statusRepo: sr, productRepo: pr, eventEmitter: emitter, sseEmitter: sse, threadCreator: tc}
+func NewOrderService(or OrderRepository, sr OrderStatusRepository, pr products.ProductRepository, opts OrderServiceOptions) OrderService {
+    return &orderService{
+        ordersRepo:    or,
+        statusRepo:    sr,
+        productRepo:   pr,
+        eventEmitter:  opts.Events,
+        sseEmitter:    opts.SSE,
+        threadCreator: opts.Threads,
+        downloads:     opts.Downloads,
+        stockWatchers: opts.StockWatchers,
+        promotions:    opts.Promotions,
+        taxes:         opts.Taxes,
+        shipping:      opts.Shipping,
+    }
 }
 
-func (s *orderService) Create(ctx context.Context, userID string, items []OrderItem, ship ShippingAddress, frontendTotal int) (string, int, error) {
+func (s *orderService) Create(ctx context.Context, userID string, items []OrderItem, ship ShippingAddress, method string, frontendTotal int, codes []string) (*Order, error) {
     if len(items) == 0 {
-        return "", 0, errors.New("no items")
+        return nil, errors.New("no items")
     }
-    backendTotal := 0
-    for _, it := range items {
+    // Every line is priced at the same instant, so a sale ending mid-request applies to all or none
+    if err := s.priceItems(ctx, items, time.Now()); err != nil {
+        return nil, err
+    }
+    if err := checkGuestItems(userID, items); err != nil {
+        return nil, err
+    }
+    quote, err := s.quote(ctx, userID, items, codes)
+    if err != nil {
+        return nil, err
+    }
+    taxes, err := s.taxOn(ctx, items, ship, quote)
+    if err != nil {
+        return nil, err
+    }
+    shipBy, err := s.shipBy(ctx, items, ship, method, quote, true)
+    if err != nil {
+        return nil, err
+    }
+    pricing := newPricing(quote, taxes, shipBy)
+    backendTotal := pricing.Total
+
+    o := &Order{ID: uuid.New().String(), UserID: userID, FrontendTotal: frontendTotal, BackendTotal: backendTotal, CurrentStatus: constants.ORDER_STATUS_PENDING}
+    o.Subtotal = quote.Subtotal
+    o.DiscountTotal = quote.Discount
+    o.TaxTotal = taxes.Tax
+    o.TaxInclusive = taxes.Inclusive
+    if shipBy != nil {
+        o.ShippingMethodID = shipBy.MethodID
+        o.ShippingMethod = shipBy.Name
+        o.ShippingCost = pricing.Shipping
+    }
+    for i := range items {
+        items[i].Discount = quote.LineDiscounts[i]
+        items[i].Tax = taxes.LineTaxes[i]
+    }
+    o.SetDiscounts(quote.Promotions)
+    o.SetTaxLines(taxes.Lines)
+    o.SetItems(items)
+    o.SetShipping(ship)
+    if err := s.ordersRepo.CreateReserving(ctx, o, promotions.NewRedemptions(o.ID, userID, quote)); err != nil {
+        return nil, err
+    }
+    for _, watcher := range s.stockWatchers {
+        watcher.StockReserved(ctx, o.StockLines())
+    }
+    // initial status event
+    _ = s.statusRepo.Append(ctx, &OrderStatusEvent{OrderID: o.ID, Status: o.CurrentStatus, Reason: "order created"})
+    
+    // Auto-create chat thread
+    if s.threadCreator != nil {
+        _ = s.threadCreator.CreateThreadForOrder(ctx, o.ID)
+    }
+    
+    // Emit plugin event
+    if s.eventEmitter != nil {
+        s.eventEmitter.Emit(map[string]interface{}{
+            "name":   constants.EVENT_ORDER_CREATED,
+            "target": constants.PLUGIN_TARGET_DISCORD_ORDERS,
+            "data": map[string]interface{}{
+                "order_id": o.ID,
+                "user_id":  userID,
+                "total":    backendTotal,
+            },
+        })
+    }
+    
+    // Emit SSE notification to admin
+    if s.sseEmitter != nil {
+        s.sseEmitter.EmitAdminEvent(map[string]interface{}{
+            "resource":      constants.CHAT_RESOURCE_ORDERS,
+            "resource_type": constants.EVENT_ORDER_CREATED,
+            "data": map[string]interface{}{
+                "order_id": o.ID,
+                "user_id":  userID,
+                "total":    backendTotal,
+                "status":   o.CurrentStatus,
+            },
+        })
+    }
+    
+    return o, nil
+}
+
+
+// priceItems prices every line from the catalogue at now and snapshots what was sold:
+// the variant matched, bundle components and the unit and regular prices
+func (s *orderService) priceItems(ctx context.Context, items []OrderItem, now time.Time) error {
+    for i, it := range items {
         // Always use database price - never trust frontend price
         p, err := s.productRepo.GetByID(ctx, it.ProductID)
         if err != nil {
-            return "", 0, err
+            return err
         }
         
-        // Check if product is active
-        if !p.IsActive {
-            return "", 0, errors.New("product is not active")
+        // Check if product is active and inside its publishing window
+        if !p.IsVisible(now) {
+            return errors.New("product is not active")
         }
         
         var unit int
-        var variantMatched bool
         var matchedVariantID string
         
-        // Case 1: Product has variants
-        if len(p.Variants) > 0 {
-            if it.VariantID != "" {
-                // Explicit variant ID provided - use it
-                variantMatched = false
-                for _, v := range p.Variants {
-                    if v.ID == it.VariantID {
-                        if !v.IsActive {
-                            return "", 0, errors.New("variant is not active")
-                        }
-                        unit = v.Price
-                        variantMatched = true
-                        matchedVariantID = v.ID
-                        logrus.WithFields(logrus.Fields{
-                            "order_item": it.ProductID,
-                            "variant_id": it.VariantID,
-                            "variant_price": unit,
-                            "quantity": it.Quantity,
-                            "match_type": "explicit_variant_id",
-                        }).Info("variant matched by explicit ID")
-                        break
-                    }
-                }
-                if !variantMatched {
-                    logrus.WithFields(logrus.Fields{
-                        "order_item": it.ProductID,
-                        "variant_id": it.VariantID,
-                        "available_variants": len(p.Variants),
-                    }).Error("variant ID not found, falling back to price matching")
-                    // Fall through to price matching
-                }
+        // Case 0: Bundle - one line priced as a whole, its components are reserved
+        if p.IsBundle() {
+            components, err := bundleComponents(p, now)
+            if err != nil {
+                return err
             }
-            // If VariantSKU provided, try to match by SKU
-            if !variantMatched && it.VariantSKU != "" {
-                for _, v := range p.Variants {
-                    if v.SKU == it.VariantSKU {
-                        if !v.IsActive {
-                            return "", 0, errors.New("variant is not active")
-                        }
-                        unit = v.Price
-                        variantMatched = true
-                        matchedVariantID = v.ID
-                        logrus.WithFields(logrus.Fields{
-                            "order_item": it.ProductID,
-                            "variant_sku": it.VariantSKU,
-                            "matched_variant_id": v.ID,
-                            "variant_price": unit,
-                            "quantity": it.Quantity,
-                            "match_type": "sku_match",
-                        }).Info("variant matched by SKU")
-                        break
-                    }
-                }
+            items[i].Components = components
+            unit = p.PriceAt(now)
+            logrus.WithFields(logrus.Fields{
+                "order_item": it.ProductID,
+                "bundle_price": unit,
+                "components": len(components),
+                "quantity": it.Quantity,
+                "match_type": "bundle",
+            }).Info("bundle priced from its definition")
+        } else if p.HasActiveVariants() {
+            // Case 1: Product has variants - the item must name one by ID or SKU, since stock is
+            // kept per variant and variants sharing a price cannot be told apart
+            v, matchType := matchVariant(p, it)
+            if v == nil {
+                logrus.WithFields(logrus.Fields{
+                    "order_item": it.ProductID,
+                    "variant_id": it.VariantID,
+                    "variant_sku": it.VariantSKU,
+                    "available_variants": len(p.Variants),
+                }).Error("no variant matched by ID or SKU")
+                return fmt.Errorf("%w: %s", ErrVariantNotMatched, p.Name)
             }
-            
-            // Case 2: No variant ID but variants exist - match by price
-            if it.VariantID == "" || !variantMatched {
-                variantMatched = false
-                for _, v := range p.Variants {
-                    if v.Price == it.Price {
-                        if !v.IsActive {
-                            return "", 0, errors.New("variant is not active")
-                        }
-                        unit = v.Price
-                        variantMatched = true
-                        matchedVariantID = v.ID
-                        logrus.WithFields(logrus.Fields{
-                            "order_item": it.ProductID,
-                            "frontend_price": it.Price,
-                            "matched_variant_id": v.ID,
-                            "variant_price": unit,
-                            "quantity": it.Quantity,
-                            "match_type": "price_match",
-                        }).Info("variant matched by price")
-                        break
-                    }
-                }
-                if !variantMatched {
-                    prices := make([]int, len(p.Variants))
-                    for i, v := range p.Variants {
-                        prices[i] = v.Price
-                    }
-                    logrus.WithFields(logrus.Fields{
-                        "order_item": it.ProductID,
-                        "frontend_price": it.Price,
-                        "available_variants": len(p.Variants),
-                        "available_variant_prices": prices,
-                    }).Error("no variant matched by price, using product base price")
-                    unit = p.Price
-                }
+            if !v.IsActive {
+                return errors.New("variant is not active")
             }
+            unit = v.PriceAt(now)
+            matchedVariantID = v.ID
+            logrus.WithFields(logrus.Fields{
+                "order_item": it.ProductID,
+                "variant_id": it.VariantID,
+                "variant_sku": it.VariantSKU,
+                "matched_variant_id": v.ID,
+                "variant_price": unit,
+                "quantity": it.Quantity,
+                "match_type": matchType,
+            }).Info("variant matched")
         } else {
             // Case 3: Product has no variants - use product base price
-            unit = p.Price
+            unit = p.PriceAt(now)
             logrus.WithFields(logrus.Fields{
                 "order_item": it.ProductID,
                 "product_price": unit,
@@ -176,8 +290,19 @@ func (s *orderService) Create(ctx context.Context, userID string, items []OrderI
             }).Info("product has no variants, using base price")
         }
         
-        backendTotal += unit * it.Quantity
-        
+        // Record the variant actually sold so its stock is the one reserved
+        items[i].VariantID = matchedVariantID
+        items[i].Digital = p.Digital
+        items[i].TaxClass = p.TaxClass
+        // Snapshot the prices applied at order time
+        items[i].UnitPrice = unit
+        items[i].RegularPrice = p.RegularPrice()
+        for _, v := range p.Variants {
+            if v.ID == matchedVariantID {
+                items[i].RegularPrice = v.Price
+            }
+        }
+
         // Log price mismatch for audit
         if it.Price != unit {
             logrus.WithFields(logrus.Fields{
@@ -192,48 +317,152 @@ func (s *orderService) Create(ctx context.Context, userID string, items []OrderI
         }
     }
 
-    o := &Order{UserID: userID, FrontendTotal: frontendTotal, BackendTotal: backendTotal, CurrentStatus: constants.ORDER_STATUS_PENDING}
-    o.SetItems(items)
-    o.SetShipping(ship)
-    if err := s.ordersRepo.Create(ctx, o); err != nil {
-        return "", 0, err
+    return nil
+}
+
+// matchVariant finds the variant the item names by ID, else by SKU, with how it matched
+func matchVariant(p *products.Product, it OrderItem) (*products.ProductVariant, string) {
+    for i := range p.Variants {
+        if it.VariantID != "" && p.Variants[i].ID == it.VariantID {
+            return &p.Variants[i], "explicit_variant_id"
+        }
     }
-    // initial status event
-    _ = s.statusRepo.Append(ctx, &OrderStatusEvent{OrderID: o.ID, Status: o.CurrentStatus, Reason: "order created"})
-    
-    // Auto-create chat thread
-    if s.threadCreator != nil {
-        _ = s.threadCreator.CreateThreadForOrder(ctx, o.ID)
+    for i := range p.Variants {
+        if it.VariantSKU != "" && p.Variants[i].SKU == it.VariantSKU {
+            return &p.Variants[i], "sku_match"
+        }
     }
-    
-    // Emit plugin event
-    if s.eventEmitter != nil {
-        s.eventEmitter.Emit(map[string]interface{}{
-            "name":   constants.EVENT_ORDER_CREATED,
-            "target": constants.PLUGIN_TARGET_DISCORD_ORDERS,
-            "data": map[string]interface{}{
-                "order_id": o.ID,
-                "user_id":  userID,
-                "total":    backendTotal,
-            },
-        })
+    return nil, ""
+}
+
+// quote applies the coupon codes to the priced items; without codes it only adds them up
+// checkGuestItems refuses digital items to guests, who have no account to download them from.
+// It runs after priceItems, which marks the digital items.
+func checkGuestItems(userID string, items []OrderItem) error {
+    if userID != "" {
+        return nil
     }
-    
-    // Emit SSE notification to admin
-    if s.sseEmitter != nil {
-        s.sseEmitter.EmitAdminEvent(map[string]interface{}{
-            "resource":      constants.CHAT_RESOURCE_ORDERS,
-            "resource_type": constants.EVENT_ORDER_CREATED,
-            "data": map[string]interface{}{
-                "order_id": o.ID,
-                "user_id":  userID,
-                "total":    backendTotal,
-                "status":   o.CurrentStatus,
-            },
-        })
+    for _, it := range items {
+        if it.Digital {
+            return ErrDigitalNeedsAccount
+        }
     }
-    
-    return o.ID, backendTotal, nil
+    return nil
+}
+
+func (s *orderService) quote(ctx context.Context, userID string, items []OrderItem, codes []string) (*promotions.Quote, error) {
+    if len(codes) > 0 && s.promotions == nil {
+        return nil, errors.New("coupon codes are not accepted")
+    }
+    lines := make([]promotions.Line, len(items))
+    for i, it := range items {
+        lines[i] = promotions.Line{ProductID: it.ProductID, VariantID: it.VariantID, Quantity: it.Quantity, UnitPrice: it.UnitPrice}
+    }
+    if s.promotions == nil {
+        quote := &promotions.Quote{LineDiscounts: make([]int, len(lines)), Promotions: []promotions.AppliedPromotion{}}
+        for _, l := range lines {
+            quote.Subtotal += l.UnitPrice * l.Quantity
+        }
+        quote.Total = quote.Subtotal
+        return quote, nil
+    }
+    return s.promotions.Quote(ctx, userID, codes, lines)
+}
+
+// taxOn works out the tax on the items as discounted by quote; without a calculator there is none
+func (s *orderService) taxOn(ctx context.Context, items []OrderItem, ship ShippingAddress, quote *promotions.Quote) (*tax.Result, error) {
+    if s.taxes == nil {
+        return &tax.Result{LineTaxes: make([]int, len(items)), Lines: []tax.TaxLine{}}, nil
+    }
+    lines := make([]tax.Line, len(items))
+    for i, it := range items {
+        lines[i] = tax.Line{ProductID: it.ProductID, TaxClass: it.TaxClass, Amount: it.UnitPrice*it.Quantity - quote.LineDiscounts[i]}
+    }
+    addr := tax.Address{Country: ship.Country, State: ship.State, PostalCode: ship.PostalCode}
+    return s.taxes.Calculate(ctx, addr, lines)
+}
+
+// shipBy finds the method the items ship to ship by, priced on the items as discounted by quote;
+// nil when nothing needs shipping, or when method is empty and not required
+func (s *orderService) shipBy(ctx context.Context, items []OrderItem, ship ShippingAddress, method string, quote *promotions.Quote, required bool) (*shipping.Option, error) {
+    if s.shipping == nil {
+        if method != "" {
+            return nil, errors.New("shipping methods are not offered")
+        }
+        return nil, nil
+    }
+    if method == "" && !required {
+        return nil, nil
+    }
+    lines := make([]shipping.Line, len(items))
+    for i, it := range items {
+        lines[i] = shipping.Line{ProductID: it.ProductID, VariantID: it.VariantID, Quantity: it.Quantity, Amount: it.UnitPrice*it.Quantity - quote.LineDiscounts[i]}
+    }
+    addr := shipping.Address{Country: ship.Country, State: ship.State, PostalCode: ship.PostalCode}
+    shipQuote, err := s.shipping.Quote(ctx, addr, lines)
+    if err != nil {
+        return nil, err
+    }
+    if !shipQuote.RequiresShipping {
+        return nil, nil
+    }
+    option, err := shipQuote.Option(method)
+    if err != nil {
+        return nil, err
+    }
+    return &option, nil
+}
+
+// newPricing puts the discounts, tax and shipping together. Tax is only added when prices do not
+// already contain it; shipping is not taxed, and costs nothing when a coupon code made it free.
+func newPricing(quote *promotions.Quote, taxes *tax.Result, shipBy *shipping.Option) *Pricing {
+    pricing := &Pricing{
+        Subtotal:       quote.Subtotal,
+        Discount:       quote.Discount,
+        Tax:            taxes.Tax,
+        TaxInclusive:   taxes.Inclusive,
+        Total:          quote.Total,
+        FreeShipping:   quote.FreeShipping,
+        LineDiscounts:  quote.LineDiscounts,
+        LineTaxes:      taxes.LineTaxes,
+        Promotions:     quote.Promotions,
+        TaxLines:       taxes.Lines,
+        ShippingMethod: shipBy,
+    }
+    if !taxes.Inclusive {
+        pricing.Total += taxes.Tax
+    }
+    if shipBy != nil && !quote.FreeShipping {
+        pricing.Shipping = shipBy.Cost
+        pricing.Total += shipBy.Cost
+    }
+    return pricing
+}
+
+// Preview prices the items, applies the codes and adds tax and shipping like Create, without reserving stock or using the codes
+func (s *orderService) Preview(ctx context.Context, userID string, items []OrderItem, ship ShippingAddress, method string, codes []string) (*Pricing, error) {
+    if len(items) == 0 {
+        return nil, errors.New("no items")
+    }
+    if err := s.priceItems(ctx, items, time.Now()); err != nil {
+        return nil, err
+    }
+    if err := checkGuestItems(userID, items); err != nil {
+        return nil, err
+    }
+    quote, err := s.quote(ctx, userID, items, codes)
+    if err != nil {
+        return nil, err
+    }
+    taxes, err := s.taxOn(ctx, items, ship, quote)
+    if err != nil {
+        return nil, err
+    }
+    shipBy, err := s.shipBy(ctx, items, ship, method, quote, false)
+    if err != nil {
+        return nil, err
+    }
+    return newPricing(quote, taxes, shipBy), nil
 }
 
 func (s *orderService) Get(ctx context.Context, id string) (*Order, error) {
@@ -256,10 +485,11 @@ func (s *orderService) AppendStatus(ctx context.Context, id string, status, reas
     if _, ok := AllowedStatuses[status]; !ok {
         return errors.New("invalid status")
     }
-    if err := s.statusRepo.Append(ctx, &OrderStatusEvent{OrderID: id, Status: status, Reason: reason}); err != nil {
+    o, err := s.ordersRepo.GetByID(ctx, id)
+    if err != nil {
         return err
     }
-    if err := s.ordersRepo.UpdateCurrentStatus(ctx, id, status); err != nil {
+    if err := s.moveStatus(ctx, o, status, reason); err != nil {
         return err
     }
     
@@ -279,28 +509,115 @@ func (s *orderService) AppendStatus(ctx context.Context, id string, status, reas
     return nil
 }
 
+// moveStatus takes the order to status when the transition graph allows it, then brings its
+// stock and downloads in line and records the event. The status is claimed first so a
+// concurrent change of the same order fails with a TransitionError instead of both applying.
+func (s *orderService) moveStatus(ctx context.Context, o *Order, status, reason string) error {
+    if err := o.CheckTransition(status); err != nil {
+        return err
+    }
+    moved, err := s.ordersRepo.TransitionStatus(ctx, o.ID, o.CurrentStatus, status)
+    if err != nil {
+        return err
+    }
+    if !moved {
+        current, err := s.ordersRepo.GetByID(ctx, o.ID)
+        if err != nil {
+            return err
+        }
+        return &TransitionError{From: current.CurrentStatus, To: status}
+    }
+    if err := s.syncStock(ctx, o.ID, status); err != nil {
+        if _, rerr := s.ordersRepo.TransitionStatus(ctx, o.ID, status, o.CurrentStatus); rerr != nil {
+            logrus.Errorf("Failed to restore status of order %s after a stock error: %v", o.ID, rerr)
+        }
+        return err
+    }
+    s.syncPromotions(ctx, o.ID, status)
+    if err := s.statusRepo.Append(ctx, &OrderStatusEvent{OrderID: o.ID, Status: status, Reason: reason}); err != nil {
+        return err
+    }
+    return s.syncDownloads(ctx, o.ID, status)
+}
+
+// syncPromotions gives back the coupon code uses of an order whose sale ended, along with its stock.
+// Release only frees what the order still holds, so repeating a status gives nothing back twice.
+func (s *orderService) syncPromotions(ctx context.Context, id, status string) {
+    if s.promotions == nil {
+        return
+    }
+    if _, ok := stockReleaseStatuses[status]; !ok {
+        return
+    }
+    if err := s.promotions.Release(ctx, id); err != nil {
+        logrus.Errorf("Failed to release coupon codes of order %s: %v", id, err)
+    }
+}
+
+// syncStock moves the order's stock to match a new status. Moves are guarded by the
+// order's stock state, so repeating a status never releases or commits twice.
+func (s *orderService) syncStock(ctx context.Context, id, status string) error {
+    if _, ok := stockCommitStatuses[status]; ok {
+        return s.ordersRepo.MoveStock(ctx, id, StockStateReserved, StockStateCommitted, func(stock products.StockRepository, lines []products.StockLine) error {
+            return stock.Commit(ctx, lines)
+        })
+    }
+    if _, ok := stockReleaseStatuses[status]; ok {
+        if err := s.ordersRepo.MoveStock(ctx, id, StockStateReserved, StockStateReleased, func(stock products.StockRepository, lines []products.StockLine) error {
+            return stock.Release(ctx, lines)
+        }); err != nil {
+            return err
+        }
+        return s.ordersRepo.MoveStock(ctx, id, StockStateCommitted, StockStateReleased, func(stock products.StockRepository, lines []products.StockLine) error {
+            return stock.Restock(ctx, lines)
+        })
+    }
+    return nil
+}
+
+// syncDownloads grants or revokes the order's downloads to match a new status
+func (s *orderService) syncDownloads(ctx context.Context, id, status string) error {
+    if s.downloads == nil {
+        return nil
+    }
+    if _, ok := downloadGrantStatuses[status]; ok {
+        o, err := s.ordersRepo.GetByID(ctx, id)
+        if err != nil {
+            return err
+        }
+        return s.downloads.GrantDownloads(ctx, o)
+    }
+    if _, ok := downloadRevokeStatuses[status]; ok {
+        return s.downloads.RevokeDownloads(ctx, id)
+    }
+    return nil
+}
+
 func (s *orderService) ListStatuses(ctx context.Context, id string) ([]OrderStatusEvent, error) {
     return s.statusRepo.ListByOrder(ctx, id)
 }
 
+func (s *orderService) NextStatuses(ctx context.Context, id string) (string, []string, error) {
+    o, err := s.ordersRepo.GetByID(ctx, id)
+    if err != nil {
+        return "", nil, err
+    }
+    return o.CurrentStatus, o.NextStatuses(), nil
+}
+
 func (s *orderService) UserCancel(ctx context.Context, id, userID string) error {
     o, err := s.ordersRepo.GetByIDAndUser(ctx, id, userID)
     if err != nil {
         return err
     }
-    // disallow cancel after delivery initiated
-    if o.CurrentStatus == constants.ORDER_STATUS_ORDER_DELIVERED || o.CurrentStatus == constants.ORDER_STATUS_AGENT_OUT_FOR_DELIVERY {
-        return errors.New("cannot cancel after out for delivery")
-    }
-    if err := s.statusRepo.Append(ctx, &OrderStatusEvent{OrderID: id, Status: constants.ORDER_STATUS_USER_CANCELLED, Reason: "cancelled by user"}); err != nil {
-        return err
-    }
-    return s.ordersRepo.UpdateCurrentStatus(ctx, id, constants.ORDER_STATUS_USER_CANCELLED)
+    // The transition graph stops cancelling once the order is out for delivery
+    return s.moveStatus(ctx, o, constants.ORDER_STATUS_USER_CANCELLED, "cancelled by user")
 }
 
 func (s *orderService) RequestRefund(ctx context.Context, id, userID string) error {
     // ensure ownership
-    if _, err := s.ordersRepo.GetByIDAndUser(ctx, id, userID); err != nil {
+    o, err := s.ordersRepo.GetByIDAndUser(ctx, id, userID)
+    if err != nil {
         return err
     }
     // check delivered within 2 days based on status events
@@ -323,10 +640,50 @@ func (s *orderService) RequestRefund(ctx context.Context, id, userID string) err
     if now-deliveredAt > 172800 {
         return errors.New("refund window expired")
     }
-    if err := s.statusRepo.Append(ctx, &OrderStatusEvent{OrderID: id, Status: constants.ORDER_STATUS_USER_RETURNING, Reason: "refund requested by user"}); err != nil {
-        return err
+    return s.moveStatus(ctx, o, constants.ORDER_STATUS_USER_RETURNING, "refund requested by user")
+}
+
+// IdempotencyKeyCleaner periodically deletes idempotency keys past their retention window
+type IdempotencyKeyCleaner struct {
+    repo   IdempotencyRepository
+    ticker *time.Ticker
+    stop   chan bool
+}
+
+func NewIdempotencyKeyCleaner(repo IdempotencyRepository, interval time.Duration) *IdempotencyKeyCleaner {
+    c := &IdempotencyKeyCleaner{
+        repo:   repo,
+        ticker: time.NewTicker(interval),
+        stop:   make(chan bool),
     }
-    return s.ordersRepo.UpdateCurrentStatus(ctx, id, constants.ORDER_STATUS_USER_RETURNING)
+    go func() {
+        for {
+            select {
+            case <-c.ticker.C:
+                c.run()
+            case <-c.stop:
+                c.ticker.Stop()
+                return
+            }
+        }
+    }()
+    return c
 }
 
+func (c *IdempotencyKeyCleaner) run() {
+    deleted, err := c.repo.DeleteExpired(context.Background(), time.Now())
+    if err != nil {
+        logrus.Errorf("Failed to clean up idempotency keys: %v", err)
+        return
+    }
+    if deleted > 0 {
+        logrus.Infof("Deleted %d expired idempotency keys", deleted)
+    }
+}
 
+// Stop stops the cleaner goroutine
+func (c *IdempotencyKeyCleaner) Stop() {
+    if c.stop != nil {
+        close(c.stop)
+    }
+}
@@ -0,0 +1,51 @@
+package orders
+
+import (
+    "testing"
+
+    "ecommerce-backend/core/products"
+)
+
+func TestMatchVariant(t *testing.T) {
+    p := &products.Product{Variants: []products.ProductVariant{
+        {ID: "v-s", SKU: "TEE-S", Price: 1000, IsActive: true},
+        {ID: "v-m", SKU: "TEE-M", Price: 1000, IsActive: true},
+    }}
+    tests := []struct {
+        name string
+        item OrderItem
+        want string // variant ID, "" for none
+    }{
+        {"by ID", OrderItem{VariantID: "v-m"}, "v-m"},
+        {"by SKU", OrderItem{VariantSKU: "TEE-M"}, "v-m"},
+        {"the ID wins over the SKU", OrderItem{VariantID: "v-s", VariantSKU: "TEE-M"}, "v-s"},
+        {"an unknown ID falls back to the SKU", OrderItem{VariantID: "gone", VariantSKU: "TEE-M"}, "v-m"},
+        {"a price shared by variants picks none", OrderItem{Price: 1000}, ""},
+        {"unknown ID and SKU", OrderItem{VariantID: "gone", VariantSKU: "TEE-XL", Price: 1000}, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := ""
+            if v, _ := matchVariant(p, tt.item); v != nil {
+                got = v.ID
+            }
+            if got != tt.want {
+                t.Errorf("matchVariant = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestCheckGuestItems(t *testing.T) {
+    ebook := OrderItem{ProductID: "ebook", Quantity: 1, Digital: true}
+    book := OrderItem{ProductID: "book", Quantity: 1}
+    if err := checkGuestItems("", []OrderItem{book, ebook}); err != ErrDigitalNeedsAccount {
+        t.Errorf("checkGuestItems of a guest buying an ebook = %v, want ErrDigitalNeedsAccount", err)
+    }
+    if err := checkGuestItems("", []OrderItem{book}); err != nil {
+        t.Errorf("checkGuestItems of a guest buying a book = %v, want nil", err)
+    }
+    if err := checkGuestItems("user-1", []OrderItem{ebook}); err != nil {
+        t.Errorf("checkGuestItems of a shopper buying an ebook = %v, want nil", err)
+    }
+}
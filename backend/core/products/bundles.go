@@ -0,0 +1,323 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Product types. A bundle has no stock or variants of its own; it sells a fixed set of components.
+const (
+	ProductTypeSimple = "simple"
+	ProductTypeBundle = "bundle"
+)
+
+var ErrInvalidBundle = errors.New("invalid bundle")
+
+// BundleComponent is one product, or one variant of it, that a bundle contains Quantity times
+type BundleComponent struct {
+	ID        uint     `gorm:"primaryKey" json:"id"`
+	BundleID  string   `gorm:"index;not null" json:"bundle_id"`
+	ProductID string   `gorm:"not null" json:"product_id"`
+	VariantID string   `json:"variant_id"`
+	Quantity  int      `gorm:"not null" json:"quantity"`
+	Position  int      `gorm:"not null;default:0" json:"position"`
+	Product   *Product `gorm:"foreignKey:ProductID" json:"-"` // nil when the component product was deleted
+}
+
+func (BundleComponent) TableName() string {
+	return "product_bundle_components"
+}
+
+// ComponentResponse describes a bundle component to shoppers
+type ComponentResponse struct {
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id,omitempty"`
+	SKU       string `json:"sku,omitempty"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+	Price     int    `json:"price"` // current unit price when bought on its own
+	Available int    `json:"available"`
+}
+
+// IsBundle reports whether the product is sold as a bundle of components
+func (p *Product) IsBundle() bool {
+	return p.Type == ProductTypeBundle
+}
+
+// productType treats products stored before types existed as simple
+func (p *Product) productType() string {
+	if p.Type == "" {
+		return ProductTypeSimple
+	}
+	return p.Type
+}
+
+// Variant returns the component's variant, or nil for product-level components and inactive variants
+func (c *BundleComponent) Variant() *ProductVariant {
+	if c.Product == nil || c.VariantID == "" {
+		return nil
+	}
+	for i := range c.Product.Variants {
+		if c.Product.Variants[i].ID == c.VariantID && c.Product.Variants[i].IsActive {
+			return &c.Product.Variants[i]
+		}
+	}
+	return nil
+}
+
+// Sellable reports whether the component product and variant still exist
+func (c *BundleComponent) Sellable() bool {
+	return c.Product != nil && (c.VariantID == "" || c.Variant() != nil)
+}
+
+// PriceAt returns the unit price of the component sold on its own at t, 0 once it is not sellable
+func (c *BundleComponent) PriceAt(t time.Time) int {
+	if !c.Sellable() {
+		return 0
+	}
+	if v := c.Variant(); v != nil {
+		return v.PriceAt(t)
+	}
+	return c.Product.PriceAt(t)
+}
+
+// regularPrice returns the unit price of the component without sales
+func (c *BundleComponent) regularPrice() int {
+	if !c.Sellable() {
+		return 0
+	}
+	if v := c.Variant(); v != nil {
+		return v.Price
+	}
+	return c.Product.Price
+}
+
+// Available returns how many units of the component can still be reserved
+func (c *BundleComponent) Available() int {
+	if !c.Sellable() {
+		return 0
+	}
+	if v := c.Variant(); v != nil {
+		if !v.InStock {
+			return 0
+		}
+		return v.Available()
+	}
+	return c.Product.Available()
+}
+
+// bundleAvailable is the number of whole bundles the components allow
+func (p *Product) bundleAvailable() int {
+	if len(p.Components) == 0 {
+		return 0
+	}
+	available := -1
+	for i := range p.Components {
+		c := &p.Components[i]
+		if c.Quantity <= 0 {
+			return 0
+		}
+		if n := c.Available() / c.Quantity; available < 0 || n < available {
+			available = n
+		}
+	}
+	return available
+}
+
+// SeparatePriceAt is what the bundle's components cost at t when bought one by one
+func (p *Product) SeparatePriceAt(t time.Time) int {
+	total := 0
+	for i := range p.Components {
+		total += p.Components[i].PriceAt(t) * p.Components[i].Quantity
+	}
+	return total
+}
+
+// discounted applies the bundle discount, rounding down to the smallest currency unit
+func (p *Product) discounted(total int) int {
+	return total * (100 - p.BundleDiscountPercent) / 100
+}
+
+// RegularPrice returns the price before sales: the product price, or for a bundle priced by
+// discount, the discounted regular prices of its components
+func (p *Product) RegularPrice() int {
+	if !p.IsBundle() || p.BundleDiscountPercent == 0 {
+		return p.Price
+	}
+	total := 0
+	for i := range p.Components {
+		total += p.Components[i].regularPrice() * p.Components[i].Quantity
+	}
+	return p.discounted(total)
+}
+
+// bundleSaleResponse prices a bundle. Buying the components separately serves as the compare-at
+// price when it costs more.
+func bundleSaleResponse(p *Product, now time.Time) SaleResponse {
+	separate := p.SeparatePriceAt(now)
+	if p.BundleDiscountPercent == 0 {
+		pricing := p.SalePricing
+		if separate > pricing.CompareAtPrice {
+			pricing.CompareAtPrice = separate
+		}
+		return saleResponse(p.Price, pricing, now)
+	}
+	// Component sales carry over to a bundle priced by discount
+	regular := p.RegularPrice()
+	resp := SaleResponse{CurrentPrice: p.PriceAt(now)}
+	resp.OnSale = resp.CurrentPrice < regular
+	compare := max(separate, p.CompareAtPrice)
+	if resp.OnSale {
+		compare = max(compare, regular)
+	}
+	if compare > resp.CurrentPrice {
+		resp.CompareAtPrice = compare
+	}
+	return resp
+}
+
+func componentResponses(p *Product, now time.Time) []ComponentResponse {
+	resp := make([]ComponentResponse, len(p.Components))
+	for i := range p.Components {
+		c := &p.Components[i]
+		resp[i] = ComponentResponse{
+			ProductID: c.ProductID,
+			VariantID: c.VariantID,
+			Quantity:  c.Quantity,
+			Price:     c.PriceAt(now),
+			Available: c.Available(),
+		}
+		if c.Product != nil {
+			resp[i].Name = c.Product.Name
+		}
+		if v := c.Variant(); v != nil {
+			resp[i].SKU = v.SKU
+		}
+	}
+	return resp
+}
+
+// checkBundle validates the bundle fields of product against the stored components. Components may
+// be hidden from the catalogue, so kits can be made of parts that are not sold on their own.
+func (s *productService) checkBundle(ctx context.Context, product *Product) error {
+	if !product.IsBundle() {
+		if len(product.Components) > 0 || product.BundleDiscountPercent != 0 {
+			return fmt.Errorf("%w: only bundles have components or a bundle discount", ErrInvalidBundle)
+		}
+		return nil
+	}
+	if len(product.Variants) > 0 {
+		return fmt.Errorf("%w: bundles cannot have variants", ErrInvalidBundle)
+	}
+	if product.Digital {
+		return fmt.Errorf("%w: bundles cannot be digital", ErrInvalidBundle)
+	}
+	if product.ID != "" {
+		count, err := s.repo.CountBundlesContaining(ctx, product.ID)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: the product is a component of another bundle", ErrInvalidBundle)
+		}
+	}
+	if len(product.Components) == 0 {
+		return fmt.Errorf("%w: a bundle needs at least one component", ErrInvalidBundle)
+	}
+	if product.BundleDiscountPercent < 0 || product.BundleDiscountPercent >= 100 {
+		return fmt.Errorf("%w: bundle_discount_percent must be between 0 and 99", ErrInvalidBundle)
+	}
+	if product.BundleDiscountPercent > 0 && (product.SalePrice != nil || product.Price != 0) {
+		return fmt.Errorf("%w: a discounted bundle is priced from its components; leave price and sale_price empty", ErrInvalidBundle)
+	}
+	// Bundle stock lives on the components
+	product.StockQuantity = 0
+
+	ids := make([]string, len(product.Components))
+	for i, c := range product.Components {
+		ids[i] = c.ProductID
+	}
+	found, err := s.repo.GetByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]*Product, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+	seen := make(map[string]bool, len(product.Components))
+	for i := range product.Components {
+		c := &product.Components[i]
+		key := c.ProductID + "/" + c.VariantID
+		if seen[key] {
+			return fmt.Errorf("%w: component %s is listed twice", ErrInvalidBundle, key)
+		}
+		seen[key] = true
+		if c.Quantity <= 0 {
+			return fmt.Errorf("%w: component quantities must be at least 1", ErrInvalidBundle)
+		}
+		component := byID[c.ProductID]
+		if component == nil || c.ProductID == product.ID {
+			return fmt.Errorf("%w: component product %s not found", ErrInvalidBundle, c.ProductID)
+		}
+		if component.IsBundle() {
+			return fmt.Errorf("%w: bundles cannot contain bundles", ErrInvalidBundle)
+		}
+		if component.Digital {
+			return fmt.Errorf("%w: bundles cannot contain digital products", ErrInvalidBundle)
+		}
+		hasVariants, variantFound := false, false
+		for _, v := range component.Variants {
+			if v.IsActive {
+				hasVariants = true
+				variantFound = variantFound || v.ID == c.VariantID
+			}
+		}
+		if c.VariantID == "" && hasVariants {
+			return fmt.Errorf("%w: component %s has variants; choose one", ErrInvalidBundle, c.ProductID)
+		}
+		if c.VariantID != "" && !variantFound {
+			return fmt.Errorf("%w: variant %s not found on %s", ErrInvalidBundle, c.VariantID, c.ProductID)
+		}
+	}
+	return nil
+}
+
+// withComponents preloads bundle components with their products, which price and stock them
+func withComponents(db *gorm.DB) *gorm.DB {
+	return db.Preload("Components", orderedComponents).Preload("Components.Product").Preload("Components.Product.Variants")
+}
+
+func orderedComponents(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+func (r *productRepository) CountBundlesContaining(ctx context.Context, productID string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&BundleComponent{}).
+		Joins("JOIN products b ON b.id = product_bundle_components.bundle_id AND b.deleted_at IS NULL").
+		Where("product_bundle_components.product_id = ?", productID).Count(&count).Error
+	return count, err
+}
+
+// syncComponents replaces the stored components of a bundle. Orders keep their own copy of the
+// composition, so nothing refers to component rows.
+func syncComponents(tx *gorm.DB, bundleID string, components []BundleComponent) error {
+	if err := tx.Where("bundle_id = ?", bundleID).Delete(&BundleComponent{}).Error; err != nil {
+		return err
+	}
+	for i, c := range components {
+		c.ID = 0
+		c.BundleID = bundleID
+		c.Position = i
+		c.Product = nil
+		if err := tx.Create(&c).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package products
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ecommerce-backend/common/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// CatalogChannel is the Postgres notification channel raised by any write to catalogue tables
+const CatalogChannel = "catalog_changed"
+
+// catalogTables feed the cached responses; stock reservations and category renames write to
+// them too, so the triggers catch every change whoever makes it
+var catalogTables = []string{"products", "product_variants", "product_images", "product_relations", "product_bundle_components",
+	"product_translations"}
+
+// InstallChangeNotifications creates statement-level triggers that NOTIFY CatalogChannel.
+// Notifications are delivered on commit, so listeners never see uncommitted data.
+func InstallChangeNotifications(db *gorm.DB) error {
+	err := db.Exec(`CREATE OR REPLACE FUNCTION notify_catalog_changed() RETURNS trigger AS $$
+BEGIN
+	PERFORM pg_notify('` + CatalogChannel + `', TG_TABLE_NAME);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`).Error
+	if err != nil {
+		return err
+	}
+	for _, table := range catalogTables {
+		if err := db.Exec("DROP TRIGGER IF EXISTS catalog_changed ON " + table).Error; err != nil {
+			return err
+		}
+		err := db.Exec("CREATE TRIGGER catalog_changed AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON " + table +
+			" FOR EACH STATEMENT EXECUTE FUNCTION notify_catalog_changed()").Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type cachedResponse struct {
+	status     int
+	body       []byte
+	etag       string
+	header     http.Header
+	insertedAt time.Time
+}
+
+// ResponseCache keeps rendered public catalogue responses until the catalogue changes. Entries
+// also expire after ttl because sale and publishing windows open without any write.
+type ResponseCache struct {
+	mu         sync.RWMutex
+	entries    map[string]*cachedResponse
+	generation uint64
+	ttl        time.Duration
+	maxEntries int
+}
+
+func NewResponseCache(ttl time.Duration, maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		entries:    make(map[string]*cachedResponse),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+	}
+}
+
+func (c *ResponseCache) get(key string) (*cachedResponse, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.insertedAt) > c.ttl {
+		return nil, c.generation
+	}
+	return entry, c.generation
+}
+
+// set stores entry unless the cache was cleared since generation was read, which would mean the
+// entry may predate the change
+func (c *ResponseCache) set(key string, entry *cachedResponse, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if len(c.entries) >= c.maxEntries {
+		c.entries = make(map[string]*cachedResponse)
+	}
+	c.entries[key] = entry
+}
+
+// Clear drops every entry
+func (c *ResponseCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*cachedResponse)
+	c.generation++
+}
+
+// bufferedWriter holds the handler's response so headers can still be set after it ran
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+// cachedHeaders are the response headers replayed from cache; the rest come from middleware
+var cachedHeaders = []string{"Content-Type", "X-Total-Count"}
+
+// cacheKey identifies a request by path, query, ignoring parameter order, and the locales it accepts
+func cacheKey(ctx *gin.Context) string {
+	return ctx.Request.URL.Path + "?" + ctx.Request.URL.Query().Encode() + "#" + strings.Join(PreferredLocales(ctx), ",")
+}
+
+// Cached serves GET responses from cache with strong ETags and answers matching If-None-Match
+// with 304. Admin requests see inactive products, so they bypass the cache and are not stored.
+func (c *ResponseCache) Cached() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if middleware.IsAdminRequest(ctx) {
+			ctx.Header("Cache-Control", "private, no-store")
+			ctx.Next()
+			return
+		}
+		key := cacheKey(ctx)
+		entry, generation := c.get(key)
+		if entry == nil {
+			original := ctx.Writer
+			buffered := &bufferedWriter{ResponseWriter: original, status: http.StatusOK}
+			ctx.Writer = buffered
+			ctx.Next()
+			ctx.Writer = original
+
+			sum := sha256.Sum256(buffered.body.Bytes())
+			entry = &cachedResponse{
+				status:     buffered.status,
+				body:       buffered.body.Bytes(),
+				etag:       `"` + hex.EncodeToString(sum[:16]) + `"`,
+				header:     make(http.Header),
+				insertedAt: time.Now(),
+			}
+			for _, name := range cachedHeaders {
+				if value := original.Header().Get(name); value != "" {
+					entry.header.Set(name, value)
+				}
+			}
+			if entry.status != http.StatusOK {
+				original.WriteHeader(entry.status)
+				_, _ = original.Write(entry.body)
+				return
+			}
+			c.set(key, entry, generation)
+		} else {
+			ctx.Abort()
+			for name, values := range entry.header {
+				ctx.Writer.Header()[name] = values
+			}
+		}
+
+		// Clients may reuse a response only after revalidating it, which is cheap with the ETag
+		ctx.Header("Cache-Control", "public, no-cache")
+		ctx.Header("Vary", "Accept-Language")
+		ctx.Header("ETag", entry.etag)
+		if etagMatches(ctx.GetHeader("If-None-Match"), entry.etag) {
+			ctx.Writer.WriteHeader(http.StatusNotModified)
+			ctx.Writer.WriteHeaderNow()
+			return
+		}
+		ctx.Writer.WriteHeader(entry.status)
+		_, _ = ctx.Writer.Write(entry.body)
+	}
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheListener clears a ResponseCache whenever any instance commits a catalogue write
+type CacheListener struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewCacheListener holds one dedicated connection LISTENing on CatalogChannel, reconnecting
+// after failures. The cache is cleared after every reconnect since notifications may have been missed.
+func NewCacheListener(dsn string, cache *ResponseCache) *CacheListener {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &CacheListener{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(l.done)
+		for {
+			if err := listen(ctx, dsn, cache); err != nil && ctx.Err() == nil {
+				logrus.Warnf("Catalog cache listener disconnected: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}()
+	return l
+}
+
+func listen(ctx context.Context, dsn string, cache *ResponseCache) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+CatalogChannel); err != nil {
+		return err
+	}
+	cache.Clear()
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		cache.Clear()
+	}
+}
+
+// Stop closes the listening connection
+func (l *CacheListener) Stop() {
+	l.cancel()
+	<-l.done
+}
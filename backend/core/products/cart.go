@@ -0,0 +1,107 @@
+package products
+
+import "time"
+
+// CartLine is an item as the shopper's cart remembers it
+type CartLine struct {
+	ProductID string `json:"product_id" validate:"required"`
+	VariantID string `json:"variant_id"`
+	Quantity  int    `json:"quantity" validate:"gte=1"`
+	Price     int    `json:"price"`   // unit price the cart shows
+	Version   int    `json:"version"` // product version the cart was filled from; 0 skips the check
+}
+
+// Changes reported for a cart line
+const (
+	CartChangeRemoved        = "removed"         // deleted, inactive or outside its publishing window
+	CartChangeVariantRemoved = "variant_removed" // the variant is gone or inactive
+	CartChangeVariantNeeded  = "variant_needed"  // the product has variants and the line names none
+	CartChangePrice          = "price"           // current_price differs from the cart's price
+	CartChangeOutOfStock     = "out_of_stock"
+	CartChangeQuantity       = "quantity" // fewer units available than requested
+	CartChangeUpdated        = "updated"  // other product details changed; refetch before showing them
+)
+
+type CartLineStatus struct {
+	ProductID    string   `json:"product_id"`
+	VariantID    string   `json:"variant_id,omitempty"`
+	Quantity     int      `json:"quantity"`
+	Active       bool     `json:"active"`
+	CurrentPrice int      `json:"current_price"`
+	InStock      bool     `json:"in_stock"`
+	Available    int      `json:"available"`
+	Version      int      `json:"version"`
+	Changes      []string `json:"changes"`
+}
+
+// CartValidation answers for each line in request order. Valid is true when no line changed.
+type CartValidation struct {
+	Valid bool             `json:"valid"`
+	Items []CartLineStatus `json:"items"`
+}
+
+// ValidateCart compares cart lines with the current products, keyed by ID. Products missing from
+// the map are treated as removed.
+func ValidateCart(lines []CartLine, products map[string]*Product, now time.Time) *CartValidation {
+	result := &CartValidation{Valid: true, Items: make([]CartLineStatus, 0, len(lines))}
+	for _, line := range lines {
+		status := validateCartLine(line, products[line.ProductID], now)
+		if len(status.Changes) > 0 {
+			result.Valid = false
+		}
+		result.Items = append(result.Items, status)
+	}
+	return result
+}
+
+func validateCartLine(line CartLine, product *Product, now time.Time) CartLineStatus {
+	status := CartLineStatus{
+		ProductID: line.ProductID,
+		VariantID: line.VariantID,
+		Quantity:  line.Quantity,
+		Changes:   make([]string, 0),
+	}
+	if product == nil || !product.IsVisible(now) {
+		status.Changes = append(status.Changes, CartChangeRemoved)
+		return status
+	}
+	status.Version = product.Version
+
+	price, available, inStock := product.PriceAt(now), product.Available(), true
+	if line.VariantID == "" && product.HasActiveVariants() {
+		status.Changes = append(status.Changes, CartChangeVariantNeeded)
+		return status
+	}
+	if line.VariantID != "" {
+		var variant *ProductVariant
+		for i := range product.Variants {
+			if product.Variants[i].ID == line.VariantID && product.Variants[i].IsActive {
+				variant = &product.Variants[i]
+				break
+			}
+		}
+		if variant == nil {
+			status.Changes = append(status.Changes, CartChangeVariantRemoved)
+			return status
+		}
+		price, available, inStock = variant.PriceAt(now), variant.Available(), variant.InStock
+	}
+
+	status.Active = true
+	status.CurrentPrice = price
+	status.Available = available
+	status.InStock = inStock && (available > 0 || !product.TracksStock())
+	if price != line.Price {
+		status.Changes = append(status.Changes, CartChangePrice)
+	}
+	switch {
+	case !status.InStock:
+		status.Changes = append(status.Changes, CartChangeOutOfStock)
+	case available < line.Quantity && product.TracksStock():
+		status.Changes = append(status.Changes, CartChangeQuantity)
+	}
+	if line.Version != 0 && line.Version != product.Version {
+		status.Changes = append(status.Changes, CartChangeUpdated)
+	}
+	return status
+}
@@ -6,7 +6,7 @@ import (
 	"time"
 )
 
-// CartInvalidation stores a single hash key that changes whenever any product is modified
+// CartInvalidation stores the global cart hash of clients that do not send their cart's products
 type CartInvalidation struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	HashKey   string    `gorm:"unique;not null" json:"hash_key"`
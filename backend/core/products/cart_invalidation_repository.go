@@ -2,6 +2,10 @@ package products
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
 	"gorm.io/gorm"
 )
 
@@ -9,6 +13,9 @@ type CartInvalidationRepository interface {
 	GetCurrentHash(ctx context.Context) (string, error)
 	InvalidateCart(ctx context.Context) (string, error)
 	InitializeHash(ctx context.Context) error
+	// GetProductsHash returns a hash that changes whenever one of the products is written,
+	// deleted or restored, and only then
+	GetProductsHash(ctx context.Context, productIDs []string) (string, error)
 }
 
 type cartInvalidationRepository struct {
@@ -74,3 +81,32 @@ func (r *cartInvalidationRepository) InitializeHash(ctx context.Context) error {
 	}
 	return nil
 }
+
+// GetProductsHash hashes the version of each product, which every product write bumps. Stock
+// reservations and commits leave the version alone, so sales do not empty carts; cart validation
+// reports stock per line instead. Products that do not exist hash as version 0.
+func (r *cartInvalidationRepository) GetProductsHash(ctx context.Context, productIDs []string) (string, error) {
+	var rows []struct {
+		ID      string
+		Version int
+	}
+	err := r.db.WithContext(ctx).Unscoped().Model(&Product{}).Select("id", "version").
+		Where("id IN ?", productIDs).Find(&rows).Error
+	if err != nil {
+		return "", err
+	}
+	versions := make(map[string]int, len(rows))
+	for _, row := range rows {
+		versions[row.ID] = row.Version
+	}
+	ids := append([]string(nil), productIDs...)
+	sort.Strings(ids)
+	h := sha256.New()
+	for i, id := range ids {
+		if i > 0 && id == ids[i-1] {
+			continue
+		}
+		fmt.Fprintf(h, "%s:%d;", id, versions[id])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
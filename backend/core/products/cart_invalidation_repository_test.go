@@ -0,0 +1,53 @@
+package products
+
+import (
+	"context"
+	"testing"
+)
+
+// The cart hash follows writes to the cart's products only; sales leave it alone
+func TestGetProductsHash(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	db := repo.(*productRepository).db
+	hashes := NewCartInvalidationRepository(db)
+	for _, p := range []*Product{
+		{ID: "p1", Name: "Tee", Slug: "tee", IsActive: true, StockQuantity: 5},
+		{ID: "p2", Name: "Mug", Slug: "mug", IsActive: true, StockQuantity: 5},
+	} {
+		if err := repo.Create(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash := func(ids ...string) string {
+		t.Helper()
+		h, err := hashes.GetProductsHash(ctx, ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	before := hash("p1", "missing")
+	if got := hash("missing", "p1", "p1"); got != before {
+		t.Errorf("hash depends on order and repeats: %s, want %s", got, before)
+	}
+	if err := NewStockRepository(db).Reserve(ctx, []StockLine{{ProductID: "p1", Quantity: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := hash("p1", "missing"); got != before {
+		t.Errorf("hash after a reservation = %s, want the unchanged %s", got, before)
+	}
+	if err := repo.Update(ctx, &Product{ID: "p2", Name: "Big mug", Slug: "mug", IsActive: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := hash("p1", "missing"); got != before {
+		t.Errorf("hash after writing another product = %s, want the unchanged %s", got, before)
+	}
+	if err := repo.Update(ctx, &Product{ID: "p1", Name: "Tee", Slug: "tee", Price: 900, IsActive: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := hash("p1", "missing"); got == before {
+		t.Errorf("hash after writing the product is unchanged %s", got)
+	}
+}
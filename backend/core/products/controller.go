@@ -3,8 +3,15 @@ package products
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"ecommerce-backend/common/middleware"
 	"github.com/gin-gonic/gin"
@@ -14,6 +21,7 @@ import (
 type ProductController struct {
 	service   ProductService
 	validator *validator.Validate
+	cache     *ResponseCache
 }
 
 func NewProductController(s ProductService) *ProductController {
@@ -23,37 +31,217 @@ func NewProductController(s ProductService) *ProductController {
 	}
 }
 
+// NewProductControllerWithCache serves public catalogue reads through cache
+func NewProductControllerWithCache(s ProductService, cache *ResponseCache) *ProductController {
+	return &ProductController{
+		service:   s,
+		validator: validator.New(),
+		cache:     cache,
+	}
+}
+
+func (c *ProductController) cached() gin.HandlerFunc {
+	if c.cache == nil {
+		return func(ctx *gin.Context) { ctx.Next() }
+	}
+	return c.cache.Cached()
+}
+
 type ProductRequest struct {
-	ID          string              `json:"id"`
-	Name        string              `json:"name" validate:"required"`
-	Category    string              `json:"category"`
-	Description string              `json:"description"`
-	Price       int                 `json:"price"`
+	ID          string `json:"id"`
+	Name        string `json:"name" validate:"required"`
+	Slug        string `json:"slug"` // generated from the name when empty; updates keep the current slug
+	CategoryID  string `json:"category_id"`
+	Category    string `json:"category"` // category slug, accepted when category_id is empty
+	Description string `json:"description"`
+	Price       int    `json:"price"`
+	SalePricing
 	Featured    bool                `json:"featured"`
 	IsActive    bool                `json:"is_active"`
+	Digital     bool                `json:"digital"`
+	Stock       int                 `json:"stock_quantity" validate:"gte=0"`
+	PublishAt   *time.Time          `json:"publish_at"`
+	UnpublishAt *time.Time          `json:"unpublish_at"`
 	Images      []string            `json:"images"`
-	Variants    []ProductVariantReq `json:"variants"`
+	Options     []ProductOption     `json:"options"`
+	Variants    []ProductVariantReq `json:"variants" validate:"dive"`
+	// Bundles only; see BundleComponent
+	Type                  string               `json:"type" validate:"omitempty,oneof=simple bundle"`
+	BundleDiscountPercent int                  `json:"bundle_discount_percent" validate:"gte=0,lt=100"`
+	Components            []BundleComponentReq `json:"components" validate:"dive"`
+	// Overrides the global stock alert threshold; null uses it
+	LowStockThreshold *int `json:"low_stock_threshold" validate:"omitempty,gte=0"`
+	// Empty uses TaxClassStandard
+	TaxClass string `json:"tax_class" validate:"omitempty,max=32"`
+	// Parcel size of one unit, for shipping rates
+	WeightGrams int `json:"weight_grams" validate:"gte=0"`
+	LengthMM    int `json:"length_mm" validate:"gte=0"`
+	WidthMM     int `json:"width_mm" validate:"gte=0"`
+	HeightMM    int `json:"height_mm" validate:"gte=0"`
+	unsent      map[string]bool
+}
+
+// Optional fields an update leaves as stored when the request does not send them, so clients that
+// predate them do not wipe them. Each is named as in the request and as its column.
+var (
+	optionalProductFields = []string{
+		"stock_quantity", "compare_at_price", "sale_price", "sale_starts_at", "sale_ends_at",
+		"digital", "publish_at", "unpublish_at", "options", "type", "bundle_discount_percent", "components",
+		"low_stock_threshold", "tax_class", "weight_grams", "length_mm", "width_mm", "height_mm",
+	}
+	optionalVariantFields = []string{"stock_quantity", "compare_at_price", "sale_price", "sale_starts_at", "sale_ends_at"}
+)
+
+func (req *ProductRequest) UnmarshalJSON(data []byte) error {
+	type plain ProductRequest
+	if err := json.Unmarshal(data, (*plain)(req)); err != nil {
+		return err
+	}
+	var err error
+	req.unsent, err = unsentFields(data, optionalProductFields)
+	return err
+}
+
+// unsentFields lists the optional fields the JSON object leaves out
+func unsentFields(data []byte, optional []string) (map[string]bool, error) {
+	var sent map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sent); err != nil {
+		return nil, err
+	}
+	unsent := make(map[string]bool)
+	for _, field := range optional {
+		if _, ok := sent[field]; !ok {
+			unsent[field] = true
+		}
+	}
+	return unsent, nil
+}
+
+type BundleComponentReq struct {
+	ProductID string `json:"product_id" validate:"required"`
+	VariantID string `json:"variant_id"`
+	Quantity  int    `json:"quantity" validate:"gte=1"`
 }
 
 type ProductVariantReq struct {
 	ID         string              `json:"id"`
-	SKU        string              `json:"sku"`
+	SKU        string              `json:"sku" validate:"required"`
 	Attributes []map[string]string `json:"attributes"`
 	Image      string              `json:"image_url"`
 	Price      int                 `json:"price"`
-	InStock    bool                `json:"in_stock"`
-	IsActive   bool                `json:"is_active"`
+	SalePricing
+	InStock  bool `json:"in_stock"`
+	IsActive bool `json:"is_active"`
+	Stock    int  `json:"stock_quantity" validate:"gte=0"`
+	unsent   map[string]bool
+}
+
+func (req *ProductVariantReq) UnmarshalJSON(data []byte) error {
+	type plain ProductVariantReq
+	if err := json.Unmarshal(data, (*plain)(req)); err != nil {
+		return err
+	}
+	var err error
+	req.unsent, err = unsentFields(data, optionalVariantFields)
+	return err
+}
+
+// toProduct converts the request into a model; id overrides the request ID when set
+func (req ProductRequest) toProduct(id string) *Product {
+	if id == "" {
+		id = req.ID
+	}
+	product := &Product{
+		ID:            id,
+		Name:          req.Name,
+		Slug:          req.Slug,
+		CategoryID:    req.CategoryID,
+		Category:      req.Category,
+		Description:   req.Description,
+		Price:         req.Price,
+		SalePricing:   req.SalePricing,
+		Featured:      req.Featured,
+		IsActive:      req.IsActive,
+		Digital:       req.Digital,
+		StockQuantity: req.Stock,
+		PublishAt:     req.PublishAt,
+		UnpublishAt:   req.UnpublishAt,
+		Type:          req.Type,
+		unsent:        req.unsent,
+	}
+	if product.Type == "" {
+		product.Type = ProductTypeSimple
+	}
+	product.BundleDiscountPercent = req.BundleDiscountPercent
+	product.LowStockThreshold = req.LowStockThreshold
+	product.TaxClass = strings.ToLower(strings.TrimSpace(req.TaxClass))
+	if product.TaxClass == "" {
+		product.TaxClass = TaxClassStandard
+	}
+	product.WeightGrams = req.WeightGrams
+	product.LengthMM, product.WidthMM, product.HeightMM = req.LengthMM, req.WidthMM, req.HeightMM
+	for i, c := range req.Components {
+		product.Components = append(product.Components, BundleComponent{
+			BundleID:  id,
+			ProductID: c.ProductID,
+			VariantID: c.VariantID,
+			Quantity:  c.Quantity,
+			Position:  i,
+		})
+	}
+	if len(req.Options) > 0 {
+		product.Options, _ = json.Marshal(req.Options)
+	}
+	for i, img := range req.Images {
+		product.Images = append(product.Images, ProductImage{ImageURL: img, ProductID: id, Position: i})
+	}
+	for _, v := range req.Variants {
+		attrJSON, _ := json.Marshal(v.Attributes)
+		product.Variants = append(product.Variants, ProductVariant{
+			ID:            v.ID,
+			SKU:           v.SKU,
+			Attributes:    attrJSON,
+			ImageURL:      v.Image,
+			Price:         v.Price,
+			SalePricing:   v.SalePricing,
+			InStock:       v.InStock,
+			IsActive:      v.IsActive,
+			ProductID:     id,
+			StockQuantity: v.Stock,
+			unsent:        v.unsent,
+		})
+	}
+	return product
 }
 
 func (c *ProductController) RegisterRoutes(r *gin.Engine) {
 	group := r.Group("/products")
 	// Register specific routes before parameterized routes to avoid conflicts
 	group.GET("/cart/hash", c.GetCartHash)
+	group.POST("/cart/validate", c.ValidateCart)
+	group.GET("/search", c.cached(), c.SearchProducts)
+	group.GET("/by-slug/:slug", c.cached(), c.GetProductBySlug)
+	group.GET("/export", middleware.AdminKeyMiddleware(), c.ExportProducts)
+	group.POST("/import", middleware.AdminKeyMiddleware(), c.ImportProducts)
+	group.GET("/deleted", middleware.AdminKeyMiddleware(), c.ListDeletedProducts)
+	group.GET("/stock-alerts", middleware.AdminKeyMiddleware(), c.ListStockAlerts)
+	group.POST("/stock-alerts/:alert_id/acknowledge", middleware.AdminKeyMiddleware(), c.AcknowledgeStockAlert)
+	group.POST(":id/variants/generate", middleware.AdminKeyMiddleware(), c.GenerateVariants)
+	group.GET(":id/prices", middleware.AdminKeyMiddleware(), c.PriceHistory)
+	group.GET(":id/related", c.cached(), c.RelatedProducts)
+	group.POST(":id/restore", middleware.AdminKeyMiddleware(), c.RestoreProduct)
+	group.GET(":id/revisions", middleware.AdminKeyMiddleware(), c.ListRevisions)
+	group.GET(":id/translations", middleware.AdminKeyMiddleware(), c.ListTranslations)
+	group.PUT(":id/translations/:locale", middleware.AdminKeyMiddleware(), c.SaveTranslation)
+	group.DELETE(":id/translations/:locale", middleware.AdminKeyMiddleware(), c.DeleteTranslation)
+	group.GET(":id/revisions/diff", middleware.AdminKeyMiddleware(), c.DiffRevisions)
+	group.GET(":id/revisions/:revision", middleware.AdminKeyMiddleware(), c.GetRevision)
+	group.POST(":id/revisions/:revision/rollback", middleware.AdminKeyMiddleware(), c.RollbackProduct)
 	group.POST("", middleware.AdminKeyMiddleware(), c.CreateProduct)
 	group.PUT(":id", middleware.AdminKeyMiddleware(), c.UpdateProduct)
 	group.DELETE(":id", middleware.AdminKeyMiddleware(), c.DeleteProduct)
-	group.GET(":id", c.GetProduct)
-	group.GET("", c.ListProducts)
+	group.GET(":id", c.cached(), c.GetProduct)
+	group.GET("", c.cached(), c.ListProducts)
 }
 
 func (c *ProductController) CreateProduct(ctx *gin.Context) {
@@ -66,33 +254,10 @@ func (c *ProductController) CreateProduct(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	product := &Product{
-		ID:          req.ID,
-		Name:        req.Name,
-		Category:    req.Category,
-		Description: req.Description,
-		Price:       req.Price,
-		Featured:    req.Featured,
-		IsActive:    req.IsActive,
-	}
-	for _, img := range req.Images {
-		product.Images = append(product.Images, ProductImage{ImageURL: img})
-	}
-	for _, v := range req.Variants {
-		attrJSON, _ := json.Marshal(v.Attributes)
-		product.Variants = append(product.Variants, ProductVariant{
-			ID:         v.ID,
-			SKU:        v.SKU,
-			Attributes: attrJSON,
-			ImageURL:   v.Image,
-			Price:      v.Price,
-			InStock:    v.InStock,
-			IsActive:   v.IsActive,
-		})
-	}
+	product := req.toProduct("")
 	id, err := c.service.CreateProduct(context.Background(), product)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"id": id})
@@ -109,34 +274,9 @@ func (c *ProductController) UpdateProduct(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	product := &Product{
-		ID:          id,
-		Name:        req.Name,
-		Category:    req.Category,
-		Description: req.Description,
-		Price:       req.Price,
-		Featured:    req.Featured,
-		IsActive:    req.IsActive,
-	}
-
-	for _, img := range req.Images {
-		product.Images = append(product.Images, ProductImage{ImageURL: img, ProductID: id})
-	}
-	for _, v := range req.Variants {
-		attrJSON, _ := json.Marshal(v.Attributes)
-		product.Variants = append(product.Variants, ProductVariant{
-			ID:         v.ID,
-			SKU:        v.SKU,
-			Attributes: attrJSON,
-			ImageURL:   v.Image,
-			Price:      v.Price,
-			InStock:    v.InStock,
-			IsActive:   v.IsActive,
-			ProductID:  id,
-		})
-	}
+	product := req.toProduct(id)
 	if err := c.service.UpdateProduct(context.Background(), product); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"id": id})
@@ -145,12 +285,183 @@ func (c *ProductController) UpdateProduct(ctx *gin.Context) {
 func (c *ProductController) DeleteProduct(ctx *gin.Context) {
 	id := ctx.Param("id")
 	if err := c.service.DeleteProduct(context.Background(), id); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deleted": true})
+}
+
+// ListDeletedProducts returns soft-deleted products, most recently deleted first
+func (c *ProductController) ListDeletedProducts(ctx *gin.Context) {
+	products, err := c.service.ListDeletedProducts(context.Background())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	responses := make([]gin.H, 0, len(products))
+	for _, p := range products {
+		responses = append(responses, gin.H{"product": TransformProductToResponse(&p), "deleted_at": p.DeletedAt.Time})
+	}
+	ctx.JSON(http.StatusOK, responses)
+}
+
+// GenerateVariants replaces the variants with the option matrix; ?dry_run=true only previews it
+func (c *ProductController) GenerateVariants(ctx *gin.Context) {
+	var matrix VariantMatrix
+	if err := ctx.ShouldBindJSON(&matrix); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(matrix); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(ctx.DefaultQuery("dry_run", "false"))
+	product, err := c.service.GenerateVariants(context.Background(), ctx.Param("id"), matrix, dryRun)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, TransformProductToResponse(product))
+}
+
+// ListStockAlerts returns open stock alerts, newest first; ?all=true includes acknowledged ones
+func (c *ProductController) ListStockAlerts(ctx *gin.Context) {
+	skip, _ := strconv.Atoi(ctx.DefaultQuery("skip", "0"))
+	take, _ := strconv.Atoi(ctx.DefaultQuery("take", "50"))
+	if skip < 0 {
+		skip = 0
+	}
+	if take <= 0 || take > 200 {
+		take = 50
+	}
+	all, _ := strconv.ParseBool(ctx.Query("all"))
+	alerts, total, err := c.service.ListStockAlerts(context.Background(), all, skip, take)
+	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	ctx.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	ctx.JSON(http.StatusOK, alerts)
+}
+
+func (c *ProductController) AcknowledgeStockAlert(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("alert_id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "alert id must be a number"})
+		return
+	}
+	if err := c.service.AcknowledgeStockAlert(context.Background(), uint(id)); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"acknowledged": true})
+}
+
+// PriceHistory lists every recorded pricing change of the product and its variants, newest first
+func (c *ProductController) PriceHistory(ctx *gin.Context) {
+	history, err := c.service.PriceHistory(context.Background(), ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, history)
+}
+
+func (c *ProductController) RestoreProduct(ctx *gin.Context) {
+	if err := c.service.RestoreProduct(context.Background(), ctx.Param("id")); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"restored": true})
+}
+
+func (c *ProductController) ListRevisions(ctx *gin.Context) {
+	revisions, err := c.service.ListRevisions(context.Background(), ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, revisions)
+}
+
+func (c *ProductController) GetRevision(ctx *gin.Context) {
+	revision, err := strconv.Atoi(ctx.Param("revision"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "revision must be a number"})
+		return
+	}
+	rev, err := c.service.GetRevision(context.Background(), ctx.Param("id"), revision)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, rev)
+}
+
+// DiffRevisions compares ?from=<revision> with ?to=<revision>
+func (c *ProductController) DiffRevisions(ctx *gin.Context) {
+	from, errFrom := strconv.Atoi(ctx.Query("from"))
+	to, errTo := strconv.Atoi(ctx.Query("to"))
+	if errFrom != nil || errTo != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be revision numbers"})
+		return
+	}
+	diff, err := c.service.DiffRevisions(context.Background(), ctx.Param("id"), from, to)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, diff)
+}
+
+// ListTranslations returns the product's translations, one per locale
+func (c *ProductController) ListTranslations(ctx *gin.Context) {
+	translations, err := c.service.ListTranslations(context.Background(), ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, translations)
+}
+
+// SaveTranslation creates or replaces the product's translation into :locale
+func (c *ProductController) SaveTranslation(ctx *gin.Context) {
+	var req TranslationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	translation, err := c.service.SaveTranslation(context.Background(), ctx.Param("id"), ctx.Param("locale"), req)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, translation)
+}
+
+func (c *ProductController) DeleteTranslation(ctx *gin.Context) {
+	if err := c.service.DeleteTranslation(context.Background(), ctx.Param("id"), ctx.Param("locale")); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
 	ctx.JSON(http.StatusOK, gin.H{"deleted": true})
 }
 
+func (c *ProductController) RollbackProduct(ctx *gin.Context) {
+	revision, err := strconv.Atoi(ctx.Param("revision"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "revision must be a number"})
+		return
+	}
+	product, err := c.service.RollbackProduct(context.Background(), ctx.Param("id"), revision)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, TransformProductToResponse(product))
+}
+
 func (c *ProductController) GetProduct(ctx *gin.Context) {
 	id := ctx.Param("id")
 	product, err := c.service.GetProductByID(context.Background(), id)
@@ -158,47 +469,313 @@ func (c *ProductController) GetProduct(ctx *gin.Context) {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 		return
 	}
-	
-	isAdmin := ctx.GetHeader("X-Admin-API-Key") != "" || ctx.Query("admin_key") != ""
-	if !isAdmin && !product.IsActive {
+
+	if !middleware.IsAdminRequest(ctx) && !product.IsVisible(time.Now()) {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 		return
 	}
-	
-	resp := TransformProductToResponse(product)
+
+	c.respondLocalized(ctx, product)
+}
+
+// GetProductBySlug answers like GetProduct. Old slugs redirect permanently to the current one.
+func (c *ProductController) GetProductBySlug(ctx *gin.Context) {
+	product, current, err := c.service.GetProductBySlug(context.Background(), ctx.Param("slug"))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if current != "" {
+		// Kept relative to the requested path, unlike ctx.Redirect, so it works behind a path prefix
+		location := url.PathEscape(current)
+		if ctx.Request.URL.RawQuery != "" {
+			location += "?" + ctx.Request.URL.RawQuery
+		}
+		ctx.Header("Location", location)
+		ctx.JSON(http.StatusMovedPermanently, gin.H{"slug": current})
+		return
+	}
+
+	if !middleware.IsAdminRequest(ctx) && !product.IsVisible(time.Now()) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	c.respondLocalized(ctx, product)
+}
+
+// respondLocalized writes product in the best locale the request accepts
+func (c *ProductController) respondLocalized(ctx *gin.Context, product *Product) {
+	resps := []ProductResponse{TransformProductToResponse(product)}
+	if err := c.service.Localize(context.Background(), resps, PreferredLocales(ctx)); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Header("Content-Language", resps[0].Locale)
+	ctx.JSON(http.StatusOK, resps[0])
+}
+
+// RelatedProducts returns products frequently bought together with this one
+func (c *ProductController) RelatedProducts(ctx *gin.Context) {
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "8"))
+	if limit <= 0 || limit > relatedPerProduct {
+		limit = 8
+	}
+	related, err := c.service.RelatedProducts(context.Background(), ctx.Param("id"), limit)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	resp := make([]ProductResponse, len(related))
+	for i := range related {
+		resp[i] = TransformProductToResponse(&related[i])
+	}
+	if err := c.service.Localize(context.Background(), resp, PreferredLocales(ctx)); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	ctx.JSON(http.StatusOK, resp)
 }
 
+// ListProducts returns a plain array for existing clients; it accepts the same filters as SearchProducts
 func (c *ProductController) ListProducts(ctx *gin.Context) {
-	skip, _ := strconv.Atoi(ctx.DefaultQuery("skip", "0"))
-	take, _ := strconv.Atoi(ctx.DefaultQuery("take", "10"))
-	products, _, err := c.service.PaginatedListProducts(context.Background(), skip, take)
+	filter, err := parseProductFilter(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	products, total, err := c.service.SearchProducts(context.Background(), filter)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
-	
-	isAdmin := ctx.GetHeader("X-Admin-API-Key") != "" || ctx.Query("admin_key") != ""
-	
-	responses := make([]ProductResponse, 0)
+
+	responses := make([]ProductResponse, 0, len(products))
 	for _, p := range products {
-		if !isAdmin && !p.IsActive {
-			continue
-		}
 		responses = append(responses, TransformProductToResponse(&p))
 	}
+	if err := c.service.Localize(context.Background(), responses, PreferredLocales(ctx)); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Header("X-Total-Count", strconv.FormatInt(total, 10))
 	ctx.JSON(http.StatusOK, responses)
 }
 
+// SearchProducts returns a page of matching products together with facet counts
+func (c *ProductController) SearchProducts(ctx *gin.Context) {
+	filter, err := parseProductFilter(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	products, total, err := c.service.SearchProducts(context.Background(), filter)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	facets, err := c.service.ProductFacets(context.Background(), filter)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	responses := make([]ProductResponse, 0, len(products))
+	for _, p := range products {
+		responses = append(responses, TransformProductToResponse(&p))
+	}
+	if err := c.service.Localize(context.Background(), responses, PreferredLocales(ctx)); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"items":  responses,
+		"total":  total,
+		"skip":   filter.Skip,
+		"take":   filter.Take,
+		"facets": facets,
+	})
+}
+
+// parseProductFilter reads q, category, min_price, max_price, featured, in_stock,
+// attr=name:value (repeatable), sort, skip and take from the query string
+func parseProductFilter(ctx *gin.Context) (ProductFilter, error) {
+	filter := ProductFilter{
+		Query:           ctx.Query("q"),
+		Category:        ctx.Query("category"),
+		Sort:            ctx.DefaultQuery("sort", SortNewest),
+		IncludeInactive: middleware.IsAdminRequest(ctx),
+	}
+	filter.Skip, _ = strconv.Atoi(ctx.DefaultQuery("skip", "0"))
+	filter.Take, _ = strconv.Atoi(ctx.DefaultQuery("take", "10"))
+	if filter.Skip < 0 {
+		filter.Skip = 0
+	}
+	if filter.Take <= 0 || filter.Take > 100 {
+		filter.Take = 10
+	}
+
+	for key, dst := range map[string]**int{"min_price": &filter.MinPrice, "max_price": &filter.MaxPrice} {
+		if raw := ctx.Query(key); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s", key)
+			}
+			*dst = &n
+		}
+	}
+	for key, dst := range map[string]**bool{"featured": &filter.Featured, "in_stock": &filter.InStock} {
+		if raw := ctx.Query(key); raw != "" {
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s", key)
+			}
+			*dst = &b
+		}
+	}
+	for _, raw := range ctx.QueryArray("attr") {
+		name, value, ok := strings.Cut(raw, ":")
+		if !ok || name == "" {
+			return filter, fmt.Errorf("invalid attr %q, expected name:value", raw)
+		}
+		if filter.Attributes == nil {
+			filter.Attributes = make(map[string][]string)
+		}
+		filter.Attributes[name] = append(filter.Attributes[name], value)
+	}
+	return filter, nil
+}
+
+// maxImportBytes bounds the size of an import upload
+const maxImportBytes = 32 << 20
+
+// ExportProducts downloads the whole catalogue, variants and images included, as ?format=csv or jsonl
+func (c *ProductController) ExportProducts(ctx *gin.Context) {
+	format := ctx.DefaultQuery("format", FormatCSV)
+	if format != FormatCSV && format != FormatJSONL {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or jsonl"})
+		return
+	}
+	products, err := c.service.ExportProducts(context.Background())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	contentType := "text/csv; charset=utf-8"
+	if format == FormatJSONL {
+		contentType = "application/x-ndjson"
+	}
+	filename := fmt.Sprintf("products-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	ctx.Status(http.StatusOK)
+	if err := WriteExport(ctx.Writer, format, products); err != nil {
+		_ = ctx.Error(err)
+	}
+}
+
+// ImportProducts upserts products from a csv or jsonl upload (multipart "file" or the raw body).
+// With ?dry_run=true only the validation report is returned. Rows are applied all or nothing.
+func (c *ProductController) ImportProducts(ctx *gin.Context) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxImportBytes)
+	format := ctx.Query("format")
+	var body io.Reader = ctx.Request.Body
+	if file, header, err := ctx.Request.FormFile("file"); err == nil {
+		defer file.Close()
+		body = file
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+		}
+	}
+	if format == "" && strings.Contains(ctx.ContentType(), "json") {
+		format = FormatJSONL
+	}
+	if format == "" {
+		format = FormatCSV
+	}
+	if format == "ndjson" {
+		format = FormatJSONL
+	}
+
+	rows, err := ParseImport(body, format)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(ctx.DefaultQuery("dry_run", "false"))
+	report, err := c.service.ImportProducts(context.Background(), rows, dryRun)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	status := http.StatusOK
+	if report.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	ctx.JSON(status, report)
+}
+
 func (c *ProductController) Name() string {
 	return "products"
 }
 
+// GetCartHash answers a hash of the cart's products, given as repeated product_id parameters.
+// It changes whenever one of them is written, so carts holding other products stay valid.
 func (c *ProductController) GetCartHash(ctx *gin.Context) {
-	hash, err := c.service.GetCartHash(context.Background())
+	ids := ctx.QueryArray("product_id")
+	if len(ids) > maxCartHashProducts {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d product_id values", maxCartHashProducts)})
+		return
+	}
+	hash, err := c.service.GetCartHash(context.Background(), ids)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"hash": hash})
 }
+
+// maxCartHashProducts matches the most lines a cart validation takes
+const maxCartHashProducts = 100
+
+type cartValidationRequest struct {
+	Items []CartLine `json:"items" validate:"required,min=1,max=100,dive"`
+}
+
+// ValidateCart reports per line what changed since the cart was filled, so clients can update
+// or drop only those lines
+func (c *ProductController) ValidateCart(ctx *gin.Context) {
+	var req cartValidationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := c.service.ValidateCart(context.Background(), req.Items)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+// errorStatus maps errors caused by the request to 4xx and everything else to 500
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnknownCategory), errors.Is(err, ErrSKURequired), errors.Is(err, ErrInvalidSchedule),
+		errors.Is(err, ErrInvalidSale), errors.Is(err, ErrInvalidOptions), errors.Is(err, ErrUnknownCombination),
+		errors.Is(err, ErrTooManyCombinations), errors.Is(err, ErrInvalidBundle), errors.Is(err, ErrEmptySlug),
+		errors.Is(err, ErrInvalidLocale), errors.Is(err, ErrDefaultLocale):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrProductNotFound), errors.Is(err, ErrRevisionNotFound), errors.Is(err, ErrTranslationNotFound),
+		errors.Is(err, ErrStockAlertNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrDuplicateSKU), errors.Is(err, ErrSKUChanged), errors.Is(err, ErrDuplicateCombination),
+		errors.Is(err, ErrSlugTaken):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,424 @@
+package products
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Catalogue exchange formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// csvHeader lists the CSV columns. Each row is one variant; product columns repeat on every
+// row of the same product. Products without variants have a single row with empty variant columns.
+var csvHeader = []string{
+	"product_id", "name", "category", "description", "price", "featured", "is_active", "stock_quantity", "images",
+	"publish_at", "unpublish_at", "compare_at_price", "sale_price", "sale_starts_at", "sale_ends_at", "options", "digital", "low_stock_threshold", "tax_class",
+	"weight_grams", "length_mm", "width_mm", "height_mm",
+	"variant_id", "sku", "attributes", "variant_image", "variant_price", "variant_in_stock", "variant_is_active", "variant_stock_quantity",
+	"variant_compare_at_price", "variant_sale_price", "variant_sale_starts_at", "variant_sale_ends_at",
+}
+
+// Separators inside CSV cells: images are "url|url", attributes are "name=value;name=value",
+// options are "name=value|value;name=value|value"
+const (
+	csvListSep  = "|"
+	csvAttrSep  = ";"
+	csvPairSep  = "="
+	jsonlMaxRow = 4 * 1024 * 1024
+)
+
+// ImportRow is one product parsed from an import file
+type ImportRow struct {
+	Line    int // first source line of the product
+	Request ProductRequest
+	Errors  []string // parse errors; rows with errors are reported and never applied
+}
+
+type ImportRowResult struct {
+	Line      int      `json:"line"`
+	ProductID string   `json:"product_id,omitempty"`
+	Name      string   `json:"name"`
+	Action    string   `json:"action"` // create or update
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// ImportReport summarises an import. Applied is false for dry runs and whenever any row failed.
+type ImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Applied bool              `json:"applied"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// ParseImport reads a whole import file in the given format
+func ParseImport(r io.Reader, format string) ([]ImportRow, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatJSONL:
+		return parseJSONL(r)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func parseJSONL(r io.Reader) ([]ImportRow, error) {
+	rows := make([]ImportRow, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), jsonlMaxRow)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		row := ImportRow{Line: line}
+		if err := json.Unmarshal([]byte(text), &row.Request); err != nil {
+			row.Errors = append(row.Errors, "invalid json: "+err.Error())
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func parseCSV(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing csv header: %w", err)
+	}
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	if _, ok := col["name"]; !ok {
+		return nil, errors.New("csv header must contain a name column")
+	}
+
+	rows := make([]ImportRow, 0)
+	// Rows of one product share product_id, or the name when the product has no ID yet
+	byKey := make(map[string]int)
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			rows = append(rows, ImportRow{Line: line, Errors: []string{err.Error()}})
+			continue
+		}
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		var errs []string
+		parseInt := func(name string) int {
+			raw := get(name)
+			if raw == "" {
+				return 0
+			}
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not an integer", name, raw))
+			}
+			return n
+		}
+		parseTime := func(name string) *time.Time {
+			raw := get(name)
+			if raw == "" {
+				return nil
+			}
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not an RFC 3339 time", name, raw))
+				return nil
+			}
+			return &t
+		}
+		parseOptionalInt := func(name string) *int {
+			if get(name) == "" {
+				return nil
+			}
+			n := parseInt(name)
+			return &n
+		}
+		parseSale := func(prefix string) SalePricing {
+			return SalePricing{
+				CompareAtPrice: parseInt(prefix + "compare_at_price"),
+				SalePrice:      parseOptionalInt(prefix + "sale_price"),
+				SaleStartsAt:   parseTime(prefix + "sale_starts_at"),
+				SaleEndsAt:     parseTime(prefix + "sale_ends_at"),
+			}
+		}
+		parseBool := func(name string, def bool) bool {
+			raw := get(name)
+			if raw == "" {
+				return def
+			}
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a boolean", name, raw))
+			}
+			return b
+		}
+
+		key := get("product_id")
+		if key == "" {
+			key = "name:" + get("name")
+		}
+		idx, seen := byKey[key]
+		if !seen {
+			req := ProductRequest{
+				ID:          get("product_id"),
+				Name:        get("name"),
+				Category:    get("category"),
+				Description: get("description"),
+				Price:       parseInt("price"),
+				SalePricing: parseSale(""),
+				Featured:    parseBool("featured", false),
+				IsActive:    parseBool("is_active", true),
+				Digital:     parseBool("digital", false),
+				Stock:       parseInt("stock_quantity"),
+				PublishAt:   parseTime("publish_at"),
+				UnpublishAt: parseTime("unpublish_at"),
+			}
+			options, err := parseCSVOptions(get("options"))
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+			req.Options = options
+			if get("low_stock_threshold") != "" {
+				threshold := parseInt("low_stock_threshold")
+				req.LowStockThreshold = &threshold
+			}
+			req.TaxClass = get("tax_class")
+			req.WeightGrams = parseInt("weight_grams")
+			req.LengthMM, req.WidthMM, req.HeightMM = parseInt("length_mm"), parseInt("width_mm"), parseInt("height_mm")
+			if images := get("images"); images != "" {
+				for _, img := range strings.Split(images, csvListSep) {
+					if img = strings.TrimSpace(img); img != "" {
+						req.Images = append(req.Images, img)
+					}
+				}
+			}
+			idx = len(rows)
+			byKey[key] = idx
+			rows = append(rows, ImportRow{Line: line, Request: req})
+		}
+
+		if get("sku") != "" || get("variant_id") != "" || get("attributes") != "" {
+			variant := ProductVariantReq{
+				ID:          get("variant_id"),
+				SKU:         get("sku"),
+				Image:       get("variant_image"),
+				Price:       parseInt("variant_price"),
+				SalePricing: parseSale("variant_"),
+				InStock:     parseBool("variant_in_stock", true),
+				IsActive:    parseBool("variant_is_active", true),
+				Stock:       parseInt("variant_stock_quantity"),
+			}
+			attrs, err := parseCSVAttributes(get("attributes"))
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+			variant.Attributes = attrs
+			rows[idx].Request.Variants = append(rows[idx].Request.Variants, variant)
+		}
+		for _, e := range errs {
+			rows[idx].Errors = append(rows[idx].Errors, fmt.Sprintf("line %d: %s", line, e))
+		}
+	}
+	return rows, nil
+}
+
+func parseCSVOptions(raw string) ([]ProductOption, error) {
+	options := make([]ProductOption, 0)
+	for _, attr := range strings.Split(raw, csvAttrSep) {
+		if strings.TrimSpace(attr) == "" {
+			continue
+		}
+		name, values, ok := strings.Cut(attr, csvPairSep)
+		if !ok || strings.TrimSpace(name) == "" {
+			return options, fmt.Errorf("options: %q is not name=value|value", attr)
+		}
+		option := ProductOption{Name: strings.TrimSpace(name)}
+		for _, value := range strings.Split(values, csvListSep) {
+			option.Values = append(option.Values, strings.TrimSpace(value))
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+func optionsCSV(options []ProductOption) string {
+	parts := make([]string, 0, len(options))
+	for _, option := range options {
+		parts = append(parts, option.Name+csvPairSep+strings.Join(option.Values, csvListSep))
+	}
+	return strings.Join(parts, csvAttrSep)
+}
+
+// thresholdCSV leaves the cell empty when the product uses the global threshold
+func thresholdCSV(threshold *int) string {
+	if threshold == nil {
+		return ""
+	}
+	return strconv.Itoa(*threshold)
+}
+
+func saleCSV(s SalePricing) []string {
+	salePrice := ""
+	if s.SalePrice != nil {
+		salePrice = strconv.Itoa(*s.SalePrice)
+	}
+	return []string{strconv.Itoa(s.CompareAtPrice), salePrice, formatCSVTime(s.SaleStartsAt), formatCSVTime(s.SaleEndsAt)}
+}
+
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseCSVAttributes(raw string) ([]map[string]string, error) {
+	attrs := make([]map[string]string, 0)
+	if raw == "" {
+		return attrs, nil
+	}
+	for _, pair := range strings.Split(raw, csvAttrSep) {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, csvPairSep)
+		if !ok || strings.TrimSpace(name) == "" {
+			return attrs, fmt.Errorf("attributes: %q is not name=value", pair)
+		}
+		attrs = append(attrs, map[string]string{"name": strings.TrimSpace(name), "value": strings.TrimSpace(value)})
+	}
+	return attrs, nil
+}
+
+// productToRequest is the inverse of ProductRequest.toProduct, used by the export
+func productToRequest(p *Product) ProductRequest {
+	req := ProductRequest{
+		ID:          p.ID,
+		Name:        p.Name,
+		CategoryID:  p.CategoryID,
+		Category:    p.Category,
+		Description: p.Description,
+		Price:       p.Price,
+		SalePricing: p.SalePricing,
+		Featured:    p.Featured,
+		IsActive:    p.IsActive,
+		Digital:     p.Digital,
+		Stock:       p.StockQuantity,
+		PublishAt:   p.PublishAt,
+		UnpublishAt: p.UnpublishAt,
+		Options:     p.OptionList(),
+		Images:      make([]string, 0, len(p.Images)),
+		Variants:    make([]ProductVariantReq, 0, len(p.Variants)),
+	}
+	req.LowStockThreshold = p.LowStockThreshold
+	req.TaxClass = p.TaxClass
+	req.WeightGrams = p.WeightGrams
+	req.LengthMM, req.WidthMM, req.HeightMM = p.LengthMM, p.WidthMM, p.HeightMM
+	for _, img := range p.Images {
+		req.Images = append(req.Images, img.ImageURL)
+	}
+	for _, v := range p.Variants {
+		attrs := make([]map[string]string, 0)
+		_ = json.Unmarshal(v.Attributes, &attrs)
+		req.Variants = append(req.Variants, ProductVariantReq{
+			ID:          v.ID,
+			SKU:         v.SKU,
+			Attributes:  attrs,
+			Image:       v.ImageURL,
+			Price:       v.Price,
+			SalePricing: v.SalePricing,
+			InStock:     v.InStock,
+			IsActive:    v.IsActive,
+			Stock:       v.StockQuantity,
+		})
+	}
+	return req
+}
+
+// WriteExport streams the catalogue in the given format
+func WriteExport(w io.Writer, format string, products []Product) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, products)
+	case FormatJSONL:
+		enc := json.NewEncoder(w)
+		for i := range products {
+			if err := enc.Encode(productToRequest(&products[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func writeCSV(w io.Writer, products []Product) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for i := range products {
+		req := productToRequest(&products[i])
+		base := []string{
+			req.ID, req.Name, req.Category, req.Description, strconv.Itoa(req.Price),
+			strconv.FormatBool(req.Featured), strconv.FormatBool(req.IsActive), strconv.Itoa(req.Stock),
+			strings.Join(req.Images, csvListSep), formatCSVTime(req.PublishAt), formatCSVTime(req.UnpublishAt),
+		}
+		base = append(base, saleCSV(req.SalePricing)...)
+		base = append(base, optionsCSV(req.Options), strconv.FormatBool(req.Digital), thresholdCSV(req.LowStockThreshold), req.TaxClass,
+			strconv.Itoa(req.WeightGrams), strconv.Itoa(req.LengthMM), strconv.Itoa(req.WidthMM), strconv.Itoa(req.HeightMM))
+		if len(req.Variants) == 0 {
+			if err := writer.Write(append(base, "", "", "", "", "", "", "", "", "", "", "", "")); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, v := range req.Variants {
+			pairs := make([]string, 0, len(v.Attributes))
+			for _, attr := range v.Attributes {
+				pairs = append(pairs, attr["name"]+csvPairSep+attr["value"])
+			}
+			record := append(append([]string{}, base...),
+				v.ID, v.SKU, strings.Join(pairs, csvAttrSep), v.Image, strconv.Itoa(v.Price),
+				strconv.FormatBool(v.InStock), strconv.FormatBool(v.IsActive), strconv.Itoa(v.Stock),
+			)
+			record = append(record, saleCSV(v.SalePricing)...)
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -8,48 +8,134 @@ import (
 	"time"
 )
 
+// TaxClassStandard is the tax class of products that do not name one
+const TaxClassStandard = "standard"
+
 type Product struct {
-	ID          string           `gorm:"primaryKey" json:"id"`
-	Name        string           `json:"name"`
-	Category    string           `json:"category"`
-	Description string           `json:"description"`
-	Price       int              `json:"price"` // price in smallest currency unit
-	Featured    bool             `json:"featured"`
-	IsActive    bool             `gorm:"default:true" json:"is_active"`
-	CreatedAt   time.Time        `gorm:"autoCreateTime" json:"created_at"`
-	Images      []ProductImage   `gorm:"foreignKey:ProductID" json:"images"`
-	Variants    []ProductVariant `gorm:"foreignKey:ProductID" json:"variants"`
+	ID          string `gorm:"primaryKey" json:"id"`
+	Name        string `json:"name"`
+	Slug        string `gorm:"uniqueIndex:idx_products_slug,where:slug <> ''" json:"slug"`
+	Type        string `gorm:"not null;default:'simple'" json:"type"` // ProductTypeSimple or ProductTypeBundle
+	CategoryID  string `gorm:"index" json:"category_id"`
+	Category    string `json:"category"` // slug of CategoryID, kept in sync by the categories module
+	Description string `json:"description"`
+	Price       int    `json:"price"` // regular price in smallest currency unit
+	SalePricing
+	Featured         bool             `json:"featured"`
+	IsActive         bool             `gorm:"default:true" json:"is_active"`
+	Digital          bool             `gorm:"not null;default:false" json:"digital"`       // delivered as downloadable files
+	StockQuantity    int              `gorm:"not null;default:0" json:"stock_quantity"`    // on hand, used when the product has no variants
+	ReservedQuantity int              `gorm:"not null;default:0" json:"reserved_quantity"` // held by open orders
+	Options          datatypes.JSON   `json:"options"`
+	PublishAt        *time.Time       `gorm:"index" json:"publish_at"`   // hidden until then; the scheduler activates it
+	UnpublishAt      *time.Time       `gorm:"index" json:"unpublish_at"` // hidden from then on; the scheduler deactivates it
+	Version          int              `gorm:"not null;default:0" json:"version"`
+	CreatedAt        time.Time        `gorm:"autoCreateTime" json:"created_at"`
+	DeletedAt        gorm.DeletedAt   `gorm:"index" json:"deleted_at,omitempty"`
+	Images           []ProductImage   `gorm:"foreignKey:ProductID" json:"images"`
+	Variants         []ProductVariant `gorm:"foreignKey:ProductID" json:"variants"`
+	// BundleDiscountPercent prices a bundle at its components' current prices less this
+	// percentage; 0 charges Price instead
+	BundleDiscountPercent int               `gorm:"not null;default:0" json:"bundle_discount_percent"`
+	Components            []BundleComponent `gorm:"foreignKey:BundleID" json:"components,omitempty"`
+	// LowStockThreshold overrides the global stock alert threshold; nil uses it. See StockMonitor.
+	LowStockThreshold *int `json:"low_stock_threshold"`
+	// TaxClass picks the tax rates that apply to the product, e.g. "standard", "reduced", "exempt"
+	TaxClass string `gorm:"not null;default:'standard'" json:"tax_class"`
+	// Parcel size of one unit, for shipping rates; bundles ship as one parcel of their own size
+	WeightGrams int `gorm:"not null;default:0" json:"weight_grams"`
+	LengthMM    int `gorm:"not null;default:0" json:"length_mm"`
+	WidthMM     int `gorm:"not null;default:0" json:"width_mm"`
+	HeightMM    int `gorm:"not null;default:0" json:"height_mm"`
+	// unsent holds the optional fields an update request left out; their columns keep the stored values
+	unsent map[string]bool
 }
 
 type ProductImage struct {
 	ID        uint   `gorm:"primaryKey" json:"id"`
 	ProductID string `gorm:"index" json:"product_id"`
 	ImageURL  string `json:"url"`
+	Position  int    `gorm:"not null;default:0" json:"position"`
 }
 
 type ProductVariant struct {
 	ID         string         `gorm:"primaryKey" json:"id"`
 	ProductID  string         `gorm:"index" json:"product_id"`
-	SKU        string         `json:"sku"`
+	SKU        string         `gorm:"uniqueIndex:idx_product_variants_sku,where:sku <> ''" json:"sku"`
 	Attributes datatypes.JSON `json:"attributes"` // e.g. [{"name": "size", "value": "M"}]
 	ImageURL   string         `json:"image_url"`
 	Price      int            `json:"price"`
-	InStock    bool           `json:"in_stock"`
-	IsActive   bool           `gorm:"default:true" json:"is_active"`
+	SalePricing
+	InStock          bool `json:"in_stock"`
+	IsActive         bool `gorm:"default:true" json:"is_active"`               // false once removed from the product; the row stays for orders
+	StockQuantity    int  `gorm:"not null;default:0" json:"stock_quantity"`    // on hand
+	ReservedQuantity int  `gorm:"not null;default:0" json:"reserved_quantity"` // held by open orders
+	// unsent holds the optional fields an update request left out; see Product
+	unsent map[string]bool
 }
 
 // Transformation pipeline for API response
 
+// SaleResponse describes the price a shopper pays now next to the regular price
+type SaleResponse struct {
+	CurrentPrice   int        `json:"current_price"`
+	OnSale         bool       `json:"on_sale"`
+	SalePrice      *int       `json:"sale_price,omitempty"`
+	SaleEndsAt     *time.Time `json:"sale_ends_at,omitempty"`
+	CompareAtPrice int        `json:"compare_at_price,omitempty"` // struck-through price, higher than current_price
+}
+
+func saleResponse(regular int, pricing SalePricing, now time.Time) SaleResponse {
+	resp := SaleResponse{CurrentPrice: pricing.priceAt(regular, now)}
+	if pricing.OnSale(now) {
+		resp.OnSale = true
+		resp.SalePrice = pricing.SalePrice
+		resp.SaleEndsAt = pricing.SaleEndsAt
+		resp.CompareAtPrice = regular
+	}
+	if pricing.CompareAtPrice > resp.CompareAtPrice {
+		resp.CompareAtPrice = pricing.CompareAtPrice
+	}
+	if resp.CompareAtPrice <= resp.CurrentPrice {
+		resp.CompareAtPrice = 0
+	}
+	return resp
+}
+
 type ProductResponse struct {
-	ID          string            `json:"id"`
-	Name        string            `json:"name"`
-	Category    string            `json:"category"`
-	Description string            `json:"description"`
-	Images      []string          `json:"images"`
-	Price       int               `json:"price"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Slug        string   `json:"slug"`
+	Type        string   `json:"type"`
+	CategoryID  string   `json:"category_id"`
+	Category    string   `json:"category"`
+	Description string   `json:"description"`
+	Images      []string `json:"images"`
+	Price       int      `json:"price"` // regular price
+	SaleResponse
 	Featured    bool              `json:"featured"`
 	IsActive    bool              `json:"is_active"`
+	Digital     bool              `json:"digital,omitempty"`
+	Options     []ProductOption   `json:"options,omitempty"`
+	PublishAt   *time.Time        `json:"publish_at,omitempty"`
+	UnpublishAt *time.Time        `json:"unpublish_at,omitempty"`
+	InStock     bool              `json:"inStock"`
+	Available   int               `json:"available"`
+	Version     int               `json:"version"`
 	Variants    []VariantResponse `json:"variants,omitempty"`
+	// Bundles only
+	BundleDiscountPercent int                 `json:"bundle_discount_percent,omitempty"`
+	Components            []ComponentResponse `json:"components,omitempty"`
+	// Locale of name, description and attribute_labels; set on public reads
+	Locale          string                    `json:"locale,omitempty"`
+	AttributeLabels map[string]AttributeLabel `json:"attribute_labels,omitempty"`
+	// Only set when the product overrides the global stock alert threshold
+	LowStockThreshold *int   `json:"low_stock_threshold,omitempty"`
+	TaxClass          string `json:"tax_class"`
+	WeightGrams       int    `json:"weight_grams,omitempty"`
+	LengthMM          int    `json:"length_mm,omitempty"`
+	WidthMM           int    `json:"width_mm,omitempty"`
+	HeightMM          int    `json:"height_mm,omitempty"`
 }
 
 type VariantResponse struct {
@@ -57,9 +143,11 @@ type VariantResponse struct {
 	SKU        string            `json:"sku"`
 	Attributes map[string]string `json:"attributes"`
 	Image      string            `json:"image"`
-	Price      int               `json:"price"`
-	InStock    bool              `json:"inStock"`
-	IsActive   bool              `json:"is_active"`
+	Price      int               `json:"price"` // regular price
+	SaleResponse
+	InStock   bool `json:"inStock"`
+	Available int  `json:"available"`
+	IsActive  bool `json:"is_active"`
 }
 
 func (p *Product) BeforeCreate(tx *gorm.DB) (err error) {
@@ -76,7 +164,54 @@ func (v *ProductVariant) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// IsVisible reports whether shoppers can see and buy the product at now
+func (p *Product) IsVisible(now time.Time) bool {
+	if !p.IsActive {
+		return false
+	}
+	if p.PublishAt != nil && p.PublishAt.After(now) {
+		return false
+	}
+	return p.UnpublishAt == nil || p.UnpublishAt.After(now)
+}
+
+// Available returns the quantity that can still be reserved. A bundle's components need to be loaded.
+func (p *Product) Available() int {
+	if p.IsBundle() {
+		return p.bundleAvailable()
+	}
+	if n := p.StockQuantity - p.ReservedQuantity; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// HasActiveVariants reports whether the product is sold as variants, so a line must name one
+func (p *Product) HasActiveVariants() bool {
+	for i := range p.Variants {
+		if p.Variants[i].IsActive {
+			return true
+		}
+	}
+	return false
+}
+
+// TracksStock reports whether orders reserve stock of the product. Digital products are sold
+// as downloads and never run out.
+func (p *Product) TracksStock() bool {
+	return !p.Digital
+}
+
+// Available returns the quantity that can still be reserved
+func (v *ProductVariant) Available() int {
+	if n := v.StockQuantity - v.ReservedQuantity; n > 0 {
+		return n
+	}
+	return 0
+}
+
 func TransformProductToResponse(product *Product) ProductResponse {
+	now := time.Now()
 	images := make([]string, len(product.Images))
 	for i, img := range product.Images {
 		images[i] = img.ImageURL
@@ -87,6 +222,15 @@ func TransformProductToResponse(product *Product) ProductResponse {
 			activeVariants = append(activeVariants, v)
 		}
 	}
+	available := product.Available()
+	if len(activeVariants) > 0 {
+		available = 0
+		for _, v := range activeVariants {
+			if v.InStock {
+				available += v.Available()
+			}
+		}
+	}
 	variants := make([]VariantResponse, len(activeVariants))
 	for i, v := range activeVariants {
 		var attrsArr []map[string]string
@@ -100,24 +244,47 @@ func TransformProductToResponse(product *Product) ProductResponse {
 			}
 		}
 		variants[i] = VariantResponse{
-			ID:         v.ID,
-			SKU:        v.SKU,
-			Attributes: attrMap,
-			Image:      v.ImageURL,
-			Price:      v.Price,
-			InStock:    v.InStock,
-			IsActive:   v.IsActive,
+			ID:           v.ID,
+			SKU:          v.SKU,
+			Attributes:   attrMap,
+			Image:        v.ImageURL,
+			Price:        v.Price,
+			SaleResponse: saleResponse(v.Price, v.SalePricing, now),
+			InStock:      v.InStock && (v.Available() > 0 || !product.TracksStock()),
+			Available:    v.Available(),
+			IsActive:     v.IsActive,
 		}
 	}
-	return ProductResponse{
-		ID:          product.ID,
-		Name:        product.Name,
-		Category:    product.Category,
-		Description: product.Description,
-		Images:      images,
-		Price:       product.Price,
-		Featured:    product.Featured,
-		IsActive:    product.IsActive,
-		Variants:    variants,
+	resp := ProductResponse{
+		ID:           product.ID,
+		Name:         product.Name,
+		Slug:         product.Slug,
+		Type:         product.productType(),
+		CategoryID:   product.CategoryID,
+		Category:     product.Category,
+		Description:  product.Description,
+		Images:       images,
+		Price:        product.Price,
+		SaleResponse: saleResponse(product.Price, product.SalePricing, now),
+		Featured:     product.Featured,
+		IsActive:     product.IsActive,
+		Digital:      product.Digital,
+		PublishAt:    product.PublishAt,
+		UnpublishAt:  product.UnpublishAt,
+		InStock:      available > 0 || !product.TracksStock(),
+		Available:    available,
+		Version:      product.Version,
+		Variants:     variants,
+	}
+	resp.LowStockThreshold = product.LowStockThreshold
+	resp.TaxClass = product.TaxClass
+	resp.WeightGrams = product.WeightGrams
+	resp.LengthMM, resp.WidthMM, resp.HeightMM = product.LengthMM, product.WidthMM, product.HeightMM
+	if product.IsBundle() {
+		resp.Price = product.RegularPrice()
+		resp.SaleResponse = bundleSaleResponse(product, now)
+		resp.BundleDiscountPercent = product.BundleDiscountPercent
+		resp.Components = componentResponses(product, now)
 	}
+	return resp
 }
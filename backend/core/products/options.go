@@ -0,0 +1,222 @@
+package products
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ecommerce-backend/common/slug"
+)
+
+var (
+	ErrInvalidOptions       = errors.New("options need unique, non-empty names and values")
+	ErrUnknownCombination   = errors.New("variant attributes do not match the product options")
+	ErrDuplicateCombination = errors.New("two active variants have the same attributes")
+	ErrTooManyCombinations  = errors.New("too many option combinations")
+)
+
+const maxOptionCombinations = 1000
+
+// ProductOption is one axis of the variant matrix, e.g. size with S, M and L
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// VariantMatrix asks for one variant per combination of option values. SKUPattern may reference
+// options as {name} and the product as {product}; by default it is {product}-{first}-{second}...
+// Disabled combinations are deactivated when they exist and skipped otherwise.
+type VariantMatrix struct {
+	Options       []ProductOption     `json:"options" validate:"required,min=1"`
+	SKUPattern    string              `json:"sku_pattern"`
+	Price         int                 `json:"price" validate:"gte=0"`
+	StockQuantity int                 `json:"stock_quantity" validate:"gte=0"`
+	Disabled      []map[string]string `json:"disabled"`
+}
+
+// OptionList decodes the product's option axes
+func (p *Product) OptionList() []ProductOption {
+	options := make([]ProductOption, 0)
+	if len(p.Options) > 0 {
+		_ = json.Unmarshal(p.Options, &options)
+	}
+	return options
+}
+
+func validateOptions(options []ProductOption) error {
+	names := make(map[string]bool, len(options))
+	for _, option := range options {
+		name := strings.TrimSpace(option.Name)
+		if name == "" || names[name] || len(option.Values) == 0 {
+			return ErrInvalidOptions
+		}
+		names[name] = true
+		values := make(map[string]bool, len(option.Values))
+		for _, value := range option.Values {
+			if strings.TrimSpace(value) == "" || values[value] {
+				return ErrInvalidOptions
+			}
+			values[value] = true
+		}
+	}
+	return nil
+}
+
+// checkVariantOptions rejects active variants that repeat an attribute set and, when the product
+// declares options, active variants whose attributes are not exactly one value per option
+func checkVariantOptions(product *Product) error {
+	options := product.OptionList()
+	if err := validateOptions(options); err != nil {
+		return err
+	}
+	allowed := make(map[string]map[string]bool, len(options))
+	for _, option := range options {
+		allowed[option.Name] = make(map[string]bool, len(option.Values))
+		for _, value := range option.Values {
+			allowed[option.Name][value] = true
+		}
+	}
+
+	seen := make(map[string]string, len(product.Variants))
+	for _, v := range product.Variants {
+		if !v.IsActive {
+			continue
+		}
+		attrs := v.attributeMap()
+		if len(options) > 0 {
+			if len(attrs) != len(options) {
+				return fmt.Errorf("%w: %s", ErrUnknownCombination, v.SKU)
+			}
+			for name, value := range attrs {
+				if !allowed[name][value] {
+					return fmt.Errorf("%w: %s has %s=%s", ErrUnknownCombination, v.SKU, name, value)
+				}
+			}
+		}
+		key := combinationKey(attrs)
+		if other, dup := seen[key]; dup {
+			return fmt.Errorf("%w: %s and %s", ErrDuplicateCombination, other, v.SKU)
+		}
+		seen[key] = v.SKU
+	}
+	return nil
+}
+
+func (v *ProductVariant) attributeMap() map[string]string {
+	var pairs []map[string]string
+	_ = json.Unmarshal(v.Attributes, &pairs)
+	attrs := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		if name, ok := pair["name"]; ok {
+			attrs[name] = pair["value"]
+		}
+	}
+	return attrs
+}
+
+// combinationKey identifies an attribute set regardless of attribute order
+func combinationKey(attrs map[string]string) string {
+	pairs := make([]string, 0, len(attrs))
+	for name, value := range attrs {
+		pairs = append(pairs, name+"\x00"+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\x01")
+}
+
+// GenerateVariants returns one variant per option combination. Combinations that already exist
+// keep their variant, price and stock; new ones get a SKU from the pattern and the matrix defaults.
+// Variants outside the matrix are left out, so saving the result deactivates them.
+func GenerateVariants(product *Product, matrix VariantMatrix) ([]ProductVariant, error) {
+	if err := validateOptions(matrix.Options); err != nil {
+		return nil, err
+	}
+	total := 1
+	for _, option := range matrix.Options {
+		total *= len(option.Values)
+		if total > maxOptionCombinations {
+			return nil, ErrTooManyCombinations
+		}
+	}
+
+	existing := make(map[string]ProductVariant, len(product.Variants))
+	for _, v := range product.Variants {
+		key := combinationKey(v.attributeMap())
+		// Prefer the active variant when an inactive one shares its attributes
+		if current, ok := existing[key]; !ok || (!current.IsActive && v.IsActive) {
+			existing[key] = v
+		}
+	}
+	disabled := make(map[string]bool, len(matrix.Disabled))
+	for _, attrs := range matrix.Disabled {
+		disabled[combinationKey(attrs)] = true
+	}
+
+	variants := make([]ProductVariant, 0, total)
+	for _, combo := range cartesian(matrix.Options) {
+		attrs := make(map[string]string, len(combo))
+		pairs := make([]map[string]string, 0, len(combo))
+		for i, value := range combo {
+			attrs[matrix.Options[i].Name] = value
+			pairs = append(pairs, map[string]string{"name": matrix.Options[i].Name, "value": value})
+		}
+		key := combinationKey(attrs)
+		attrJSON, _ := json.Marshal(pairs)
+
+		if v, ok := existing[key]; ok {
+			v.Attributes = attrJSON
+			v.IsActive = !disabled[key]
+			variants = append(variants, v)
+			continue
+		}
+		if disabled[key] {
+			continue
+		}
+		variants = append(variants, ProductVariant{
+			ProductID:     product.ID,
+			SKU:           expandSKUPattern(matrix.SKUPattern, product.Name, matrix.Options, combo),
+			Attributes:    attrJSON,
+			Price:         matrix.Price,
+			InStock:       true,
+			IsActive:      true,
+			StockQuantity: matrix.StockQuantity,
+		})
+	}
+	return variants, nil
+}
+
+// cartesian lists every combination of option values in option order
+func cartesian(options []ProductOption) [][]string {
+	combos := [][]string{{}}
+	for _, option := range options {
+		next := make([][]string, 0, len(combos)*len(option.Values))
+		for _, combo := range combos {
+			for _, value := range option.Values {
+				next = append(next, append(append([]string{}, combo...), value))
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+func expandSKUPattern(pattern, productName string, options []ProductOption, combo []string) string {
+	if pattern == "" {
+		parts := []string{"{product}"}
+		for _, option := range options {
+			parts = append(parts, "{"+option.Name+"}")
+		}
+		pattern = strings.Join(parts, "-")
+	}
+	replacements := []string{"{product}", skuSegment(productName)}
+	for i, option := range options {
+		replacements = append(replacements, "{"+option.Name+"}", skuSegment(combo[i]))
+	}
+	return strings.NewReplacer(replacements...).Replace(pattern)
+}
+
+func skuSegment(s string) string {
+	return strings.ToUpper(slug.Make(s))
+}
@@ -0,0 +1,129 @@
+package products
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidSale = errors.New("sale_price must not be negative and sale_ends_at must be after sale_starts_at")
+
+// SalePricing sits next to a regular Price on products and variants. The sale price applies inside
+// [SaleStartsAt, SaleEndsAt); an open bound never limits it. CompareAtPrice is an optional
+// "was" price for display only.
+type SalePricing struct {
+	CompareAtPrice int        `gorm:"not null;default:0" json:"compare_at_price"`
+	SalePrice      *int       `json:"sale_price"`
+	SaleStartsAt   *time.Time `json:"sale_starts_at"`
+	SaleEndsAt     *time.Time `json:"sale_ends_at"`
+}
+
+// OnSale reports whether the sale price applies at t
+func (s SalePricing) OnSale(t time.Time) bool {
+	if s.SalePrice == nil {
+		return false
+	}
+	if s.SaleStartsAt != nil && s.SaleStartsAt.After(t) {
+		return false
+	}
+	return s.SaleEndsAt == nil || s.SaleEndsAt.After(t)
+}
+
+func (s SalePricing) priceAt(regular int, t time.Time) int {
+	if s.OnSale(t) {
+		return *s.SalePrice
+	}
+	return regular
+}
+
+func (s SalePricing) validate() error {
+	if s.SalePrice != nil && *s.SalePrice < 0 {
+		return ErrInvalidSale
+	}
+	if s.SaleStartsAt != nil && s.SaleEndsAt != nil && !s.SaleEndsAt.After(*s.SaleStartsAt) {
+		return ErrInvalidSale
+	}
+	return nil
+}
+
+// PriceAt returns the unit price charged at t. A bundle priced by discount needs its components loaded.
+func (p *Product) PriceAt(t time.Time) int {
+	if p.IsBundle() && p.BundleDiscountPercent > 0 {
+		return p.discounted(p.SeparatePriceAt(t))
+	}
+	return p.SalePricing.priceAt(p.Price, t)
+}
+
+// PriceAt returns the unit price charged at t
+func (v *ProductVariant) PriceAt(t time.Time) int {
+	return v.SalePricing.priceAt(v.Price, t)
+}
+
+// salePriceSQL is the price of the row aliased by table right now, sale included
+func salePriceSQL(table string) string {
+	return "(CASE WHEN " + table + ".sale_price IS NOT NULL" +
+		" AND (" + table + ".sale_starts_at IS NULL OR " + table + ".sale_starts_at <= NOW())" +
+		" AND (" + table + ".sale_ends_at IS NULL OR " + table + ".sale_ends_at > NOW())" +
+		" THEN " + table + ".sale_price ELSE " + table + ".price END)"
+}
+
+// PriceHistory records the pricing of a product (empty VariantID) or one of its variants
+// each time it changes, including the sale configuration.
+type PriceHistory struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	ProductID string `gorm:"index:idx_price_history_item;not null" json:"product_id"`
+	VariantID string `gorm:"index:idx_price_history_item" json:"variant_id,omitempty"`
+	Price     int    `json:"price"`
+	SalePricing
+	ChangedAt time.Time `gorm:"autoCreateTime;index" json:"changed_at"`
+}
+
+func (PriceHistory) TableName() string {
+	return "product_price_history"
+}
+
+// recordPrices appends a history row for every priced item of product whose pricing differs from
+// its latest entry. product must be freshly loaded inside tx.
+func recordPrices(tx *gorm.DB, product *Product) error {
+	entries := []PriceHistory{{ProductID: product.ID, Price: product.Price, SalePricing: product.SalePricing}}
+	for _, v := range product.Variants {
+		entries = append(entries, PriceHistory{ProductID: product.ID, VariantID: v.ID, Price: v.Price, SalePricing: v.SalePricing})
+	}
+	for _, entry := range entries {
+		var last PriceHistory
+		err := tx.Where("product_id = ? AND variant_id = ?", entry.ProductID, entry.VariantID).
+			Order("id DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		if last.ID != 0 && last.Price == entry.Price && samePricing(last.SalePricing, entry.SalePricing) {
+			continue
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func samePricing(a, b SalePricing) bool {
+	return a.CompareAtPrice == b.CompareAtPrice &&
+		sameInt(a.SalePrice, b.SalePrice) &&
+		sameTime(a.SaleStartsAt, b.SaleStartsAt) &&
+		sameTime(a.SaleEndsAt, b.SaleEndsAt)
+}
+
+func sameInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,176 @@
+package products
+
+import (
+	"context"
+	"time"
+
+	"ecommerce-backend/common/constants"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Sources of a related product
+const (
+	RelatedCoPurchase = "co_purchase" // bought in the same orders
+	RelatedCategory   = "category"    // same category, filling in for missing order history
+)
+
+// relatedPerProduct is how many related products are stored per product. Reads filter out
+// products hidden since the last run, so more are kept than a page usually shows.
+const relatedPerProduct = 20
+
+// relatedLockID keeps instances from recomputing at the same time
+const relatedLockID int64 = 0x52454c4154
+
+// ProductRelation is a precomputed "frequently bought together" entry, ordered by Rank starting at 1
+type ProductRelation struct {
+	ProductID  string    `gorm:"primaryKey" json:"product_id"`
+	RelatedID  string    `gorm:"primaryKey" json:"related_id"`
+	Rank       int       `gorm:"not null" json:"rank"`
+	Score      int       `gorm:"not null;default:0" json:"score"` // orders containing both; 0 for category fill-ins
+	Source     string    `gorm:"not null" json:"source"`
+	ComputedAt time.Time `gorm:"not null" json:"computed_at"`
+}
+
+// Orders in these statuses never completed, so they say nothing about what sells together
+var relatedIgnoredStatuses = []string{
+	constants.ORDER_STATUS_CANCELED,
+	constants.ORDER_STATUS_REJECTED,
+	constants.ORDER_STATUS_REJECTED_BY_USER,
+	constants.ORDER_STATUS_USER_CANCELLED,
+	constants.ORDER_STATUS_USER_CANCELLED_ON_ARRIVAL,
+}
+
+// coPurchaseSQL ranks, for each product, the active products found in the same orders by the
+// number of such orders. Order items are read from the orders.items_json snapshot.
+const coPurchaseSQL = `WITH lines AS (
+	SELECT DISTINCT o.id AS order_id, item->>'product_id' AS product_id
+	FROM orders o CROSS JOIN LATERAL jsonb_array_elements(o.items_json) AS item
+	WHERE jsonb_typeof(o.items_json) = 'array' AND o.current_status NOT IN ?
+), pairs AS (
+	SELECT a.product_id, b.product_id AS related_id, COUNT(*) AS score
+	FROM lines a
+	JOIN lines b ON b.order_id = a.order_id AND b.product_id <> a.product_id
+	JOIN products src ON src.id = a.product_id AND src.deleted_at IS NULL
+	JOIN products rel ON rel.id = b.product_id AND rel.deleted_at IS NULL AND rel.is_active
+	GROUP BY a.product_id, b.product_id
+), ranked AS (
+	SELECT product_id, related_id, score,
+		ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY score DESC, related_id) AS rank
+	FROM pairs
+)
+INSERT INTO product_relations (product_id, related_id, rank, score, source, computed_at)
+SELECT product_id, related_id, rank, score, ?, ? FROM ranked WHERE rank <= ?`
+
+// categoryFillSQL tops up products with fewer than the wanted relations with active products of
+// the same category, featured and newest first
+const categoryFillSQL = `WITH counts AS (
+	SELECT product_id, COUNT(*) AS n FROM product_relations GROUP BY product_id
+), candidates AS (
+	SELECT p.id AS product_id, q.id AS related_id,
+		COALESCE(c.n, 0) + ROW_NUMBER() OVER (PARTITION BY p.id ORDER BY q.featured DESC, q.created_at DESC, q.id) AS rank
+	FROM products p
+	JOIN products q ON q.category_id = p.category_id AND q.id <> p.id AND q.deleted_at IS NULL AND q.is_active
+	LEFT JOIN counts c ON c.product_id = p.id
+	WHERE p.deleted_at IS NULL AND p.category_id <> '' AND COALESCE(c.n, 0) < ?
+		AND NOT EXISTS (SELECT 1 FROM product_relations r WHERE r.product_id = p.id AND r.related_id = q.id)
+)
+INSERT INTO product_relations (product_id, related_id, rank, score, source, computed_at)
+SELECT product_id, related_id, rank, 0, ?, ? FROM candidates WHERE rank <= ?`
+
+func (r *productRepository) ComputeRelated(ctx context.Context) (int64, error) {
+	var stored int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", relatedLockID).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+		// Readers keep seeing the previous results until the transaction commits
+		if err := tx.Exec("DELETE FROM product_relations").Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		res := tx.Exec(coPurchaseSQL, relatedIgnoredStatuses, RelatedCoPurchase, now, relatedPerProduct)
+		if res.Error != nil {
+			return res.Error
+		}
+		stored = res.RowsAffected
+		res = tx.Exec(categoryFillSQL, relatedPerProduct, RelatedCategory, now, relatedPerProduct)
+		stored += res.RowsAffected
+		return res.Error
+	})
+	return stored, err
+}
+
+func (r *productRepository) Related(ctx context.Context, product *Product, limit int) ([]Product, error) {
+	db := r.db.WithContext(ctx)
+	var computed int64
+	if err := db.Model(&ProductRelation{}).Where("product_id = ?", product.ID).Count(&computed).Error; err != nil {
+		return nil, err
+	}
+	query := db.Scopes(visibleScope, withComponents).Preload("Images", orderedImages).Preload("Variants").Limit(limit)
+	if computed > 0 {
+		query = query.Joins("JOIN product_relations pr ON pr.related_id = products.id AND pr.product_id = ?", product.ID).
+			Order("pr.rank")
+	} else if product.CategoryID != "" {
+		// Not computed yet, e.g. a product created since the last run
+		query = query.Where("products.category_id = ? AND products.id <> ?", product.CategoryID, product.ID).
+			Order("products.featured DESC, products.created_at DESC, products.id")
+	} else {
+		return []Product{}, nil
+	}
+	var related []Product
+	if err := query.Find(&related).Error; err != nil {
+		return nil, err
+	}
+	return related, nil
+}
+
+// RelatedJob recomputes related products periodically. Every instance may run one; an advisory
+// lock lets only one of them recompute at a time.
+type RelatedJob struct {
+	repo   ProductRepository
+	ticker *time.Ticker
+	stop   chan bool
+}
+
+// NewRelatedJob computes once right away and then every interval
+func NewRelatedJob(repo ProductRepository, interval time.Duration) *RelatedJob {
+	j := &RelatedJob{
+		repo:   repo,
+		ticker: time.NewTicker(interval),
+		stop:   make(chan bool),
+	}
+	go func() {
+		j.run()
+		for {
+			select {
+			case <-j.ticker.C:
+				j.run()
+			case <-j.stop:
+				j.ticker.Stop()
+				return
+			}
+		}
+	}()
+	return j
+}
+
+func (j *RelatedJob) run() {
+	stored, err := j.repo.ComputeRelated(context.Background())
+	if err != nil {
+		logrus.Errorf("Failed to compute related products: %v", err)
+		return
+	}
+	logrus.Infof("Computed %d related product entries", stored)
+}
+
+// Stop stops the job goroutine
+func (j *RelatedJob) Stop() {
+	if j.stop != nil {
+		close(j.stop)
+	}
+}
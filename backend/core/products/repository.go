@@ -2,6 +2,9 @@ package products
 
 import (
 	"context"
+	"errors"
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -10,7 +13,50 @@ type ProductRepository interface {
 	Update(ctx context.Context, product *Product) error
 	Delete(ctx context.Context, id string) error
 	GetByID(ctx context.Context, id string) (*Product, error)
+	// GetByIDs loads the products that exist with their images and variants, in no particular order
+	GetByIDs(ctx context.Context, ids []string) ([]Product, error)
 	PaginatedList(ctx context.Context, skip, take int) ([]Product, int64, error)
+	Search(ctx context.Context, filter ProductFilter) ([]Product, int64, error)
+	Facets(ctx context.Context, filter ProductFilter) (*ProductFacets, error)
+	// ListAll returns the whole catalogue, inactive products included
+	ListAll(ctx context.Context) ([]Product, error)
+	// GetByVariantSKU finds the product owning the SKU, whether or not the variant or product is still active
+	GetByVariantSKU(ctx context.Context, sku string) (*Product, error)
+	// Import creates and updates products in one transaction; any failure rolls back all of them
+	Import(ctx context.Context, creates, updates []*Product) error
+	// GetByIDUnscoped also finds soft-deleted products
+	GetByIDUnscoped(ctx context.Context, id string) (*Product, error)
+	ListDeleted(ctx context.Context) ([]Product, error)
+	Restore(ctx context.Context, id string) error
+	// Rollback writes product over the stored one, undeleting it, and records the source revision
+	Rollback(ctx context.Context, product *Product, source int) error
+	ListRevisions(ctx context.Context, productID string) ([]ProductRevision, error)
+	GetRevision(ctx context.Context, productID string, revision int) (*ProductRevision, error)
+	// PriceHistory lists price changes of the product and its variants, newest first
+	PriceHistory(ctx context.Context, productID string) ([]PriceHistory, error)
+	// ApplySchedule activates products whose publish_at and deactivates those whose unpublish_at has
+	// passed, clearing the consumed timestamps so later manual changes stick
+	ApplySchedule(ctx context.Context, now time.Time) (published, unpublished []ScheduledChange, err error)
+	// ComputeRelated replaces the stored related products from order history and categories
+	ComputeRelated(ctx context.Context) (int64, error)
+	// Related returns the visible stored related products of product, best first
+	Related(ctx context.Context, product *Product, limit int) ([]Product, error)
+	// CountBundlesContaining counts the bundles listing the product as a component
+	CountBundlesContaining(ctx context.Context, productID string) (int64, error)
+	// GetBySlug finds a product by its current slug
+	GetBySlug(ctx context.Context, slug string) (*Product, error)
+	// CurrentSlug returns the current slug of the product that used to have the old slug
+	CurrentSlug(ctx context.Context, old string) (string, error)
+	// SlugOwner returns the product that has or had the slug, or "" when it is free
+	SlugOwner(ctx context.Context, slug string) (string, error)
+	// TranslationsFor loads the translations of the products in any of the locales
+	TranslationsFor(ctx context.Context, productIDs, locales []string) ([]ProductTranslation, error)
+	ListTranslations(ctx context.Context, productID string) ([]ProductTranslation, error)
+	SaveTranslation(ctx context.Context, translation *ProductTranslation) error
+	DeleteTranslation(ctx context.Context, productID, locale string) error
+	CreateStockAlert(ctx context.Context, alert *StockAlert) error
+	ListStockAlerts(ctx context.Context, includeAcknowledged bool, skip, take int) ([]StockAlert, int64, error)
+	AcknowledgeStockAlert(ctx context.Context, id uint, at time.Time) error
 }
 
 type productRepository struct {
@@ -21,77 +67,494 @@ func NewProductRepository(db *gorm.DB) ProductRepository {
 	return &productRepository{db: db}
 }
 
+// Create, Update, Delete, Restore, Rollback and Import each save a revision in the same transaction
+
 func (r *productRepository) Create(ctx context.Context, product *Product) error {
-	return r.db.WithContext(ctx).Create(product).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+		return saveRevision(tx, product.ID, RevisionCreate, nil)
+	})
 }
 
+// Update diffs images and variants against the stored rows in one transaction
 func (r *productRepository) Update(ctx context.Context, product *Product) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := updateProduct(tx, product); err != nil {
+			return err
+		}
+		return saveRevision(tx, product.ID, RevisionUpdate, nil)
+	})
+}
+
+// updateProduct writes product onto an existing row using tx. Images are matched by URL and
+// variants by ID, then SKU; matched rows keep their IDs, removed variants are only deactivated
+// because orders keep referring to them. Columns of fields the request left out keep their values.
+func updateProduct(tx *gorm.DB, product *Product) error {
+	var previousSlug string
+	err := tx.Unscoped().Model(&Product{}).Where("id = ?", product.ID).Select("COALESCE(slug, '')").Scan(&previousSlug).Error
+	if err != nil {
+		return err
+	}
 	// Use map to explicitly update boolean fields even when false
 	// GORM's Updates() with struct skips zero values, so we use map instead
-	err := r.db.WithContext(ctx).Model(&Product{}).
-		Where("id = ?", product.ID).
-		Updates(map[string]interface{}{
-			"name":        product.Name,
-			"category":    product.Category,
-			"description": product.Description,
-			"price":       product.Price,
-			"featured":    product.Featured,
-			"is_active":   product.IsActive,
-		}).Error
-	if err != nil {
+	columns := map[string]interface{}{
+		"name":                    product.Name,
+		"slug":                    product.Slug,
+		"type":                    product.productType(),
+		"category_id":             product.CategoryID,
+		"category":                product.Category,
+		"description":             product.Description,
+		"price":                   product.Price,
+		"compare_at_price":        product.CompareAtPrice,
+		"sale_price":              product.SalePrice,
+		"sale_starts_at":          product.SaleStartsAt,
+		"sale_ends_at":            product.SaleEndsAt,
+		"featured":                product.Featured,
+		"is_active":               product.IsActive,
+		"digital":                 product.Digital,
+		"low_stock_threshold":     product.LowStockThreshold,
+		"tax_class":               product.TaxClass,
+		"weight_grams":            product.WeightGrams,
+		"length_mm":               product.LengthMM,
+		"width_mm":                product.WidthMM,
+		"height_mm":               product.HeightMM,
+		"stock_quantity":          product.StockQuantity,
+		"options":                 product.Options,
+		"publish_at":              product.PublishAt,
+		"unpublish_at":            product.UnpublishAt,
+		"bundle_discount_percent": product.BundleDiscountPercent,
+	}
+	for field := range product.unsent {
+		delete(columns, field)
+	}
+	if err := tx.Model(&Product{}).Where("id = ?", product.ID).Updates(columns).Error; err != nil {
 		return err
 	}
-	
-	// Update Images
-	err = r.db.WithContext(ctx).Where("product_id = ?", product.ID).Delete(&ProductImage{}).Error
-	if err != nil {
+	if err := recordSlugChange(tx, product.ID, previousSlug, product.Slug); err != nil {
 		return err
 	}
-	for _, img := range product.Images {
-		img.ProductID = product.ID
-		err = r.db.WithContext(ctx).Create(&img).Error
-		if err != nil {
+	if err := syncImages(tx, product.ID, product.Images); err != nil {
+		return err
+	}
+	if !product.unsent["components"] {
+		if err := syncComponents(tx, product.ID, product.Components); err != nil {
 			return err
 		}
 	}
-	
-	// Update Variants - delete existing and recreate to handle updates properly
-	err = r.db.WithContext(ctx).Where("product_id = ?", product.ID).Delete(&ProductVariant{}).Error
-	if err != nil {
+	return syncVariants(tx, product.ID, product.Variants)
+}
+
+func syncImages(tx *gorm.DB, productID string, images []ProductImage) error {
+	var existing []ProductImage
+	if err := tx.Where("product_id = ?", productID).Order("position, id").Find(&existing).Error; err != nil {
 		return err
 	}
-	for _, variant := range product.Variants {
-		variant.ProductID = product.ID
-		err = r.db.WithContext(ctx).Create(&variant).Error
+	byURL := make(map[string][]ProductImage, len(existing))
+	for _, img := range existing {
+		byURL[img.ImageURL] = append(byURL[img.ImageURL], img)
+	}
+	for i, img := range images {
+		if same := byURL[img.ImageURL]; len(same) > 0 {
+			kept := same[0]
+			byURL[img.ImageURL] = same[1:]
+			if kept.Position != i {
+				if err := tx.Model(&ProductImage{}).Where("id = ?", kept.ID).Update("position", i).Error; err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		img.ID = 0
+		img.ProductID = productID
+		img.Position = i
+		if err := tx.Create(&img).Error; err != nil {
+			return err
+		}
+	}
+	var removed []uint
+	for _, rest := range byURL {
+		for _, img := range rest {
+			removed = append(removed, img.ID)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	return tx.Where("id IN ?", removed).Delete(&ProductImage{}).Error
+}
+
+func syncVariants(tx *gorm.DB, productID string, variants []ProductVariant) error {
+	var existing []ProductVariant
+	if err := tx.Where("product_id = ?", productID).Find(&existing).Error; err != nil {
+		return err
+	}
+	byID := make(map[string]*ProductVariant, len(existing))
+	bySKU := make(map[string]*ProductVariant, len(existing))
+	for i := range existing {
+		byID[existing[i].ID] = &existing[i]
+		if existing[i].SKU != "" {
+			bySKU[existing[i].SKU] = &existing[i]
+		}
+	}
+	kept := make(map[string]bool, len(variants))
+	for _, variant := range variants {
+		match := byID[variant.ID]
+		if match == nil && variant.SKU != "" {
+			match = bySKU[variant.SKU]
+		}
+		if match == nil || kept[match.ID] {
+			variant.ProductID = productID
+			variant.ReservedQuantity = 0
+			if err := tx.Create(&variant).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		kept[match.ID] = true
+		// Reservations belong to open orders, not to the admin payload, so they are left alone
+		columns := map[string]interface{}{
+			"sku":              variant.SKU,
+			"attributes":       variant.Attributes,
+			"image_url":        variant.ImageURL,
+			"price":            variant.Price,
+			"compare_at_price": variant.CompareAtPrice,
+			"sale_price":       variant.SalePrice,
+			"sale_starts_at":   variant.SaleStartsAt,
+			"sale_ends_at":     variant.SaleEndsAt,
+			"in_stock":         variant.InStock,
+			"is_active":        variant.IsActive,
+			"stock_quantity":   variant.StockQuantity,
+		}
+		for field := range variant.unsent {
+			delete(columns, field)
+		}
+		if err := tx.Model(&ProductVariant{}).Where("id = ?", match.ID).Updates(columns).Error; err != nil {
+			return err
+		}
+	}
+	var removed []string
+	for _, v := range existing {
+		if !kept[v.ID] && v.IsActive {
+			removed = append(removed, v.ID)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	return tx.Model(&ProductVariant{}).Where("id IN ?", removed).Update("is_active", false).Error
+}
+
+func (r *productRepository) PriceHistory(ctx context.Context, productID string) ([]PriceHistory, error) {
+	var history []PriceHistory
+	err := r.db.WithContext(ctx).Where("product_id = ?", productID).Order("changed_at DESC, id DESC").Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// ScheduledChange is a product the scheduler just published or unpublished
+type ScheduledChange struct {
+	ID   string `json:"product_id"`
+	Name string `json:"name"`
+}
+
+// ApplySchedule claims due rows with conditional updates, so concurrent instances never both apply one.
+// A product whose whole window has passed is only unpublished.
+func (r *productRepository) ApplySchedule(ctx context.Context, now time.Time) (published, unpublished []ScheduledChange, err error) {
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw(`UPDATE products SET is_active = false, unpublish_at = NULL,
+			publish_at = CASE WHEN publish_at <= ? THEN NULL ELSE publish_at END
+			WHERE unpublish_at <= ? AND deleted_at IS NULL RETURNING id, name`, now, now).Scan(&unpublished).Error
 		if err != nil {
 			return err
 		}
+		err = tx.Raw(`UPDATE products SET is_active = true, publish_at = NULL
+			WHERE publish_at <= ? AND deleted_at IS NULL RETURNING id, name`, now).Scan(&published).Error
+		if err != nil {
+			return err
+		}
+		for _, change := range unpublished {
+			if err := saveRevision(tx, change.ID, RevisionUnpublish, nil); err != nil {
+				return err
+			}
+		}
+		for _, change := range published {
+			if err := saveRevision(tx, change.ID, RevisionPublish, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return published, unpublished, nil
+}
+
+// DedupeVariantSKUs suffixes repeated SKUs with the variant ID so the unique SKU index can be
+// created on databases that predate it. It must run before the products AutoMigrate.
+func DedupeVariantSKUs(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&ProductVariant{}) {
+		return nil
 	}
-	
-	return nil
+	return db.Exec(`UPDATE product_variants SET sku = product_variants.sku || '-' || product_variants.id
+		FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY sku ORDER BY id) AS n FROM product_variants WHERE sku <> '') dup
+		WHERE dup.id = product_variants.id AND dup.n > 1`).Error
 }
 
+// ReleaseDigitalReservations clears the stock orders placed before digital products stopped
+// keeping stock still hold of them. It runs after the products AutoMigrate.
+func ReleaseDigitalReservations(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`UPDATE product_variants SET reserved_quantity = 0
+			WHERE reserved_quantity <> 0 AND product_id IN (SELECT id FROM products WHERE digital)`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE products SET reserved_quantity = 0 WHERE digital AND reserved_quantity <> 0`).Error
+	})
+}
+
+func orderedImages(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+// Delete soft-deletes the product; images and variants stay attached so it can be restored
 func (r *productRepository) Delete(ctx context.Context, id string) error {
-	return r.db.WithContext(ctx).Where("id = ?", id).Delete(&Product{}).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", id).Delete(&Product{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return saveRevision(tx, id, RevisionDelete, nil)
+	})
+}
+
+func (r *productRepository) Restore(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().Model(&Product{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return saveRevision(tx, id, RevisionRestore, nil)
+	})
+}
+
+func (r *productRepository) Rollback(ctx context.Context, product *Product, source int) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Model(&Product{}).Where("id = ?", product.ID).Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		if err := updateProduct(tx, product); err != nil {
+			return err
+		}
+		return saveRevision(tx, product.ID, RevisionRollback, &source)
+	})
+}
+
+func (r *productRepository) GetByIDUnscoped(ctx context.Context, id string) (*Product, error) {
+	var product Product
+	err := r.db.WithContext(ctx).Unscoped().Preload("Images", orderedImages).Preload("Variants").Scopes(withComponents).First(&product, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *productRepository) ListDeleted(ctx context.Context) ([]Product, error) {
+	var products []Product
+	err := r.db.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL").
+		Preload("Images", orderedImages).Preload("Variants").
+		Order("deleted_at DESC, id").Find(&products).Error
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// ListRevisions returns the revisions newest first, without snapshots
+func (r *productRepository) ListRevisions(ctx context.Context, productID string) ([]ProductRevision, error) {
+	var revisions []ProductRevision
+	err := r.db.WithContext(ctx).Omit("snapshot").Where("product_id = ?", productID).Order("revision DESC").Find(&revisions).Error
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (r *productRepository) GetRevision(ctx context.Context, productID string, revision int) (*ProductRevision, error) {
+	var rev ProductRevision
+	err := r.db.WithContext(ctx).First(&rev, "product_id = ? AND revision = ?", productID, revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
 }
 
 func (r *productRepository) GetByID(ctx context.Context, id string) (*Product, error) {
 	var product Product
-	err := r.db.WithContext(ctx).Preload("Images").Preload("Variants").First(&product, "id = ?", id).Error
+	err := r.db.WithContext(ctx).Preload("Images", orderedImages).Preload("Variants").Scopes(withComponents).First(&product, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &product, nil
 }
 
+func (r *productRepository) GetByIDs(ctx context.Context, ids []string) ([]Product, error) {
+	var products []Product
+	err := r.db.WithContext(ctx).Preload("Images", orderedImages).Preload("Variants").Scopes(withComponents).Where("id IN ?", ids).Find(&products).Error
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
 func (r *productRepository) PaginatedList(ctx context.Context, skip, take int) ([]Product, int64, error) {
 	var products []Product
 	var count int64
 	db := r.db.WithContext(ctx).Model(&Product{})
 	db.Count(&count)
-	err := db.Preload("Images").Preload("Variants").Offset(skip).Limit(take).Find(&products).Error
+	err := db.Preload("Images", orderedImages).Preload("Variants").Scopes(withComponents).Offset(skip).Limit(take).Find(&products).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return products, count, nil
+}
+
+func (r *productRepository) ListAll(ctx context.Context) ([]Product, error) {
+	var products []Product
+	err := r.db.WithContext(ctx).Preload("Images", orderedImages).Preload("Variants").Scopes(withComponents).Order("created_at ASC, id").Find(&products).Error
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *productRepository) GetByVariantSKU(ctx context.Context, sku string) (*Product, error) {
+	var variant ProductVariant
+	if err := r.db.WithContext(ctx).First(&variant, "sku = ?", sku).Error; err != nil {
+		return nil, err
+	}
+	return r.GetByIDUnscoped(ctx, variant.ProductID)
+}
+
+func (r *productRepository) Import(ctx context.Context, creates, updates []*Product) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, product := range creates {
+			if err := tx.Create(product).Error; err != nil {
+				return err
+			}
+			if err := saveRevision(tx, product.ID, RevisionCreate, nil); err != nil {
+				return err
+			}
+		}
+		for _, product := range updates {
+			if err := updateProduct(tx, product); err != nil {
+				return err
+			}
+			if err := saveRevision(tx, product.ID, RevisionUpdate, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Search filters, counts and sorts in SQL and pages last, so every page is full
+func (r *productRepository) Search(ctx context.Context, filter ProductFilter) ([]Product, int64, error) {
+	var products []Product
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&Product{}).Scopes(filter.scope("")).Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	err := r.db.WithContext(ctx).Model(&Product{}).Scopes(filter.scope("")).
+		Preload("Images", orderedImages).Preload("Variants").Scopes(withComponents).
+		Order(filter.orderClause()).
+		Offset(filter.Skip).Limit(filter.Take).
+		Find(&products).Error
 	if err != nil {
 		return nil, 0, err
 	}
 	return products, count, nil
 }
+
+func (r *productRepository) Facets(ctx context.Context, filter ProductFilter) (*ProductFacets, error) {
+	facets := &ProductFacets{Categories: []FacetCount{}, Attributes: map[string][]FacetCount{}}
+	base := func(except string) *gorm.DB {
+		return r.db.WithContext(ctx).Model(&Product{}).Scopes(filter.scope(except))
+	}
+
+	err := base(facetCategory).
+		Select("products.category AS value, COUNT(*) AS count").
+		Where("products.category <> ''").
+		Group("products.category").Order("count DESC, value").
+		Scan(&facets.Categories).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := base(facetFeatured).Where("products.featured = ?", true).Count(&facets.Featured).Error; err != nil {
+		return nil, err
+	}
+	if err := base(facetInStock).Where(inStockSQL).Count(&facets.InStock).Error; err != nil {
+		return nil, err
+	}
+	err = base(facetPrice).
+		Select("COALESCE(MIN(" + effectivePriceSQL + "), 0) AS min, COALESCE(MAX(" + effectivePriceSQL + "), 0) AS max").
+		Scan(&facets.Price).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Unfiltered attribute names share one query; each filtered name is counted without its own filter
+	rows, err := r.attributeFacets(base(""))
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if _, filtered := filter.Attributes[row.Name]; !filtered {
+			facets.Attributes[row.Name] = append(facets.Attributes[row.Name], FacetCount{Value: row.Value, Count: row.Count})
+		}
+	}
+	for name := range filter.Attributes {
+		rows, err := r.attributeFacets(base(facetAttr+name).Where("fa->>'name' = ?", name))
+		if err != nil {
+			return nil, err
+		}
+		facets.Attributes[name] = []FacetCount{}
+		for _, row := range rows {
+			facets.Attributes[name] = append(facets.Attributes[name], FacetCount{Value: row.Value, Count: row.Count})
+		}
+	}
+	return facets, nil
+}
+
+type attributeFacetRow struct {
+	Name  string
+	Value string
+	Count int64
+}
+
+func (r *productRepository) attributeFacets(db *gorm.DB) ([]attributeFacetRow, error) {
+	var rows []attributeFacetRow
+	err := db.
+		Joins("JOIN product_variants fv ON fv.product_id = products.id AND fv.is_active").
+		Joins("CROSS JOIN LATERAL jsonb_array_elements(CASE WHEN jsonb_typeof(fv.attributes) = 'array' THEN fv.attributes ELSE '[]'::jsonb END) AS fa").
+		Select("fa->>'name' AS name, fa->>'value' AS value, COUNT(DISTINCT products.id) AS count").
+		Group("fa->>'name', fa->>'value'").
+		Order("name, count DESC, value").
+		Scan(&rows).Error
+	return rows, err
+}
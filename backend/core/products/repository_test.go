@@ -0,0 +1,93 @@
+package products
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestRepository(t *testing.T) ProductRepository {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&Product{}, &ProductImage{}, &ProductVariant{}, &BundleComponent{}, &ProductRevision{}, &ProductSlug{}, &PriceHistory{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewProductRepository(db)
+}
+
+// An update leaves the stock and the other optional fields alone unless the request sends them
+func TestUpdateKeepsUnsentFields(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t)
+	sale := 800
+	err := repo.Create(ctx, &Product{
+		ID: "p1", Name: "Tee", Slug: "tee", Price: 1000, IsActive: true, StockQuantity: 5,
+		SalePricing: SalePricing{CompareAtPrice: 1200, SalePrice: &sale},
+		TaxClass:    "reduced", WeightGrams: 300,
+		Variants: []ProductVariant{{ID: "v1", SKU: "TEE-M", Price: 1000, IsActive: true, StockQuantity: 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		wantStock   int
+		wantVariant int
+	}{
+		{
+			name:        "without stock_quantity",
+			body:        `{"name": "Tee", "price": 1100, "is_active": true, "variants": [{"id": "v1", "sku": "TEE-M", "price": 1100, "is_active": true}]}`,
+			wantStock:   5,
+			wantVariant: 3,
+		},
+		{
+			name:        "with stock_quantity",
+			body:        `{"name": "Tee", "price": 1100, "is_active": true, "stock_quantity": 7, "variants": [{"id": "v1", "sku": "TEE-M", "price": 1100, "is_active": true, "stock_quantity": 0}]}`,
+			wantStock:   7,
+			wantVariant: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ProductRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.Update(ctx, req.toProduct("p1")); err != nil {
+				t.Fatal(err)
+			}
+			got, err := repo.GetByID(ctx, "p1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Price != 1100 {
+				t.Errorf("Price = %d, want the sent 1100", got.Price)
+			}
+			if got.StockQuantity != tt.wantStock || got.Variants[0].StockQuantity != tt.wantVariant {
+				t.Errorf("stock = %d and %d on the variant, want %d and %d", got.StockQuantity, got.Variants[0].StockQuantity, tt.wantStock, tt.wantVariant)
+			}
+			if got.SalePrice == nil || *got.SalePrice != sale || got.CompareAtPrice != 1200 {
+				t.Errorf("sale = %v at compare %d, want the stored %d at 1200", got.SalePrice, got.CompareAtPrice, sale)
+			}
+			if got.TaxClass != "reduced" || got.WeightGrams != 300 {
+				t.Errorf("tax class %q and weight %d, want the stored reduced and 300", got.TaxClass, got.WeightGrams)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package products
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision actions
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionDelete   = "delete"
+	RevisionRestore  = "restore"
+	RevisionRollback = "rollback"
+	// Applied by the publish scheduler
+	RevisionPublish   = "publish"
+	RevisionUnpublish = "unpublish"
+)
+
+// ProductRevision is a full snapshot of a product, its images and variants, taken after each change.
+// Revisions are numbered per product starting at 1.
+type ProductRevision struct {
+	ID             string         `gorm:"primaryKey" json:"id"`
+	ProductID      string         `gorm:"uniqueIndex:idx_product_revision;not null" json:"product_id"`
+	Revision       int            `gorm:"uniqueIndex:idx_product_revision;not null" json:"revision"`
+	Action         string         `gorm:"not null" json:"action"`
+	SourceRevision *int           `json:"source_revision,omitempty"` // the revision a rollback restored
+	Snapshot       datatypes.JSON `gorm:"type:jsonb" json:"snapshot,omitempty"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (r *ProductRevision) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	return
+}
+
+// Product decodes the snapshot
+func (r *ProductRevision) Product() (*Product, error) {
+	var product Product
+	if err := json.Unmarshal(r.Snapshot, &product); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// saveRevision snapshots the product as it is now inside tx, deleted or not. Every product write
+// goes through it, so it also bumps the product version and appends to the price history.
+func saveRevision(tx *gorm.DB, productID, action string, source *int) error {
+	err := tx.Unscoped().Model(&Product{}).Where("id = ?", productID).
+		UpdateColumn("version", gorm.Expr("version + 1")).Error
+	if err != nil {
+		return err
+	}
+	var product Product
+	err = tx.Unscoped().Preload("Images", orderedImages).Preload("Variants").Preload("Components", orderedComponents).First(&product, "id = ?", productID).Error
+	if err != nil {
+		return err
+	}
+	if err := recordPrices(tx, &product); err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+	var last int
+	err = tx.Model(&ProductRevision{}).Where("product_id = ?", productID).
+		Select("COALESCE(MAX(revision), 0)").Scan(&last).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(&ProductRevision{
+		ProductID:      productID,
+		Revision:       last + 1,
+		Action:         action,
+		SourceRevision: source,
+		Snapshot:       snapshot,
+	}).Error
+}
+
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// RevisionDiff lists the fields that differ between two revisions, sorted by field path.
+// Variant fields are addressed as variants[<sku>].<field> and bundle components as
+// components[<product_id>/<variant_id>].quantity; a missing side is null.
+type RevisionDiff struct {
+	ProductID string        `json:"product_id"`
+	From      int           `json:"from"`
+	To        int           `json:"to"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// DiffProducts compares two product snapshots field by field
+func DiffProducts(from, to *Product) []FieldChange {
+	a, b := flattenProduct(from), flattenProduct(to)
+	fields := make([]string, 0, len(a)+len(b))
+	for field := range a {
+		fields = append(fields, field)
+	}
+	for field := range b {
+		if _, ok := a[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := make([]FieldChange, 0)
+	for _, field := range fields {
+		if !reflect.DeepEqual(a[field], b[field]) {
+			changes = append(changes, FieldChange{Field: field, From: a[field], To: b[field]})
+		}
+	}
+	return changes
+}
+
+func flattenProduct(p *Product) map[string]interface{} {
+	fields := map[string]interface{}{
+		"name":             p.Name,
+		"category_id":      p.CategoryID,
+		"category":         p.Category,
+		"description":      p.Description,
+		"price":            p.Price,
+		"compare_at_price": p.CompareAtPrice,
+		"sale_price":       p.SalePrice,
+		"sale_starts_at":   p.SaleStartsAt,
+		"sale_ends_at":     p.SaleEndsAt,
+		"featured":         p.Featured,
+		"is_active":        p.IsActive,
+		"stock_quantity":   p.StockQuantity,
+		"deleted":          p.DeletedAt.Valid,
+		"publish_at":       p.PublishAt,
+		"unpublish_at":     p.UnpublishAt,
+	}
+	images := make([]string, 0, len(p.Images))
+	for _, img := range p.Images {
+		images = append(images, img.ImageURL)
+	}
+	fields["images"] = images
+	fields["options"] = p.OptionList()
+	if p.Digital {
+		fields["digital"] = true
+	}
+	if p.LowStockThreshold != nil {
+		fields["low_stock_threshold"] = *p.LowStockThreshold
+	}
+	if p.TaxClass != "" && p.TaxClass != TaxClassStandard {
+		fields["tax_class"] = p.TaxClass
+	}
+	for name, value := range map[string]int{"weight_grams": p.WeightGrams, "length_mm": p.LengthMM, "width_mm": p.WidthMM, "height_mm": p.HeightMM} {
+		if value != 0 {
+			fields[name] = value
+		}
+	}
+	if p.IsBundle() {
+		fields["type"] = p.Type
+		fields["bundle_discount_percent"] = p.BundleDiscountPercent
+	}
+	for _, c := range p.Components {
+		fields["components["+c.ProductID+"/"+c.VariantID+"].quantity"] = c.Quantity
+	}
+	for _, v := range p.Variants {
+		key := v.SKU
+		if key == "" {
+			key = v.ID
+		}
+		prefix := "variants[" + key + "]."
+		attrs := make(map[string]string)
+		var pairs []map[string]string
+		_ = json.Unmarshal(v.Attributes, &pairs)
+		for _, pair := range pairs {
+			attrs[pair["name"]] = pair["value"]
+		}
+		fields[prefix+"attributes"] = attrs
+		fields[prefix+"image_url"] = v.ImageURL
+		fields[prefix+"price"] = v.Price
+		fields[prefix+"compare_at_price"] = v.CompareAtPrice
+		fields[prefix+"sale_price"] = v.SalePrice
+		fields[prefix+"sale_starts_at"] = v.SaleStartsAt
+		fields[prefix+"sale_ends_at"] = v.SaleEndsAt
+		fields[prefix+"in_stock"] = v.InStock
+		fields[prefix+"is_active"] = v.IsActive
+		fields[prefix+"stock_quantity"] = v.StockQuantity
+	}
+	return fields
+}
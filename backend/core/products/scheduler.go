@@ -0,0 +1,94 @@
+package products
+
+import (
+	"context"
+	"time"
+
+	"ecommerce-backend/common/constants"
+	"github.com/sirupsen/logrus"
+)
+
+// AdminEventEmitter sends SSE events to connected admins
+type AdminEventEmitter interface {
+	EmitAdminEvent(event interface{})
+}
+
+// PublishScheduler applies publish_at and unpublish_at once they pass. Every instance may run one;
+// the repository makes sure each transition is applied and announced only once.
+type PublishScheduler struct {
+	repo         ProductRepository
+	invalidation CartInvalidationRepository
+	events       AdminEventEmitter
+	ticker       *time.Ticker
+	stop         chan bool
+}
+
+// NewPublishScheduler starts checking every interval
+func NewPublishScheduler(repo ProductRepository, invalidation CartInvalidationRepository, events AdminEventEmitter, interval time.Duration) *PublishScheduler {
+	s := &PublishScheduler{
+		repo:         repo,
+		invalidation: invalidation,
+		events:       events,
+		ticker:       time.NewTicker(interval),
+		stop:         make(chan bool),
+	}
+	go func() {
+		s.run()
+		for {
+			select {
+			case <-s.ticker.C:
+				s.run()
+			case <-s.stop:
+				s.ticker.Stop()
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (s *PublishScheduler) run() {
+	ctx := context.Background()
+	now := time.Now()
+	published, unpublished, err := s.repo.ApplySchedule(ctx, now)
+	if err != nil {
+		logrus.Errorf("Failed to apply product publishing schedule: %v", err)
+		return
+	}
+	if len(published)+len(unpublished) == 0 {
+		return
+	}
+	logrus.Infof("Publishing schedule: %d published, %d unpublished", len(published), len(unpublished))
+	if _, err := s.invalidation.InvalidateCart(ctx); err != nil {
+		logrus.Warnf("Failed to invalidate carts after scheduled publishing: %v", err)
+	}
+	if s.events == nil {
+		return
+	}
+	for _, change := range published {
+		s.emit(constants.EVENT_PRODUCT_PUBLISHED, change, true, now)
+	}
+	for _, change := range unpublished {
+		s.emit(constants.EVENT_PRODUCT_UNPUBLISHED, change, false, now)
+	}
+}
+
+func (s *PublishScheduler) emit(eventType string, change ScheduledChange, active bool, at time.Time) {
+	s.events.EmitAdminEvent(map[string]interface{}{
+		"resource":      constants.CHAT_RESOURCE_PRODUCTS,
+		"resource_type": eventType,
+		"data": map[string]interface{}{
+			"product_id": change.ID,
+			"name":       change.Name,
+			"is_active":  active,
+			"at":         at,
+		},
+	})
+}
+
+// Stop stops the scheduler goroutine
+func (s *PublishScheduler) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+	}
+}
@@ -0,0 +1,184 @@
+package products
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrUnknownCategory = errors.New("unknown category")
+
+// Sort orders accepted by ProductFilter.Sort
+const (
+	SortNewest    = "newest"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	SortNameAsc   = "name_asc"
+	SortNameDesc  = "name_desc"
+	SortFeatured  = "featured"
+)
+
+// Facet keys used to leave a facet's own filter out when counting it
+const (
+	facetCategory = "category"
+	facetPrice    = "price"
+	facetFeatured = "featured"
+	facetInStock  = "in_stock"
+	facetAttr     = "attr:"
+)
+
+// effectivePriceSQL is the price a shopper pays first: the cheapest active variant, else the product price, sales applied.
+// Bundles priced by discount cost their discounted components.
+var effectivePriceSQL = "(CASE WHEN products.type = 'bundle' AND products.bundle_discount_percent > 0 THEN " + bundlePriceSQL +
+	" ELSE COALESCE((SELECT MIN(" + salePriceSQL("ev") + ") FROM product_variants ev WHERE ev.product_id = products.id AND ev.is_active), " + salePriceSQL("products") + ") END)"
+
+// bundlePriceSQL mirrors Product.PriceAt for bundles priced by discount
+var bundlePriceSQL = "(SELECT COALESCE(SUM(bc.quantity * COALESCE(CASE WHEN bc.variant_id <> '' THEN " + salePriceSQL("cv") + " ELSE " + salePriceSQL("cp") + " END, 0)), 0)" +
+	" * (100 - products.bundle_discount_percent) / 100 FROM product_bundle_components bc" +
+	" LEFT JOIN products cp ON cp.id = bc.product_id AND cp.deleted_at IS NULL" +
+	" LEFT JOIN product_variants cv ON cv.id = bc.variant_id AND cv.is_active AND cp.id IS NOT NULL" +
+	" WHERE bc.bundle_id = products.id)"
+
+// inStockSQL mirrors TransformProductToResponse: sellable variants, product stock when there are none, or for a
+// bundle, enough of every component
+const inStockSQL = `(EXISTS (SELECT 1 FROM product_variants sv WHERE sv.product_id = products.id AND sv.is_active AND sv.in_stock AND (products.digital OR sv.stock_quantity - sv.reserved_quantity > 0))
+	OR (products.digital AND NOT EXISTS (SELECT 1 FROM product_variants sv WHERE sv.product_id = products.id AND sv.is_active))
+	OR (NOT EXISTS (SELECT 1 FROM product_variants sv WHERE sv.product_id = products.id AND sv.is_active) AND products.stock_quantity - products.reserved_quantity > 0)
+	OR (products.type = 'bundle' AND NOT EXISTS (SELECT 1 FROM product_bundle_components bc
+		LEFT JOIN products cp ON cp.id = bc.product_id AND cp.deleted_at IS NULL
+		LEFT JOIN product_variants cv ON cv.id = bc.variant_id AND cv.is_active AND cv.in_stock
+		WHERE bc.bundle_id = products.id AND (cp.id IS NULL OR COALESCE(CASE WHEN bc.variant_id <> ''
+			THEN cv.stock_quantity - cv.reserved_quantity ELSE cp.stock_quantity - cp.reserved_quantity END, 0) < bc.quantity))))`
+
+// ProductFilter describes a catalogue query. Zero values mean "no filter".
+type ProductFilter struct {
+	Query           string
+	Category        string   // category ID or slug as requested
+	CategoryIDs     []string // the category and its descendants, resolved by the service
+	MinPrice        *int
+	MaxPrice        *int
+	Featured        *bool
+	InStock         *bool
+	Attributes      map[string][]string // attribute name -> accepted values; names AND, values OR
+	IncludeInactive bool                // also inactive products and those outside their publishing window
+	Sort            string
+	Skip            int
+	Take            int
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type PriceRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// ProductFacets counts products per filter value. Each facet is computed with every
+// other active filter applied but not its own, so selecting a value never hides its siblings.
+type ProductFacets struct {
+	Categories []FacetCount            `json:"categories"`
+	Featured   int64                   `json:"featured"`
+	InStock    int64                   `json:"in_stock"`
+	Price      PriceRange              `json:"price"`
+	Attributes map[string][]FacetCount `json:"attributes"`
+}
+
+// visibleScope keeps products shoppers can see now, see Product.IsVisible
+func visibleScope(db *gorm.DB) *gorm.DB {
+	now := time.Now()
+	return db.Where("products.is_active = ?", true).
+		Where("(products.publish_at IS NULL OR products.publish_at <= ?)", now).
+		Where("(products.unpublish_at IS NULL OR products.unpublish_at > ?)", now)
+}
+
+// scope applies the filter to a query on the products table, skipping the facet named by except
+func (f ProductFilter) scope(except string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !f.IncludeInactive {
+			db = visibleScope(db)
+		}
+		if q := strings.TrimSpace(f.Query); q != "" {
+			like := "%" + escapeLike(q) + "%"
+			db = db.Where("(products.name ILIKE ? OR products.description ILIKE ?)", like, like)
+		}
+		if len(f.CategoryIDs) > 0 && except != facetCategory {
+			db = db.Where("products.category_id IN ?", f.CategoryIDs)
+		}
+		if except != facetPrice {
+			if f.MinPrice != nil {
+				db = db.Where(effectivePriceSQL+" >= ?", *f.MinPrice)
+			}
+			if f.MaxPrice != nil {
+				db = db.Where(effectivePriceSQL+" <= ?", *f.MaxPrice)
+			}
+		}
+		if f.Featured != nil && except != facetFeatured {
+			db = db.Where("products.featured = ?", *f.Featured)
+		}
+		if f.InStock != nil && except != facetInStock {
+			if *f.InStock {
+				db = db.Where(inStockSQL)
+			} else {
+				db = db.Where("NOT " + inStockSQL)
+			}
+		}
+		exceptAttr := ""
+		if strings.HasPrefix(except, facetAttr) {
+			exceptAttr = strings.TrimPrefix(except, facetAttr)
+		}
+		if clause, args := f.attributesClause(exceptAttr); clause != "" {
+			db = db.Where(clause, args...)
+		}
+		return db
+	}
+}
+
+// attributesClause matches products with one active variant carrying all requested attributes
+func (f ProductFilter) attributesClause(exceptName string) (string, []interface{}) {
+	groups := make([]string, 0, len(f.Attributes))
+	args := make([]interface{}, 0)
+	for name, values := range f.Attributes {
+		if name == exceptName || len(values) == 0 {
+			continue
+		}
+		ors := make([]string, 0, len(values))
+		for _, value := range values {
+			pair, _ := json.Marshal([]map[string]string{{"name": name, "value": value}})
+			ors = append(ors, "av.attributes @> CAST(? AS jsonb)")
+			args = append(args, string(pair))
+		}
+		groups = append(groups, "("+strings.Join(ors, " OR ")+")")
+	}
+	if len(groups) == 0 {
+		return "", nil
+	}
+	return "EXISTS (SELECT 1 FROM product_variants av WHERE av.product_id = products.id AND av.is_active AND " +
+		strings.Join(groups, " AND ") + ")", args
+}
+
+func (f ProductFilter) orderClause() string {
+	switch f.Sort {
+	case SortPriceAsc:
+		return effectivePriceSQL + " ASC, products.id"
+	case SortPriceDesc:
+		return effectivePriceSQL + " DESC, products.id"
+	case SortNameAsc:
+		return "products.name ASC, products.id"
+	case SortNameDesc:
+		return "products.name DESC, products.id"
+	case SortFeatured:
+		return "products.featured DESC, products.created_at DESC, products.id"
+	default:
+		return "products.created_at DESC, products.id"
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
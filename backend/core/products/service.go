@@ -2,30 +2,119 @@ package products
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ecommerce-backend/core/categories"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProductNotFound = errors.New("product not found")
+	ErrSKURequired     = errors.New("every variant needs a sku")
+	ErrDuplicateSKU    = errors.New("sku already in use")
+	ErrSKUChanged      = errors.New("sku of an existing variant cannot change")
+	ErrInvalidSchedule = errors.New("unpublish_at must be after publish_at")
 )
 
+// checkSchedule validates the publishing window and every sale window of the product
+func checkSchedule(product *Product) error {
+	if product.PublishAt != nil && product.UnpublishAt != nil && !product.UnpublishAt.After(*product.PublishAt) {
+		return ErrInvalidSchedule
+	}
+	if err := product.SalePricing.validate(); err != nil {
+		return err
+	}
+	for _, v := range product.Variants {
+		if err := v.SalePricing.validate(); err != nil {
+			return fmt.Errorf("variant %s: %w", v.SKU, err)
+		}
+	}
+	return nil
+}
+
+func isVariantSKUError(err error) bool {
+	return errors.Is(err, ErrSKURequired) || errors.Is(err, ErrDuplicateSKU) || errors.Is(err, ErrSKUChanged)
+}
+
 type ProductService interface {
 	CreateProduct(ctx context.Context, product *Product) (string, error)
 	UpdateProduct(ctx context.Context, product *Product) error
 	DeleteProduct(ctx context.Context, id string) error
 	GetProductByID(ctx context.Context, id string) (*Product, error)
+	GetProductBySlug(ctx context.Context, slug string) (*Product, string, error)
 	PaginatedListProducts(ctx context.Context, skip, take int) ([]Product, int64, error)
-	GetCartHash(ctx context.Context) (string, error)
+	SearchProducts(ctx context.Context, filter ProductFilter) ([]Product, int64, error)
+	ProductFacets(ctx context.Context, filter ProductFilter) (*ProductFacets, error)
+	ExportProducts(ctx context.Context) ([]Product, error)
+	ImportProducts(ctx context.Context, rows []ImportRow, dryRun bool) (*ImportReport, error)
+	// GetCartHash returns a hash that changes when one of the products in a cart is written.
+	// Without products it returns the global hash kept for older clients, which changes on every product write.
+	GetCartHash(ctx context.Context, productIDs []string) (string, error)
+	RelatedProducts(ctx context.Context, id string, limit int) ([]Product, error)
+	ValidateCart(ctx context.Context, lines []CartLine) (*CartValidation, error)
+	PriceHistory(ctx context.Context, productID string) ([]PriceHistory, error)
+	GenerateVariants(ctx context.Context, productID string, matrix VariantMatrix, dryRun bool) (*Product, error)
+	ListDeletedProducts(ctx context.Context) ([]Product, error)
+	RestoreProduct(ctx context.Context, id string) error
+	ListRevisions(ctx context.Context, productID string) ([]ProductRevision, error)
+	GetRevision(ctx context.Context, productID string, revision int) (*ProductRevision, error)
+	DiffRevisions(ctx context.Context, productID string, from, to int) (*RevisionDiff, error)
+	RollbackProduct(ctx context.Context, productID string, revision int) (*Product, error)
+	// Localize translates public responses; see PreferredLocales
+	Localize(ctx context.Context, resps []ProductResponse, locales []string) error
+	ListTranslations(ctx context.Context, productID string) ([]ProductTranslation, error)
+	SaveTranslation(ctx context.Context, productID, locale string, req TranslationRequest) (*ProductTranslation, error)
+	DeleteTranslation(ctx context.Context, productID, locale string) error
+	// ListStockAlerts returns open stock alerts, or all of them; see StockMonitor
+	ListStockAlerts(ctx context.Context, includeAcknowledged bool, skip, take int) ([]StockAlert, int64, error)
+	AcknowledgeStockAlert(ctx context.Context, id uint) error
+}
+
+// UpdateListener hears about every product saved through UpdateProduct, with the stored product
+// before and after the change. It runs on the request path, so slow work belongs in a goroutine.
+type UpdateListener interface {
+	ProductUpdated(ctx context.Context, before, after *Product)
 }
 
 type productService struct {
 	repo         ProductRepository
 	invalidation CartInvalidationRepository
+	categories   categories.CategoryRepository
+	listeners    []UpdateListener
 }
 
-func NewProductService(repo ProductRepository, invalidation CartInvalidationRepository) ProductService {
+func NewProductServiceWithListeners(repo ProductRepository, invalidation CartInvalidationRepository, categoryRepo categories.CategoryRepository, listeners ...UpdateListener) ProductService {
 	return &productService{
 		repo:         repo,
 		invalidation: invalidation,
+		categories:   categoryRepo,
+		listeners:    listeners,
 	}
 }
 
 func (s *productService) CreateProduct(ctx context.Context, product *Product) (string, error) {
+	if err := checkSchedule(product); err != nil {
+		return "", err
+	}
+	if err := checkVariantOptions(product); err != nil {
+		return "", err
+	}
+	if err := s.resolveCategory(ctx, product); err != nil {
+		return "", err
+	}
+	if err := s.checkBundle(ctx, product); err != nil {
+		return "", err
+	}
+	if err := s.assignSlug(ctx, product, nil, nil); err != nil {
+		return "", err
+	}
+	if err := s.checkVariantSKUs(ctx, product, nil); err != nil {
+		return "", err
+	}
 	if err := s.repo.Create(ctx, product); err != nil {
 		return "", err
 	}
@@ -35,16 +124,104 @@ func (s *productService) CreateProduct(ctx context.Context, product *Product) (s
 }
 
 func (s *productService) UpdateProduct(ctx context.Context, product *Product) error {
+	existing, err := s.repo.GetByID(ctx, product.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProductNotFound
+		}
+		return err
+	}
+	keepUnsent(product, existing)
+	if err := checkSchedule(product); err != nil {
+		return err
+	}
+	if err := checkVariantOptions(product); err != nil {
+		return err
+	}
+	if err := s.resolveCategory(ctx, product); err != nil {
+		return err
+	}
+	if err := s.checkBundle(ctx, product); err != nil {
+		return err
+	}
+	if err := s.assignSlug(ctx, product, existing, nil); err != nil {
+		return err
+	}
+	if err := s.checkVariantSKUs(ctx, product, existing); err != nil {
+		return err
+	}
 	if err := s.repo.Update(ctx, product); err != nil {
 		return err
 	}
 	// Invalidate cart when a product is updated
 	_, _ = s.invalidation.InvalidateCart(ctx)
+	s.notifyUpdated(ctx, existing)
 	return nil
 }
 
+// keepUnsent fills the fields the update request left out from the stored product, so checks and
+// listeners see what the product will hold. The repository leaves their columns alone.
+func keepUnsent(product, existing *Product) {
+	for field := range product.unsent {
+		switch field {
+		case "stock_quantity":
+			product.StockQuantity = existing.StockQuantity
+		case "compare_at_price":
+			product.CompareAtPrice = existing.CompareAtPrice
+		case "sale_price":
+			product.SalePrice = existing.SalePrice
+		case "sale_starts_at":
+			product.SaleStartsAt = existing.SaleStartsAt
+		case "sale_ends_at":
+			product.SaleEndsAt = existing.SaleEndsAt
+		case "digital":
+			product.Digital = existing.Digital
+		case "publish_at":
+			product.PublishAt = existing.PublishAt
+		case "unpublish_at":
+			product.UnpublishAt = existing.UnpublishAt
+		case "options":
+			product.Options = existing.Options
+		case "type":
+			product.Type = existing.Type
+		case "bundle_discount_percent":
+			product.BundleDiscountPercent = existing.BundleDiscountPercent
+		case "components":
+			product.Components = existing.Components
+		case "low_stock_threshold":
+			product.LowStockThreshold = existing.LowStockThreshold
+		case "tax_class":
+			product.TaxClass = existing.TaxClass
+		case "weight_grams":
+			product.WeightGrams = existing.WeightGrams
+		case "length_mm":
+			product.LengthMM = existing.LengthMM
+		case "width_mm":
+			product.WidthMM = existing.WidthMM
+		case "height_mm":
+			product.HeightMM = existing.HeightMM
+		}
+	}
+}
+
+func (s *productService) notifyUpdated(ctx context.Context, before *Product) {
+	if len(s.listeners) == 0 {
+		return
+	}
+	after, err := s.repo.GetByID(ctx, before.ID)
+	if err != nil {
+		return
+	}
+	for _, listener := range s.listeners {
+		listener.ProductUpdated(ctx, before, after)
+	}
+}
+
 func (s *productService) DeleteProduct(ctx context.Context, id string) error {
 	if err := s.repo.Delete(ctx, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProductNotFound
+		}
 		return err
 	}
 	// Invalidate cart when a product is deleted
@@ -52,14 +229,467 @@ func (s *productService) DeleteProduct(ctx context.Context, id string) error {
 	return nil
 }
 
+// GenerateVariants sets the product's options and replaces its variants with the matrix.
+// With dryRun the generated product is returned without being saved.
+func (s *productService) GenerateVariants(ctx context.Context, productID string, matrix VariantMatrix, dryRun bool) (*Product, error) {
+	existing, err := s.repo.GetByID(ctx, productID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	variants, err := GenerateVariants(existing, matrix)
+	if err != nil {
+		return nil, err
+	}
+	product := *existing
+	product.Options, _ = json.Marshal(matrix.Options)
+	product.Variants = variants
+	if err := checkVariantOptions(&product); err != nil {
+		return nil, err
+	}
+	if err := s.checkBundle(ctx, &product); err != nil {
+		return nil, err
+	}
+	if err := s.checkVariantSKUs(ctx, &product, existing); err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return &product, nil
+	}
+	if err := s.repo.Update(ctx, &product); err != nil {
+		return nil, err
+	}
+	_, _ = s.invalidation.InvalidateCart(ctx)
+	return s.repo.GetByID(ctx, productID)
+}
+
+func (s *productService) PriceHistory(ctx context.Context, productID string) ([]PriceHistory, error) {
+	return s.repo.PriceHistory(ctx, productID)
+}
+
+func (s *productService) ListDeletedProducts(ctx context.Context) ([]Product, error) {
+	return s.repo.ListDeleted(ctx)
+}
+
+func (s *productService) RestoreProduct(ctx context.Context, id string) error {
+	if err := s.repo.Restore(ctx, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProductNotFound
+		}
+		return err
+	}
+	_, _ = s.invalidation.InvalidateCart(ctx)
+	return nil
+}
+
+func (s *productService) ListRevisions(ctx context.Context, productID string) ([]ProductRevision, error) {
+	return s.repo.ListRevisions(ctx, productID)
+}
+
+func (s *productService) GetRevision(ctx context.Context, productID string, revision int) (*ProductRevision, error) {
+	return s.repo.GetRevision(ctx, productID, revision)
+}
+
+func (s *productService) DiffRevisions(ctx context.Context, productID string, from, to int) (*RevisionDiff, error) {
+	snapshots := make([]*Product, 2)
+	for i, n := range []int{from, to} {
+		rev, err := s.repo.GetRevision(ctx, productID, n)
+		if err != nil {
+			return nil, err
+		}
+		if snapshots[i], err = rev.Product(); err != nil {
+			return nil, err
+		}
+	}
+	return &RevisionDiff{
+		ProductID: productID,
+		From:      from,
+		To:        to,
+		Changes:   DiffProducts(snapshots[0], snapshots[1]),
+	}, nil
+}
+
+// RollbackProduct restores the content of an earlier revision, undeleting the product if needed.
+// Stock levels are operational data and keep their current values.
+func (s *productService) RollbackProduct(ctx context.Context, productID string, revision int) (*Product, error) {
+	rev, err := s.repo.GetRevision(ctx, productID, revision)
+	if err != nil {
+		return nil, err
+	}
+	product, err := rev.Product()
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.repo.GetByIDUnscoped(ctx, productID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
+	product.ID = current.ID
+	product.StockQuantity = current.StockQuantity
+	stock := make(map[string]int, len(current.Variants))
+	for _, v := range current.Variants {
+		stock[v.ID] = v.StockQuantity
+	}
+	for i := range product.Variants {
+		product.Variants[i].StockQuantity = stock[product.Variants[i].ID]
+	}
+	if err := s.resolveCategory(ctx, product); err != nil {
+		return nil, err
+	}
+	if err := s.checkBundle(ctx, product); err != nil {
+		return nil, err
+	}
+	// A slug given away since the revision stays with its new product
+	if err := s.assignSlug(ctx, product, current, nil); errors.Is(err, ErrSlugTaken) || errors.Is(err, ErrEmptySlug) {
+		product.Slug = current.Slug
+	} else if err != nil {
+		return nil, err
+	}
+	if err := s.checkVariantSKUs(ctx, product, current); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Rollback(ctx, product, revision); err != nil {
+		return nil, err
+	}
+	_, _ = s.invalidation.InvalidateCart(ctx)
+	return s.repo.GetByID(ctx, productID)
+}
+
 func (s *productService) GetProductByID(ctx context.Context, id string) (*Product, error) {
 	return s.repo.GetByID(ctx, id)
 }
 
+// GetProductBySlug finds a product by its current slug. For a slug the product used before, it
+// returns the current slug to redirect to instead.
+func (s *productService) GetProductBySlug(ctx context.Context, slug string) (*Product, string, error) {
+	product, err := s.repo.GetBySlug(ctx, slug)
+	if err == nil {
+		return product, "", nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", err
+	}
+	current, err := s.repo.CurrentSlug(ctx, slug)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", ErrProductNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return nil, current, nil
+}
+
+// RelatedProducts lists products frequently bought with a visible product
+func (s *productService) RelatedProducts(ctx context.Context, id string, limit int) ([]Product, error) {
+	product, err := s.repo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !product.IsVisible(time.Now())) {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Related(ctx, product, limit)
+}
+
 func (s *productService) PaginatedListProducts(ctx context.Context, skip, take int) ([]Product, int64, error) {
 	return s.repo.PaginatedList(ctx, skip, take)
 }
 
-func (s *productService) GetCartHash(ctx context.Context) (string, error) {
-	return s.invalidation.GetCurrentHash(ctx)
+func (s *productService) SearchProducts(ctx context.Context, filter ProductFilter) ([]Product, int64, error) {
+	if err := s.expandCategory(ctx, &filter); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.Search(ctx, filter)
+}
+
+func (s *productService) ProductFacets(ctx context.Context, filter ProductFilter) (*ProductFacets, error) {
+	if err := s.expandCategory(ctx, &filter); err != nil {
+		return nil, err
+	}
+	return s.repo.Facets(ctx, filter)
+}
+
+func (s *productService) ExportProducts(ctx context.Context) ([]Product, error) {
+	return s.repo.ListAll(ctx)
+}
+
+// ImportProducts validates every row and matches it to an existing product by ID or variant SKU.
+// Nothing is written unless every row is valid and dryRun is false; then all rows go in one transaction.
+func (s *productService) ImportProducts(ctx context.Context, rows []ImportRow, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{DryRun: dryRun, Rows: make([]ImportRowResult, 0, len(rows))}
+	var creates, updates []*Product
+	var createRows []int
+	seenSKU := make(map[string]int)
+	seenID := make(map[string]int)
+	slugs := make(map[string]bool)
+
+	for _, row := range rows {
+		result := ImportRowResult{Line: row.Line, Name: row.Request.Name, Errors: append([]string{}, row.Errors...)}
+		product := row.Request.toProduct("")
+		result.Errors = append(result.Errors, validateImportProduct(product)...)
+
+		for _, v := range product.Variants {
+			if v.SKU == "" {
+				continue
+			}
+			if line, dup := seenSKU[v.SKU]; dup {
+				result.Errors = append(result.Errors, fmt.Sprintf("sku %q already used on line %d", v.SKU, line))
+			}
+			seenSKU[v.SKU] = row.Line
+		}
+		categoryRef := product.CategoryID
+		if categoryRef == "" {
+			categoryRef = product.Category
+		}
+		if err := s.resolveCategory(ctx, product); err != nil {
+			if !errors.Is(err, ErrUnknownCategory) {
+				return nil, err
+			}
+			result.Errors = append(result.Errors, fmt.Sprintf("unknown category %q", categoryRef))
+		}
+
+		existing, err := s.matchImportProduct(ctx, product)
+		if err != nil {
+			if !errors.Is(err, errImportConflict) {
+				return nil, err
+			}
+			result.Errors = append(result.Errors, err.Error())
+		}
+		if existing != nil && existing.DeletedAt.Valid {
+			result.Errors = append(result.Errors, "product is deleted; restore it before importing")
+		}
+		if existing != nil && existing.IsBundle() {
+			result.Errors = append(result.Errors, "bundles cannot be imported; edit them through the API")
+		}
+		if existing != nil {
+			product.ID = existing.ID
+			keepUnsent(product, existing)
+			adoptVariantIDs(product, existing)
+			result.Action = "update"
+		} else {
+			result.Action = "create"
+		}
+		if err := s.checkVariantSKUs(ctx, product, existing); err != nil {
+			if !isVariantSKUError(err) {
+				return nil, err
+			}
+			result.Errors = append(result.Errors, err.Error())
+		}
+		if err := s.assignSlug(ctx, product, existing, slugs); err != nil {
+			if !errors.Is(err, ErrSlugTaken) && !errors.Is(err, ErrEmptySlug) {
+				return nil, err
+			}
+			result.Errors = append(result.Errors, err.Error())
+		}
+		if product.ID != "" {
+			if line, dup := seenID[product.ID]; dup {
+				result.Errors = append(result.Errors, fmt.Sprintf("product already imported on line %d", line))
+			}
+			seenID[product.ID] = row.Line
+		}
+		result.ProductID = product.ID
+
+		if len(result.Errors) > 0 {
+			report.Failed++
+		} else if existing != nil {
+			report.Updated++
+			updates = append(updates, product)
+		} else {
+			report.Created++
+			creates = append(creates, product)
+			createRows = append(createRows, len(report.Rows))
+		}
+		report.Rows = append(report.Rows, result)
+	}
+
+	if dryRun || report.Failed > 0 || len(creates)+len(updates) == 0 {
+		return report, nil
+	}
+	if err := s.repo.Import(ctx, creates, updates); err != nil {
+		return nil, err
+	}
+	report.Applied = true
+	for i, product := range creates {
+		report.Rows[createRows[i]].ProductID = product.ID
+	}
+	_, _ = s.invalidation.InvalidateCart(ctx)
+	return report, nil
+}
+
+// checkVariantSKUs rejects SKUs repeated in the payload or owned by another product, and SKU
+// changes on existing variants. existing is nil for new products.
+func (s *productService) checkVariantSKUs(ctx context.Context, product *Product, existing *Product) error {
+	current := make(map[string]string)
+	if existing != nil {
+		for _, v := range existing.Variants {
+			current[v.ID] = v.SKU
+		}
+	}
+	seen := make(map[string]bool, len(product.Variants))
+	for _, v := range product.Variants {
+		if v.SKU == "" {
+			return ErrSKURequired
+		}
+		if seen[v.SKU] {
+			return fmt.Errorf("%w: %s", ErrDuplicateSKU, v.SKU)
+		}
+		seen[v.SKU] = true
+		if old, ok := current[v.ID]; ok && old != "" && old != v.SKU {
+			return fmt.Errorf("%w: %s", ErrSKUChanged, old)
+		}
+		owner, err := s.repo.GetByVariantSKU(ctx, v.SKU)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if existing == nil || owner.ID != existing.ID {
+			return fmt.Errorf("%w: %s", ErrDuplicateSKU, v.SKU)
+		}
+	}
+	return nil
+}
+
+var errImportConflict = errors.New("variant skus belong to different products")
+
+// matchImportProduct finds the product a row updates: by ID first, then by any of its variant SKUs
+func (s *productService) matchImportProduct(ctx context.Context, product *Product) (*Product, error) {
+	if product.ID != "" {
+		existing, err := s.repo.GetByIDUnscoped(ctx, product.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return existing, err
+	}
+	var match *Product
+	for _, v := range product.Variants {
+		if v.SKU == "" {
+			continue
+		}
+		existing, err := s.repo.GetByVariantSKU(ctx, v.SKU)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if match != nil && match.ID != existing.ID {
+			return match, errImportConflict
+		}
+		match = existing
+	}
+	return match, nil
+}
+
+// adoptVariantIDs keeps the IDs of existing variants that the import addresses by SKU only
+func adoptVariantIDs(product, existing *Product) {
+	bySKU := make(map[string]string, len(existing.Variants))
+	for _, v := range existing.Variants {
+		if v.SKU != "" {
+			bySKU[v.SKU] = v.ID
+		}
+	}
+	for i := range product.Variants {
+		if product.Variants[i].ID == "" {
+			product.Variants[i].ID = bySKU[product.Variants[i].SKU]
+		}
+	}
+}
+
+func validateImportProduct(product *Product) []string {
+	var errs []string
+	if strings.TrimSpace(product.Name) == "" {
+		errs = append(errs, "name is required")
+	}
+	if product.Price < 0 {
+		errs = append(errs, "price must not be negative")
+	}
+	if product.StockQuantity < 0 {
+		errs = append(errs, "stock_quantity must not be negative")
+	}
+	if err := checkSchedule(product); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := checkVariantOptions(product); err != nil {
+		errs = append(errs, err.Error())
+	}
+	for _, v := range product.Variants {
+		if v.Price < 0 || v.StockQuantity < 0 {
+			errs = append(errs, fmt.Sprintf("variant %q: price and stock_quantity must not be negative", v.SKU))
+		}
+	}
+	return errs
+}
+
+// resolveCategory links the product to an existing category, given by ID or by slug.
+// Unknown categories are rejected instead of silently creating a new one.
+func (s *productService) resolveCategory(ctx context.Context, product *Product) error {
+	ref := product.CategoryID
+	if ref == "" {
+		ref = product.Category
+	}
+	if ref == "" {
+		product.Category = ""
+		return nil
+	}
+	category, err := s.categories.GetByRef(ctx, ref)
+	if err != nil {
+		if errors.Is(err, categories.ErrCategoryNotFound) {
+			return ErrUnknownCategory
+		}
+		return err
+	}
+	product.CategoryID = category.ID
+	product.Category = category.Slug
+	return nil
+}
+
+// expandCategory turns the requested category into it and all of its descendants
+func (s *productService) expandCategory(ctx context.Context, filter *ProductFilter) error {
+	if filter.Category == "" {
+		return nil
+	}
+	category, err := s.categories.GetByRef(ctx, filter.Category)
+	if err != nil {
+		if errors.Is(err, categories.ErrCategoryNotFound) {
+			return ErrUnknownCategory
+		}
+		return err
+	}
+	ids, err := s.categories.DescendantIDs(ctx, category.ID, filter.IncludeInactive)
+	if err != nil {
+		return err
+	}
+	filter.CategoryIDs = ids
+	return nil
+}
+
+func (s *productService) GetCartHash(ctx context.Context, productIDs []string) (string, error) {
+	if len(productIDs) == 0 {
+		return s.invalidation.GetCurrentHash(ctx)
+	}
+	return s.invalidation.GetProductsHash(ctx, productIDs)
+}
+
+func (s *productService) ValidateCart(ctx context.Context, lines []CartLine) (*CartValidation, error) {
+	ids := make([]string, 0, len(lines))
+	for _, line := range lines {
+		ids = append(ids, line.ProductID)
+	}
+	found, err := s.repo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*Product, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+	return ValidateCart(lines, byID, time.Now()), nil
 }
@@ -0,0 +1,182 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"ecommerce-backend/common/slug"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSlugTaken = errors.New("product slug already in use")
+	ErrEmptySlug = errors.New("product slug is empty")
+)
+
+// ProductSlug is a slug a product used before. It stays reserved for that product and redirects
+// to its current slug, so shared links keep working.
+type ProductSlug struct {
+	Slug      string    `gorm:"primaryKey" json:"slug"`
+	ProductID string    `gorm:"index;not null" json:"product_id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// SlugOwner returns the ID of the product using slug now or in the past, deleted products
+// included, or "" when it is free
+func (r *productRepository) SlugOwner(ctx context.Context, s string) (string, error) {
+	var ids []string
+	err := r.db.WithContext(ctx).Raw(`SELECT id FROM products WHERE slug = ?
+		UNION ALL SELECT product_id FROM product_slugs WHERE slug = ? LIMIT 1`, s, s).Scan(&ids).Error
+	if err != nil || len(ids) == 0 {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+func (r *productRepository) GetBySlug(ctx context.Context, s string) (*Product, error) {
+	var product Product
+	err := r.db.WithContext(ctx).Preload("Images", orderedImages).Preload("Variants").Scopes(withComponents).
+		First(&product, "slug = ? AND slug <> ''", s).Error
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// CurrentSlug follows an old slug to the slug its product uses now
+func (r *productRepository) CurrentSlug(ctx context.Context, old string) (string, error) {
+	var current []string
+	err := r.db.WithContext(ctx).Table("product_slugs").
+		Joins("JOIN products p ON p.id = product_slugs.product_id AND p.deleted_at IS NULL").
+		Where("product_slugs.slug = ? AND p.slug <> ''", old).
+		Limit(1).Pluck("p.slug", &current).Error
+	if err != nil {
+		return "", err
+	}
+	if len(current) == 0 {
+		return "", gorm.ErrRecordNotFound
+	}
+	return current[0], nil
+}
+
+// recordSlugChange keeps the product's previous slug as a redirect once it changes, and drops
+// the redirect of a slug the product takes back. previous is the slug stored before the update.
+func recordSlugChange(tx *gorm.DB, productID, previous, current string) error {
+	if previous == current {
+		return nil
+	}
+	if err := tx.Where("slug = ? AND product_id = ?", current, productID).Delete(&ProductSlug{}).Error; err != nil {
+		return err
+	}
+	if previous == "" {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "slug"}},
+		DoUpdates: clause.AssignmentColumns([]string{"product_id"}),
+	}).Create(&ProductSlug{Slug: previous, ProductID: productID}).Error
+}
+
+// assignSlug settles product.Slug before a write. An admin-chosen slug is normalised and must be
+// free; without one the product keeps existing's slug or gets one generated from its name.
+// reserved holds slugs already handed out in the same batch and may be nil.
+func (s *productService) assignSlug(ctx context.Context, product, existing *Product, reserved map[string]bool) error {
+	if product.Slug == "" {
+		if existing != nil && existing.Slug != "" {
+			product.Slug = existing.Slug
+			return nil
+		}
+		return s.generateSlug(ctx, product, reserved)
+	}
+	requested := slug.Make(product.Slug)
+	if requested == "" {
+		return ErrEmptySlug
+	}
+	if reserved[requested] {
+		return ErrSlugTaken
+	}
+	owner, err := s.repo.SlugOwner(ctx, requested)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != product.ID {
+		return ErrSlugTaken
+	}
+	product.Slug = requested
+	if reserved != nil {
+		reserved[requested] = true
+	}
+	return nil
+}
+
+// generateSlug uses the name, then name-2, name-3 and so on until one is free
+func (s *productService) generateSlug(ctx context.Context, product *Product, reserved map[string]bool) error {
+	base := slug.Make(product.Name)
+	if base == "" {
+		base = "product"
+	}
+	candidate := base
+	for n := 2; ; n++ {
+		if !reserved[candidate] {
+			owner, err := s.repo.SlugOwner(ctx, candidate)
+			if err != nil {
+				return err
+			}
+			if owner == "" || owner == product.ID {
+				break
+			}
+		}
+		if n > 50 {
+			candidate = base + "-" + uuid.New().String()[:8]
+			break
+		}
+		candidate = base + "-" + strconv.Itoa(n)
+	}
+	product.Slug = candidate
+	if reserved != nil {
+		reserved[candidate] = true
+	}
+	return nil
+}
+
+// BackfillSlugs gives every product without a slug one made from its name, oldest product first
+// so it keeps the plain slug. It runs after the products AutoMigrate.
+func BackfillSlugs(db *gorm.DB) error {
+	var missing []Product
+	err := db.Unscoped().Select("id", "name").Where("slug IS NULL OR slug = ''").
+		Order("created_at, id").Find(&missing).Error
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+	var used []string
+	if err := db.Unscoped().Model(&Product{}).Where("slug <> ''").Pluck("slug", &used).Error; err != nil {
+		return err
+	}
+	var old []string
+	if err := db.Model(&ProductSlug{}).Pluck("slug", &old).Error; err != nil {
+		return err
+	}
+	taken := make(map[string]bool, len(used)+len(old)+len(missing))
+	for _, s := range append(used, old...) {
+		taken[s] = true
+	}
+	for _, p := range missing {
+		base := slug.Make(p.Name)
+		if base == "" {
+			base = "product"
+		}
+		candidate := base
+		for n := 2; taken[candidate]; n++ {
+			candidate = base + "-" + strconv.Itoa(n)
+		}
+		taken[candidate] = true
+		if err := db.Unscoped().Model(&Product{}).Where("id = ?", p.ID).UpdateColumn("slug", candidate).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
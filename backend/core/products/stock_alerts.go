@@ -0,0 +1,244 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ecommerce-backend/common/constants"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Kinds of stock alert
+const (
+	StockAlertLowStock   = "low_stock"
+	StockAlertOutOfStock = "out_of_stock"
+)
+
+var ErrStockAlertNotFound = errors.New("stock alert not found")
+
+// StockAlert records the stock of a product, or of one of its variants, falling below its
+// threshold or running out. It stays open until an admin acknowledges it.
+type StockAlert struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	ProductID      string     `gorm:"index;not null" json:"product_id"`
+	VariantID      string     `json:"variant_id,omitempty"`
+	SKU            string     `json:"sku,omitempty"`
+	Name           string     `json:"name"`
+	Kind           string     `gorm:"not null" json:"kind"` // StockAlertLowStock or StockAlertOutOfStock
+	Available      int        `json:"available"`
+	Threshold      int        `json:"threshold"`
+	Cause          string     `json:"cause"` // "order" or "update"
+	CreatedAt      time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+	AcknowledgedAt *time.Time `gorm:"index" json:"acknowledged_at"`
+}
+
+// stockLevel is what a stock alert watches on a product without variants or on one variant
+type stockLevel struct {
+	sku       string
+	available int
+	inStock   bool
+}
+
+func (l stockLevel) out() bool {
+	return !l.inStock || l.available <= 0
+}
+
+// stockLevels maps "" to a product without variants, or each active variant ID to that
+// variant. Bundles hold no stock of their own and digital products keep none; they have none.
+func stockLevels(p *Product) map[string]stockLevel {
+	levels := make(map[string]stockLevel)
+	if p.IsBundle() || !p.TracksStock() {
+		return levels
+	}
+	hasVariants := false
+	for i := range p.Variants {
+		v := &p.Variants[i]
+		if !v.IsActive {
+			continue
+		}
+		levels[v.ID] = stockLevel{sku: v.SKU, available: v.Available(), inStock: v.InStock}
+		hasVariants = true
+	}
+	if !hasVariants {
+		levels[""] = stockLevel{available: p.Available(), inStock: true}
+	}
+	return levels
+}
+
+// stockAlertKind reports the alert due when stock goes from before to after: running out, or
+// dropping below threshold while some is left. Staying low or out raises nothing.
+func stockAlertKind(before, after stockLevel, threshold int) string {
+	if before.out() {
+		return ""
+	}
+	if after.out() {
+		return StockAlertOutOfStock
+	}
+	if after.available < threshold && before.available >= threshold {
+		return StockAlertLowStock
+	}
+	return ""
+}
+
+// StockMonitor raises stock alerts after orders reserve stock and after admins update products,
+// and announces each to admins as a products.low_stock event
+type StockMonitor struct {
+	repo      ProductRepository
+	events    AdminEventEmitter
+	threshold int
+}
+
+// NewStockMonitor uses threshold for products without their own LowStockThreshold
+func NewStockMonitor(repo ProductRepository, events AdminEventEmitter, threshold int) *StockMonitor {
+	return &StockMonitor{repo: repo, events: events, threshold: threshold}
+}
+
+func (m *StockMonitor) thresholdOf(p *Product) int {
+	if p.LowStockThreshold != nil {
+		return *p.LowStockThreshold
+	}
+	return m.threshold
+}
+
+// StockReserved checks the lines an order has just reserved
+func (m *StockMonitor) StockReserved(ctx context.Context, lines []StockLine) {
+	ids := make([]string, 0, len(lines))
+	for _, line := range lines {
+		ids = append(ids, line.ProductID)
+	}
+	found, err := m.repo.GetByIDs(ctx, ids)
+	if err != nil {
+		logrus.Errorf("Failed to load products for stock alerts: %v", err)
+		return
+	}
+	byID := make(map[string]*Product, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+	var alerts []StockAlert
+	for _, line := range lines {
+		p := byID[line.ProductID]
+		if p == nil {
+			continue
+		}
+		after, ok := stockLevels(p)[line.VariantID]
+		if !ok {
+			continue
+		}
+		before := after
+		before.available += line.Quantity
+		if kind := stockAlertKind(before, after, m.thresholdOf(p)); kind != "" {
+			alerts = append(alerts, m.alert(p, line.VariantID, after, kind, "order"))
+		}
+	}
+	if len(alerts) > 0 {
+		go m.raise(alerts)
+	}
+}
+
+// ProductUpdated implements UpdateListener; it catches stock lowered or variants marked out of stock
+func (m *StockMonitor) ProductUpdated(ctx context.Context, before, after *Product) {
+	old := stockLevels(before)
+	var alerts []StockAlert
+	for id, level := range stockLevels(after) {
+		prev, ok := old[id]
+		if !ok {
+			continue
+		}
+		if kind := stockAlertKind(prev, level, m.thresholdOf(after)); kind != "" {
+			alerts = append(alerts, m.alert(after, id, level, kind, "update"))
+		}
+	}
+	if len(alerts) > 0 {
+		go m.raise(alerts)
+	}
+}
+
+func (m *StockMonitor) alert(p *Product, variantID string, level stockLevel, kind, cause string) StockAlert {
+	return StockAlert{
+		ProductID: p.ID,
+		VariantID: variantID,
+		SKU:       level.sku,
+		Name:      p.Name,
+		Kind:      kind,
+		Available: level.available,
+		Threshold: m.thresholdOf(p),
+		Cause:     cause,
+	}
+}
+
+// raise records the alerts and announces them
+func (m *StockMonitor) raise(alerts []StockAlert) {
+	ctx := context.Background()
+	for i := range alerts {
+		alert := &alerts[i]
+		if err := m.repo.CreateStockAlert(ctx, alert); err != nil {
+			logrus.Errorf("Failed to record stock alert for product %s: %v", alert.ProductID, err)
+			continue
+		}
+		logrus.Infof("Stock alert: %s %s/%s has %d left", alert.Kind, alert.ProductID, alert.VariantID, alert.Available)
+		if m.events == nil {
+			continue
+		}
+		m.events.EmitAdminEvent(map[string]interface{}{
+			"resource":      constants.CHAT_RESOURCE_PRODUCTS,
+			"resource_type": constants.EVENT_PRODUCTS_LOW_STOCK,
+			"data": map[string]interface{}{
+				"alert_id":   alert.ID,
+				"kind":       alert.Kind,
+				"product_id": alert.ProductID,
+				"variant_id": alert.VariantID,
+				"sku":        alert.SKU,
+				"name":       alert.Name,
+				"available":  alert.Available,
+				"threshold":  alert.Threshold,
+				"cause":      alert.Cause,
+			},
+		})
+	}
+}
+
+func (s *productService) ListStockAlerts(ctx context.Context, includeAcknowledged bool, skip, take int) ([]StockAlert, int64, error) {
+	return s.repo.ListStockAlerts(ctx, includeAcknowledged, skip, take)
+}
+
+func (s *productService) AcknowledgeStockAlert(ctx context.Context, id uint) error {
+	return s.repo.AcknowledgeStockAlert(ctx, id, time.Now())
+}
+
+func (r *productRepository) CreateStockAlert(ctx context.Context, alert *StockAlert) error {
+	return r.db.WithContext(ctx).Create(alert).Error
+}
+
+// ListStockAlerts returns open alerts, or all of them, newest first
+func (r *productRepository) ListStockAlerts(ctx context.Context, includeAcknowledged bool, skip, take int) ([]StockAlert, int64, error) {
+	var alerts []StockAlert
+	var count int64
+	q := r.db.WithContext(ctx).Model(&StockAlert{})
+	if !includeAcknowledged {
+		q = q.Where("acknowledged_at IS NULL")
+	}
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := q.Order("created_at DESC, id DESC").Offset(skip).Limit(take).Find(&alerts).Error; err != nil {
+		return nil, 0, err
+	}
+	return alerts, count, nil
+}
+
+// AcknowledgeStockAlert keeps the first acknowledgement time when repeated
+func (r *productRepository) AcknowledgeStockAlert(ctx context.Context, id uint, at time.Time) error {
+	res := r.db.WithContext(ctx).Model(&StockAlert{}).Where("id = ? AND acknowledged_at IS NULL", id).Update("acknowledged_at", at)
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+	var alert StockAlert
+	err := r.db.WithContext(ctx).Select("id").First(&alert, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrStockAlertNotFound
+	}
+	return err
+}
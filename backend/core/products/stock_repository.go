@@ -0,0 +1,116 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// StockLine is one product or variant quantity to move through the stock ledger.
+// An empty VariantID targets the product level stock.
+type StockLine struct {
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+// BackfillStock gives quantity on hand to products and in-stock variants that predate stock
+// tracking, so upgraded catalogues stay sellable. It runs after the products AutoMigrate that adds
+// the stock columns, and never again. Bundles and digital products keep no stock of their own.
+func BackfillStock(db *gorm.DB, quantity int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`UPDATE product_variants SET stock_quantity = ? WHERE in_stock AND stock_quantity = 0`, quantity).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE products SET stock_quantity = ? WHERE stock_quantity = 0 AND type <> ? AND NOT digital
+			AND NOT EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = products.id AND v.is_active)`, quantity, ProductTypeBundle).Error
+	})
+}
+
+// StockRepository moves quantities between on hand and reserved.
+// Every method applies all lines in one transaction so a partial failure changes nothing.
+type StockRepository interface {
+	// Reserve holds stock for an order, failing with ErrInsufficientStock if any line is short
+	Reserve(ctx context.Context, lines []StockLine) error
+	// Release returns reserved stock to the available pool
+	Release(ctx context.Context, lines []StockLine) error
+	// Commit removes reserved stock from on hand once goods have left the warehouse
+	Commit(ctx context.Context, lines []StockLine) error
+	// Restock puts committed goods back on hand, e.g. after a return
+	Restock(ctx context.Context, lines []StockLine) error
+}
+
+type stockRepository struct {
+	db *gorm.DB
+}
+
+// NewStockRepository accepts either the root connection or an open transaction
+func NewStockRepository(db *gorm.DB) StockRepository {
+	return &stockRepository{db: db}
+}
+
+func (r *stockRepository) Reserve(ctx context.Context, lines []StockLine) error {
+	// The availability check lives in the WHERE clause so Postgres row locks serialise
+	// concurrent checkouts; the loser re-evaluates the predicate and updates nothing.
+	return r.apply(ctx, lines,
+		"reserved_quantity = reserved_quantity + ?",
+		"stock_quantity - reserved_quantity >= ?",
+		ErrInsufficientStock)
+}
+
+func (r *stockRepository) Release(ctx context.Context, lines []StockLine) error {
+	return r.apply(ctx, lines,
+		"reserved_quantity = GREATEST(reserved_quantity - ?, 0)",
+		"", nil)
+}
+
+func (r *stockRepository) Commit(ctx context.Context, lines []StockLine) error {
+	return r.apply(ctx, lines,
+		"stock_quantity = GREATEST(stock_quantity - ?, 0), reserved_quantity = GREATEST(reserved_quantity - ?, 0)",
+		"", nil)
+}
+
+func (r *stockRepository) Restock(ctx context.Context, lines []StockLine) error {
+	return r.apply(ctx, lines,
+		"stock_quantity = stock_quantity + ?",
+		"", nil)
+}
+
+// apply runs setExpr for each line, binding the line quantity to every placeholder.
+// When guard is set, a line whose guard does not hold aborts the transaction with guardErr.
+func (r *stockRepository) apply(ctx context.Context, lines []StockLine, setExpr, guard string, guardErr error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, line := range lines {
+			if line.Quantity <= 0 {
+				continue
+			}
+			table, key := "products", line.ProductID
+			if line.VariantID != "" {
+				table, key = "product_variants", line.VariantID
+			}
+			args := make([]interface{}, 0, 4)
+			for i := 0; i < strings.Count(setExpr, "?"); i++ {
+				args = append(args, line.Quantity)
+			}
+			sql := "UPDATE " + table + " SET " + setExpr + " WHERE id = ?"
+			args = append(args, key)
+			if guard != "" {
+				sql += " AND " + guard
+				args = append(args, line.Quantity)
+			}
+			res := tx.Exec(sql, args...)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 && guardErr != nil {
+				return guardErr
+			}
+		}
+		return nil
+	})
+}
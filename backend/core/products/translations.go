@@ -0,0 +1,269 @@
+package products
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ecommerce-backend/internal/config"
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidLocale       = errors.New("invalid locale")
+	ErrDefaultLocale       = errors.New("the default locale is the product's own content; update the product instead")
+	ErrTranslationNotFound = errors.New("translation not found")
+)
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// maxPreferredLocales bounds the locales taken from one request
+const maxPreferredLocales = 10
+
+// ProductTranslation is a product's content in one locale. Empty fields fall back to the product's
+// own content, which is in the default locale.
+type ProductTranslation struct {
+	ProductID   string         `gorm:"primaryKey" json:"product_id"`
+	Locale      string         `gorm:"primaryKey" json:"locale"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Attributes  datatypes.JSON `json:"attributes"` // attribute name -> AttributeLabel
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// AttributeLabel translates a variant attribute name and, keyed by the stored value, its values.
+// Variants keep their stored attributes so option matching is unaffected; labels are for display.
+type AttributeLabel struct {
+	Label  string            `json:"label,omitempty"`
+	Values map[string]string `json:"values,omitempty"`
+}
+
+type TranslationRequest struct {
+	Name        string                    `json:"name"`
+	Description string                    `json:"description"`
+	Attributes  map[string]AttributeLabel `json:"attributes"`
+}
+
+// NormalizeLocale lowercases a BCP 47 style tag and uses dashes, e.g. "pt_BR" becomes "pt-br".
+// It returns "" for anything that does not look like a language tag.
+func NormalizeLocale(s string) string {
+	s = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), "_", "-"))
+	if !localePattern.MatchString(s) {
+		return ""
+	}
+	return s
+}
+
+// DefaultLocale is the language of the content stored on products themselves
+func DefaultLocale() string {
+	if locale := NormalizeLocale(config.Get().Localization.DefaultLocale); locale != "" {
+		return locale
+	}
+	return "en"
+}
+
+// PreferredLocales lists the locales a request accepts, best first, always ending with the
+// default locale. The locale query parameter wins over Accept-Language; a regional tag is followed
+// by its language, so "de-CH" also accepts "de".
+func PreferredLocales(ctx *gin.Context) []string {
+	var tags []string
+	if locale := ctx.Query("locale"); locale != "" {
+		tags = []string{locale}
+	} else {
+		tags = parseAcceptLanguage(ctx.GetHeader("Accept-Language"))
+	}
+	seen := make(map[string]bool)
+	locales := make([]string, 0, len(tags)+1)
+	add := func(locale string) {
+		if locale != "" && !seen[locale] && len(locales) < maxPreferredLocales {
+			seen[locale] = true
+			locales = append(locales, locale)
+		}
+	}
+	for _, tag := range tags {
+		locale := NormalizeLocale(tag)
+		add(locale)
+		if i := strings.IndexByte(locale, '-'); i > 0 {
+			add(locale[:i])
+		}
+	}
+	def := DefaultLocale()
+	if seen[def] {
+		// Anything after the default would never be served
+		for i, locale := range locales {
+			if locale == def {
+				return locales[:i+1]
+			}
+		}
+	}
+	return append(locales, def)
+}
+
+// parseAcceptLanguage returns the tags of an Accept-Language header by descending quality,
+// dropping "*" and tags with q=0
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
+
+// applyTranslation overlays the non-empty translated fields onto resp
+func applyTranslation(resp *ProductResponse, t *ProductTranslation) {
+	resp.Locale = t.Locale
+	if t.Name != "" {
+		resp.Name = t.Name
+	}
+	if t.Description != "" {
+		resp.Description = t.Description
+	}
+	var labels map[string]AttributeLabel
+	if len(t.Attributes) > 0 && json.Unmarshal(t.Attributes, &labels) == nil && len(labels) > 0 {
+		resp.AttributeLabels = labels
+	}
+}
+
+// Localize translates responses into the first of locales each product has a translation for.
+// locales comes from PreferredLocales; its last entry, the default locale, serves the product's
+// own content.
+func (s *productService) Localize(ctx context.Context, resps []ProductResponse, locales []string) error {
+	if len(resps) == 0 || len(locales) == 0 {
+		return nil
+	}
+	def := locales[len(locales)-1]
+	for i := range resps {
+		resps[i].Locale = def
+	}
+	if len(locales) == 1 {
+		return nil
+	}
+	ids := make([]string, len(resps))
+	for i := range resps {
+		ids[i] = resps[i].ID
+	}
+	found, err := s.repo.TranslationsFor(ctx, ids, locales[:len(locales)-1])
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string]*ProductTranslation, len(found))
+	for i := range found {
+		byKey[found[i].ProductID+"/"+found[i].Locale] = &found[i]
+	}
+	for i := range resps {
+		for _, locale := range locales[:len(locales)-1] {
+			if t, ok := byKey[resps[i].ID+"/"+locale]; ok {
+				applyTranslation(&resps[i], t)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (s *productService) ListTranslations(ctx context.Context, productID string) ([]ProductTranslation, error) {
+	if _, err := s.repo.GetByID(ctx, productID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	return s.repo.ListTranslations(ctx, productID)
+}
+
+func (s *productService) SaveTranslation(ctx context.Context, productID, locale string, req TranslationRequest) (*ProductTranslation, error) {
+	locale = NormalizeLocale(locale)
+	if locale == "" {
+		return nil, ErrInvalidLocale
+	}
+	if locale == DefaultLocale() {
+		return nil, ErrDefaultLocale
+	}
+	if _, err := s.repo.GetByID(ctx, productID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	t := &ProductTranslation{ProductID: productID, Locale: locale, Name: req.Name, Description: req.Description}
+	if len(req.Attributes) > 0 {
+		t.Attributes, _ = json.Marshal(req.Attributes)
+	}
+	if err := s.repo.SaveTranslation(ctx, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *productService) DeleteTranslation(ctx context.Context, productID, locale string) error {
+	return s.repo.DeleteTranslation(ctx, productID, NormalizeLocale(locale))
+}
+
+func (r *productRepository) TranslationsFor(ctx context.Context, productIDs, locales []string) ([]ProductTranslation, error) {
+	var translations []ProductTranslation
+	err := r.db.WithContext(ctx).Where("product_id IN ? AND locale IN ?", productIDs, locales).Find(&translations).Error
+	if err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+func (r *productRepository) ListTranslations(ctx context.Context, productID string) ([]ProductTranslation, error) {
+	var translations []ProductTranslation
+	err := r.db.WithContext(ctx).Where("product_id = ?", productID).Order("locale").Find(&translations).Error
+	if err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// SaveTranslation replaces the translation of the product in its locale
+func (r *productRepository) SaveTranslation(ctx context.Context, t *ProductTranslation) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "attributes", "updated_at"}),
+	}).Create(t).Error
+}
+
+func (r *productRepository) DeleteTranslation(ctx context.Context, productID, locale string) error {
+	res := r.db.WithContext(ctx).Where("product_id = ? AND locale = ?", productID, locale).Delete(&ProductTranslation{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrTranslationNotFound
+	}
+	return nil
+}
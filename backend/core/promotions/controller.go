@@ -0,0 +1,180 @@
+package promotions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ecommerce-backend/common/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type PromotionController struct {
+	service   PromotionService
+	validator *validator.Validate
+}
+
+func NewPromotionController(s PromotionService) *PromotionController {
+	return &PromotionController{
+		service:   s,
+		validator: validator.New(),
+	}
+}
+
+type PromotionRequest struct {
+	Code           string     `json:"code" validate:"required,max=64"`
+	Description    string     `json:"description"`
+	Kind           string     `json:"kind" validate:"required,oneof=percent fixed free_shipping buy_x_get_y"`
+	PercentOff     int        `json:"percent_off" validate:"gte=0,lte=100"`
+	AmountOff      int        `json:"amount_off" validate:"gte=0"`
+	BuyQuantity    int        `json:"buy_quantity" validate:"gte=0"`
+	GetQuantity    int        `json:"get_quantity" validate:"gte=0"`
+	ProductIDs     []string   `json:"product_ids"`
+	MinSubtotal    int        `json:"min_subtotal" validate:"gte=0"`
+	MaxUses        int        `json:"max_uses" validate:"gte=0"`
+	MaxUsesPerUser int        `json:"max_uses_per_user" validate:"gte=0"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	IsActive       bool       `json:"is_active"`
+}
+
+func (c *PromotionController) RegisterRoutes(r *gin.Engine) {
+	group := r.Group("/promotions")
+	group.Use(middleware.AdminKeyMiddleware())
+	group.GET("", c.ListPromotions)
+	group.GET(":id", c.GetPromotion)
+	group.GET(":id/redemptions", c.ListRedemptions)
+	group.POST("", c.CreatePromotion)
+	group.PUT(":id", c.UpdatePromotion)
+	group.DELETE(":id", c.DeletePromotion)
+}
+
+func (c *PromotionController) ListPromotions(ctx *gin.Context) {
+	skip, take := pagination(ctx)
+	list, total, err := c.service.ListPromotions(context.Background(), skip, take)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	ctx.JSON(http.StatusOK, list)
+}
+
+func (c *PromotionController) GetPromotion(ctx *gin.Context) {
+	promotion, err := c.service.GetPromotion(context.Background(), ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, promotion)
+}
+
+// ListRedemptions lists the orders that used the promotion, newest first
+func (c *PromotionController) ListRedemptions(ctx *gin.Context) {
+	skip, take := pagination(ctx)
+	list, total, err := c.service.ListRedemptions(context.Background(), ctx.Param("id"), skip, take)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	ctx.JSON(http.StatusOK, list)
+}
+
+func (c *PromotionController) CreatePromotion(ctx *gin.Context) {
+	var req PromotionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	promotion, err := c.service.CreatePromotion(context.Background(), req.toPromotion(""))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, promotion)
+}
+
+func (c *PromotionController) UpdatePromotion(ctx *gin.Context) {
+	var req PromotionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	promotion, err := c.service.UpdatePromotion(context.Background(), req.toPromotion(ctx.Param("id")))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, promotion)
+}
+
+// DeletePromotion removes the code; past redemptions stay on record
+func (c *PromotionController) DeletePromotion(ctx *gin.Context) {
+	if err := c.service.DeletePromotion(context.Background(), ctx.Param("id")); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deleted": true})
+}
+
+func (c *PromotionController) Name() string {
+	return "promotions"
+}
+
+func (r PromotionRequest) toPromotion(id string) *Promotion {
+	promotion := &Promotion{
+		ID:             id,
+		Code:           r.Code,
+		Description:    r.Description,
+		Kind:           r.Kind,
+		PercentOff:     r.PercentOff,
+		AmountOff:      r.AmountOff,
+		BuyQuantity:    r.BuyQuantity,
+		GetQuantity:    r.GetQuantity,
+		MinSubtotal:    r.MinSubtotal,
+		MaxUses:        r.MaxUses,
+		MaxUsesPerUser: r.MaxUsesPerUser,
+		StartsAt:       r.StartsAt,
+		EndsAt:         r.EndsAt,
+		IsActive:       r.IsActive,
+	}
+	promotion.SetProductIDs(r.ProductIDs)
+	return promotion
+}
+
+func pagination(ctx *gin.Context) (int, int) {
+	skip, _ := strconv.Atoi(ctx.DefaultQuery("skip", "0"))
+	take, _ := strconv.Atoi(ctx.DefaultQuery("take", "50"))
+	if skip < 0 {
+		skip = 0
+	}
+	if take <= 0 || take > 200 {
+		take = 50
+	}
+	return skip, take
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrPromotionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrCodeTaken):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidPromotion):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
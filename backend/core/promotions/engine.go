@@ -0,0 +1,94 @@
+package promotions
+
+import "sort"
+
+// eligible returns the indexes of the lines the promotion applies to
+func (p *Promotion) eligible(lines []Line) []int {
+	ids := p.productIDs()
+	only := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		only[id] = true
+	}
+	var indexes []int
+	for i, l := range lines {
+		if len(only) == 0 || only[l.ProductID] {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// apply takes the promotion off the lines. left holds what is still owed on each line after
+// the promotions applied before, and is reduced in place; no line goes below zero.
+func (p *Promotion) apply(lines []Line, left []int) AppliedPromotion {
+	applied := AppliedPromotion{PromotionID: p.ID, Code: p.Code, Kind: p.Kind, Description: p.Description, Lines: []LineDiscount{}}
+	eligible := p.eligible(lines)
+	off := make([]int, len(lines))
+	switch p.Kind {
+	case KindPercent:
+		for _, i := range eligible {
+			off[i] = left[i] * p.PercentOff / 100
+		}
+	case KindFixed:
+		total := 0
+		for _, i := range eligible {
+			total += left[i]
+		}
+		amount := min(p.AmountOff, total)
+		if amount <= 0 {
+			break
+		}
+		// Each line takes its share rounded down; the rounding goes to the first lines with room
+		spread := 0
+		for _, i := range eligible {
+			off[i] = amount * left[i] / total
+			spread += off[i]
+		}
+		for _, i := range eligible {
+			extra := min(amount-spread, left[i]-off[i])
+			off[i] += extra
+			spread += extra
+		}
+	case KindBuyXGetY:
+		group := p.BuyQuantity + p.GetQuantity
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			break
+		}
+		units := 0
+		for _, i := range eligible {
+			units += max(lines[i].Quantity, 0)
+		}
+		// Every full group earns GetQuantity free units, and a partial one those beyond BuyQuantity;
+		// the free units are the cheapest eligible ones
+		free := units/group*p.GetQuantity + max(units%group-p.BuyQuantity, 0)
+		sorted := append([]int(nil), eligible...)
+		sort.SliceStable(sorted, func(a, b int) bool {
+			return unitLeft(lines, left, sorted[a]) < unitLeft(lines, left, sorted[b])
+		})
+		for _, i := range sorted {
+			n := min(free, max(lines[i].Quantity, 0))
+			off[i] = n * unitLeft(lines, left, i)
+			free -= n
+		}
+	case KindFreeShipping:
+		applied.FreeShipping = true
+	}
+	for i := range off {
+		amount := min(off[i], left[i])
+		if amount <= 0 {
+			continue
+		}
+		left[i] -= amount
+		applied.Amount += amount
+		applied.Lines = append(applied.Lines, LineDiscount{Line: i, ProductID: lines[i].ProductID, VariantID: lines[i].VariantID, Amount: amount})
+	}
+	return applied
+}
+
+// unitLeft is what is still owed on one unit of line i
+func unitLeft(lines []Line, left []int, i int) int {
+	if lines[i].Quantity <= 0 {
+		return 0
+	}
+	return left[i] / lines[i].Quantity
+}
@@ -0,0 +1,140 @@
+package promotions
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPromotionApply(t *testing.T) {
+	tests := []struct {
+		name         string
+		promotion    Promotion
+		products     []string // ProductIDs the promotion is limited to
+		lines        []Line
+		want         []int // amount taken off each line
+		freeShipping bool
+	}{
+		{
+			name:      "percent off every line, rounded down",
+			promotion: Promotion{Kind: KindPercent, PercentOff: 10},
+			lines:     []Line{{ProductID: "a", Quantity: 1, UnitPrice: 1000}, {ProductID: "b", Quantity: 2, UnitPrice: 555}},
+			want:      []int{100, 111},
+		},
+		{
+			name:      "percent off limited to a product",
+			promotion: Promotion{Kind: KindPercent, PercentOff: 10},
+			products:  []string{"b"},
+			lines:     []Line{{ProductID: "a", Quantity: 1, UnitPrice: 1000}, {ProductID: "b", Quantity: 2, UnitPrice: 555}},
+			want:      []int{0, 111},
+		},
+		{
+			name:      "fixed amount spread by share",
+			promotion: Promotion{Kind: KindFixed, AmountOff: 100},
+			lines:     []Line{{ProductID: "a", Quantity: 1, UnitPrice: 300}, {ProductID: "b", Quantity: 1, UnitPrice: 700}},
+			want:      []int{30, 70},
+		},
+		{
+			name:      "fixed amount rounding goes to the first lines",
+			promotion: Promotion{Kind: KindFixed, AmountOff: 100},
+			lines:     []Line{{ProductID: "a", Quantity: 1, UnitPrice: 333}, {ProductID: "b", Quantity: 1, UnitPrice: 333}, {ProductID: "c", Quantity: 1, UnitPrice: 334}},
+			want:      []int{34, 33, 33},
+		},
+		{
+			name:      "fixed amount above the basket stops at zero",
+			promotion: Promotion{Kind: KindFixed, AmountOff: 5000},
+			lines:     []Line{{ProductID: "a", Quantity: 1, UnitPrice: 300}, {ProductID: "b", Quantity: 1, UnitPrice: 700}},
+			want:      []int{300, 700},
+		},
+		{
+			name:      "buy 2 get 1 on one line",
+			promotion: Promotion{Kind: KindBuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			lines:     []Line{{ProductID: "a", Quantity: 3, UnitPrice: 100}},
+			want:      []int{100},
+		},
+		{
+			name:      "buy 2 get 1 gives the cheapest unit away",
+			promotion: Promotion{Kind: KindBuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			lines:     []Line{{ProductID: "a", Quantity: 1, UnitPrice: 500}, {ProductID: "b", Quantity: 2, UnitPrice: 100}},
+			want:      []int{0, 100},
+		},
+		{
+			name:      "buy 2 get 1 with a partial group short of its free unit",
+			promotion: Promotion{Kind: KindBuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			lines:     []Line{{ProductID: "a", Quantity: 5, UnitPrice: 100}},
+			want:      []int{100},
+		},
+		{
+			name:      "buy 1 get 2 with a partial group past buy quantity",
+			promotion: Promotion{Kind: KindBuyXGetY, BuyQuantity: 1, GetQuantity: 2},
+			lines:     []Line{{ProductID: "a", Quantity: 1, UnitPrice: 900}, {ProductID: "b", Quantity: 1, UnitPrice: 200}},
+			want:      []int{0, 200},
+		},
+		{
+			name:      "buy 1 get 1 across lines frees the cheapest units first",
+			promotion: Promotion{Kind: KindBuyXGetY, BuyQuantity: 1, GetQuantity: 1},
+			lines:     []Line{{ProductID: "a", Quantity: 2, UnitPrice: 900}, {ProductID: "b", Quantity: 1, UnitPrice: 100}, {ProductID: "c", Quantity: 1, UnitPrice: 300}},
+			want:      []int{0, 100, 300},
+		},
+		{
+			name:      "buy x get y without a get quantity takes nothing",
+			promotion: Promotion{Kind: KindBuyXGetY, BuyQuantity: 2},
+			lines:     []Line{{ProductID: "a", Quantity: 3, UnitPrice: 100}},
+			want:      []int{0},
+		},
+		{
+			name:         "free shipping takes nothing off the lines",
+			promotion:    Promotion{Kind: KindFreeShipping},
+			lines:        []Line{{ProductID: "a", Quantity: 1, UnitPrice: 100}},
+			want:         []int{0},
+			freeShipping: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.promotion.SetProductIDs(tt.products)
+			left := make([]int, len(tt.lines))
+			for i, l := range tt.lines {
+				left[i] = l.UnitPrice * l.Quantity
+			}
+			applied := tt.promotion.apply(tt.lines, left)
+
+			got := make([]int, len(tt.lines))
+			total := 0
+			for _, d := range applied.Lines {
+				got[d.Line] = d.Amount
+				total += d.Amount
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("line discounts = %v, want %v", got, tt.want)
+			}
+			if applied.Amount != total {
+				t.Errorf("Amount = %d, want the sum of its lines %d", applied.Amount, total)
+			}
+			if applied.FreeShipping != tt.freeShipping {
+				t.Errorf("FreeShipping = %v, want %v", applied.FreeShipping, tt.freeShipping)
+			}
+			for i, l := range tt.lines {
+				if want := l.UnitPrice*l.Quantity - tt.want[i]; left[i] != want {
+					t.Errorf("left[%d] = %d, want %d", i, left[i], want)
+				}
+			}
+		})
+	}
+}
+
+// Promotions apply one after another, each to what the ones before left owed
+func TestPromotionApplyStacks(t *testing.T) {
+	lines := []Line{{ProductID: "a", Quantity: 1, UnitPrice: 1000}}
+	left := []int{1000}
+	fixed := Promotion{Kind: KindFixed, AmountOff: 200}
+	percent := Promotion{Kind: KindPercent, PercentOff: 50}
+	if got := fixed.apply(lines, left).Amount; got != 200 {
+		t.Fatalf("fixed Amount = %d, want 200", got)
+	}
+	if got := percent.apply(lines, left).Amount; got != 400 {
+		t.Fatalf("percent Amount = %d, want 400 off the 800 left", got)
+	}
+	if left[0] != 400 {
+		t.Fatalf("left = %d, want 400", left[0])
+	}
+}
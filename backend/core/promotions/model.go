@@ -0,0 +1,181 @@
+package promotions
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPromotionNotFound = errors.New("promotion not found")
+	ErrCodeTaken         = errors.New("promotion code already in use")
+	ErrInvalidPromotion  = errors.New("invalid promotion")
+)
+
+// Reasons a coupon code is refused at checkout, returned wrapped in a *CodeError
+var (
+	ErrUnknownCode    = errors.New("unknown coupon code")
+	ErrDuplicateCode  = errors.New("coupon code entered twice")
+	ErrCodeNotActive  = errors.New("coupon code is not valid at this time")
+	ErrMinimumNotMet  = errors.New("basket is below the minimum for this coupon code")
+	ErrNotApplicable  = errors.New("coupon code does not apply to this basket")
+	ErrUsageLimit     = errors.New("coupon code has been used up")
+	ErrUserLimit      = errors.New("coupon code already used the maximum number of times")
+	ErrSignInRequired = errors.New("sign in to use this coupon code")
+)
+
+// CodeError refuses one coupon code; it matches the reason with errors.Is
+type CodeError struct {
+	Code string
+	Err  error
+}
+
+func (e *CodeError) Error() string {
+	return e.Code + ": " + e.Err.Error()
+}
+
+func (e *CodeError) Unwrap() error {
+	return e.Err
+}
+
+// Kinds of promotion
+const (
+	KindPercent      = "percent"       // PercentOff of the eligible lines
+	KindFixed        = "fixed"         // AmountOff the eligible lines, spread by their share
+	KindFreeShipping = "free_shipping" // no shipping cost
+	KindBuyXGetY     = "buy_x_get_y"   // of every BuyQuantity + GetQuantity eligible units, the GetQuantity cheapest are free
+)
+
+// Promotion is a coupon code shoppers enter at checkout. It applies to the products in ProductIDs,
+// or to the whole basket when empty, from StartsAt until EndsAt.
+type Promotion struct {
+	ID             string         `gorm:"primaryKey" json:"id"`
+	Code           string         `gorm:"uniqueIndex;not null" json:"code"` // upper case
+	Description    string         `json:"description"`
+	Kind           string         `gorm:"not null" json:"kind"`
+	PercentOff     int            `gorm:"not null;default:0" json:"percent_off"`
+	AmountOff      int            `gorm:"not null;default:0" json:"amount_off"`
+	BuyQuantity    int            `gorm:"not null;default:0" json:"buy_quantity"`
+	GetQuantity    int            `gorm:"not null;default:0" json:"get_quantity"`
+	ProductIDs     datatypes.JSON `json:"product_ids"`
+	MinSubtotal    int            `gorm:"not null;default:0" json:"min_subtotal"`      // basket subtotal required, before discounts
+	MaxUses        int            `gorm:"not null;default:0" json:"max_uses"`          // 0 for unlimited
+	MaxUsesPerUser int            `gorm:"not null;default:0" json:"max_uses_per_user"` // 0 for unlimited; otherwise guests cannot use the code
+	UsedCount      int            `gorm:"not null;default:0" json:"used_count"`
+	StartsAt       *time.Time     `json:"starts_at"`
+	EndsAt         *time.Time     `json:"ends_at"`
+	IsActive       bool           `gorm:"not null" json:"is_active"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (p *Promotion) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	return
+}
+
+func (p *Promotion) productIDs() []string {
+	var ids []string
+	_ = json.Unmarshal(p.ProductIDs, &ids)
+	return ids
+}
+
+// SetProductIDs stores the products the promotion is limited to; none means all products
+func (p *Promotion) SetProductIDs(ids []string) {
+	if len(ids) == 0 {
+		p.ProductIDs = nil
+		return
+	}
+	b, _ := json.Marshal(ids)
+	p.ProductIDs = b
+}
+
+// ValidAt reports whether the promotion is switched on and inside its window at now
+func (p *Promotion) ValidAt(now time.Time) bool {
+	if !p.IsActive {
+		return false
+	}
+	if p.StartsAt != nil && now.Before(*p.StartsAt) {
+		return false
+	}
+	return p.EndsAt == nil || now.Before(*p.EndsAt)
+}
+
+// Redemption is one use of a promotion by an order
+type Redemption struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	OrderID     string    `gorm:"uniqueIndex:idx_promotion_redemptions_order;not null" json:"order_id"`
+	PromotionID string    `gorm:"uniqueIndex:idx_promotion_redemptions_order;index:idx_promotion_redemptions_user;not null" json:"promotion_id"`
+	UserID      string    `gorm:"index:idx_promotion_redemptions_user" json:"user_id"`
+	Code        string    `json:"code"`
+	Amount      int       `json:"amount"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (Redemption) TableName() string {
+	return "promotion_redemptions"
+}
+
+// NewRedemptions records the use of the quote's promotions by an order of userID ("" for a guest)
+func NewRedemptions(orderID, userID string, quote *Quote) []Redemption {
+	redemptions := make([]Redemption, 0, len(quote.Promotions))
+	for _, applied := range quote.Promotions {
+		redemptions = append(redemptions, Redemption{
+			OrderID:     orderID,
+			PromotionID: applied.PromotionID,
+			UserID:      userID,
+			Code:        applied.Code,
+			Amount:      applied.Amount,
+		})
+	}
+	return redemptions
+}
+
+// NormalizeCode makes codes case-insensitive
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Line is an order line as priced by the catalogue
+type Line struct {
+	ProductID string
+	VariantID string
+	Quantity  int
+	UnitPrice int
+}
+
+// LineDiscount is what one promotion takes off one line
+type LineDiscount struct {
+	Line      int    `json:"line"` // index of the line in the order
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id,omitempty"`
+	Amount    int    `json:"amount"`
+}
+
+// AppliedPromotion is one coupon code as applied to a basket
+type AppliedPromotion struct {
+	PromotionID  string         `json:"promotion_id"`
+	Code         string         `json:"code"`
+	Kind         string         `json:"kind"`
+	Description  string         `json:"description,omitempty"`
+	Amount       int            `json:"amount"`
+	FreeShipping bool           `json:"free_shipping,omitempty"`
+	Lines        []LineDiscount `json:"lines"`
+}
+
+// Quote is a basket with its coupon codes applied
+type Quote struct {
+	Subtotal      int                `json:"subtotal"`
+	Discount      int                `json:"discount"`
+	Total         int                `json:"total"`
+	FreeShipping  bool               `json:"free_shipping"`
+	LineDiscounts []int              `json:"line_discounts"` // total discount per line, in line order
+	Promotions    []AppliedPromotion `json:"promotions"`
+}
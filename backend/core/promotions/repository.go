@@ -0,0 +1,179 @@
+package promotions
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PromotionRepository interface {
+	Create(ctx context.Context, promotion *Promotion) error
+	Update(ctx context.Context, promotion *Promotion) error
+	Delete(ctx context.Context, id string) error
+	GetByID(ctx context.Context, id string) (*Promotion, error)
+	GetByCode(ctx context.Context, code string) (*Promotion, error)
+	List(ctx context.Context, skip, take int) ([]Promotion, int64, error)
+	CountRedemptions(ctx context.Context, promotionID, userID string) (int64, error)
+	ListRedemptions(ctx context.Context, promotionID string, skip, take int) ([]Redemption, int64, error)
+	// Redeem records the redemptions in one transaction. Each promotion is locked while its
+	// limits are checked again, so concurrent orders cannot use a code beyond them.
+	Redeem(ctx context.Context, redemptions []Redemption) error
+	// Release deletes the redemptions of an order and gives their uses back. Only the call that
+	// deletes a redemption gives its use back, so concurrent releases of one order free it once.
+	Release(ctx context.Context, orderID string) error
+}
+
+type promotionRepository struct {
+	db *gorm.DB
+}
+
+func NewPromotionRepository(db *gorm.DB) PromotionRepository {
+	return &promotionRepository{db: db}
+}
+
+func (r *promotionRepository) Create(ctx context.Context, promotion *Promotion) error {
+	return r.db.WithContext(ctx).Create(promotion).Error
+}
+
+// Update leaves UsedCount alone; it only changes through redemptions
+func (r *promotionRepository) Update(ctx context.Context, promotion *Promotion) error {
+	return r.db.WithContext(ctx).Model(&Promotion{}).Where("id = ?", promotion.ID).
+		Updates(map[string]interface{}{
+			"code":              promotion.Code,
+			"description":       promotion.Description,
+			"kind":              promotion.Kind,
+			"percent_off":       promotion.PercentOff,
+			"amount_off":        promotion.AmountOff,
+			"buy_quantity":      promotion.BuyQuantity,
+			"get_quantity":      promotion.GetQuantity,
+			"product_ids":       promotion.ProductIDs,
+			"min_subtotal":      promotion.MinSubtotal,
+			"max_uses":          promotion.MaxUses,
+			"max_uses_per_user": promotion.MaxUsesPerUser,
+			"starts_at":         promotion.StartsAt,
+			"ends_at":           promotion.EndsAt,
+			"is_active":         promotion.IsActive,
+		}).Error
+}
+
+func (r *promotionRepository) Delete(ctx context.Context, id string) error {
+	res := r.db.WithContext(ctx).Where("id = ?", id).Delete(&Promotion{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrPromotionNotFound
+	}
+	return nil
+}
+
+func (r *promotionRepository) GetByID(ctx context.Context, id string) (*Promotion, error) {
+	var promotion Promotion
+	err := r.db.WithContext(ctx).First(&promotion, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPromotionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+func (r *promotionRepository) GetByCode(ctx context.Context, code string) (*Promotion, error) {
+	var promotion Promotion
+	err := r.db.WithContext(ctx).First(&promotion, "code = ?", code).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPromotionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+func (r *promotionRepository) List(ctx context.Context, skip, take int) ([]Promotion, int64, error) {
+	var list []Promotion
+	var count int64
+	q := r.db.WithContext(ctx).Model(&Promotion{})
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := q.Order("created_at DESC, id").Offset(skip).Limit(take).Find(&list).Error; err != nil {
+		return nil, 0, err
+	}
+	return list, count, nil
+}
+
+func (r *promotionRepository) CountRedemptions(ctx context.Context, promotionID, userID string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&Redemption{}).Where("promotion_id = ? AND user_id = ?", promotionID, userID).Count(&count).Error
+	return count, err
+}
+
+func (r *promotionRepository) ListRedemptions(ctx context.Context, promotionID string, skip, take int) ([]Redemption, int64, error) {
+	var list []Redemption
+	var count int64
+	q := r.db.WithContext(ctx).Model(&Redemption{}).Where("promotion_id = ?", promotionID)
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := q.Order("created_at DESC, id DESC").Offset(skip).Limit(take).Find(&list).Error; err != nil {
+		return nil, 0, err
+	}
+	return list, count, nil
+}
+
+func (r *promotionRepository) Redeem(ctx context.Context, redemptions []Redemption) error {
+	if len(redemptions) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range redemptions {
+			redemption := &redemptions[i]
+			var promotion Promotion
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&promotion, "id = ?", redemption.PromotionID).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &CodeError{Code: redemption.Code, Err: ErrUnknownCode}
+			}
+			if err != nil {
+				return err
+			}
+			if promotion.MaxUses > 0 && promotion.UsedCount >= promotion.MaxUses {
+				return &CodeError{Code: redemption.Code, Err: ErrUsageLimit}
+			}
+			if promotion.MaxUsesPerUser > 0 {
+				var used int64
+				if err := tx.Model(&Redemption{}).Where("promotion_id = ? AND user_id = ?", promotion.ID, redemption.UserID).Count(&used).Error; err != nil {
+					return err
+				}
+				if used >= int64(promotion.MaxUsesPerUser) {
+					return &CodeError{Code: redemption.Code, Err: ErrUserLimit}
+				}
+			}
+			if err := tx.Create(redemption).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&Promotion{}).Where("id = ?", promotion.ID).Update("used_count", gorm.Expr("used_count + 1")).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *promotionRepository) Release(ctx context.Context, orderID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var redemptions []Redemption
+		if err := tx.Clauses(clause.Returning{}).Where("order_id = ?", orderID).Delete(&redemptions).Error; err != nil {
+			return err
+		}
+		for _, redemption := range redemptions {
+			if err := tx.Model(&Promotion{}).Where("id = ? AND used_count > 0", redemption.PromotionID).Update("used_count", gorm.Expr("used_count - 1")).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,186 @@
+package promotions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type PromotionService interface {
+	CreatePromotion(ctx context.Context, promotion *Promotion) (*Promotion, error)
+	UpdatePromotion(ctx context.Context, promotion *Promotion) (*Promotion, error)
+	DeletePromotion(ctx context.Context, id string) error
+	GetPromotion(ctx context.Context, id string) (*Promotion, error)
+	ListPromotions(ctx context.Context, skip, take int) ([]Promotion, int64, error)
+	ListRedemptions(ctx context.Context, id string, skip, take int) ([]Redemption, int64, error)
+	// Quote applies the codes in order to the lines for userID ("" for a guest) without using them up
+	Quote(ctx context.Context, userID string, codes []string, lines []Line) (*Quote, error)
+	// Release gives back the uses of an order whose sale ended
+	Release(ctx context.Context, orderID string) error
+}
+
+type promotionService struct {
+	repo PromotionRepository
+}
+
+func NewPromotionService(repo PromotionRepository) PromotionService {
+	return &promotionService{repo: repo}
+}
+
+func (s *promotionService) CreatePromotion(ctx context.Context, promotion *Promotion) (*Promotion, error) {
+	if err := s.prepare(ctx, promotion); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, promotion); err != nil {
+		return nil, err
+	}
+	return promotion, nil
+}
+
+func (s *promotionService) UpdatePromotion(ctx context.Context, promotion *Promotion) (*Promotion, error) {
+	if _, err := s.repo.GetByID(ctx, promotion.ID); err != nil {
+		return nil, err
+	}
+	if err := s.prepare(ctx, promotion); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, promotion); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, promotion.ID)
+}
+
+// prepare normalizes the code and checks the fields the kind needs
+func (s *promotionService) prepare(ctx context.Context, promotion *Promotion) error {
+	promotion.Code = NormalizeCode(promotion.Code)
+	if promotion.Code == "" || strings.ContainsAny(promotion.Code, " \t\n") {
+		return fmt.Errorf("%w: code must be a single word", ErrInvalidPromotion)
+	}
+	switch promotion.Kind {
+	case KindPercent:
+		if promotion.PercentOff < 1 || promotion.PercentOff > 100 {
+			return fmt.Errorf("%w: percent_off must be between 1 and 100", ErrInvalidPromotion)
+		}
+	case KindFixed:
+		if promotion.AmountOff <= 0 {
+			return fmt.Errorf("%w: amount_off must be positive", ErrInvalidPromotion)
+		}
+	case KindBuyXGetY:
+		if promotion.BuyQuantity <= 0 || promotion.GetQuantity <= 0 {
+			return fmt.Errorf("%w: buy_quantity and get_quantity must be positive", ErrInvalidPromotion)
+		}
+	case KindFreeShipping:
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidPromotion, promotion.Kind)
+	}
+	if promotion.StartsAt != nil && promotion.EndsAt != nil && !promotion.EndsAt.After(*promotion.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidPromotion)
+	}
+	existing, err := s.repo.GetByCode(ctx, promotion.Code)
+	if err == nil && existing.ID != promotion.ID {
+		return ErrCodeTaken
+	}
+	if err != nil && !errors.Is(err, ErrPromotionNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *promotionService) DeletePromotion(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *promotionService) GetPromotion(ctx context.Context, id string) (*Promotion, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *promotionService) ListPromotions(ctx context.Context, skip, take int) ([]Promotion, int64, error) {
+	return s.repo.List(ctx, skip, take)
+}
+
+func (s *promotionService) ListRedemptions(ctx context.Context, id string, skip, take int) ([]Redemption, int64, error) {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.ListRedemptions(ctx, id, skip, take)
+}
+
+// Quote stacks the codes: each applies to what the codes before it left to pay
+func (s *promotionService) Quote(ctx context.Context, userID string, codes []string, lines []Line) (*Quote, error) {
+	quote := &Quote{LineDiscounts: make([]int, len(lines)), Promotions: []AppliedPromotion{}}
+	left := make([]int, len(lines))
+	for i, l := range lines {
+		left[i] = l.UnitPrice * l.Quantity
+		quote.Subtotal += left[i]
+	}
+	now := time.Now()
+	seen := make(map[string]bool, len(codes))
+	for _, raw := range codes {
+		code := NormalizeCode(raw)
+		if code == "" {
+			continue
+		}
+		if seen[code] {
+			return nil, &CodeError{Code: code, Err: ErrDuplicateCode}
+		}
+		seen[code] = true
+		promotion, err := s.usable(ctx, code, userID, quote.Subtotal, now)
+		if err != nil {
+			return nil, err
+		}
+		if len(promotion.eligible(lines)) == 0 {
+			return nil, &CodeError{Code: code, Err: ErrNotApplicable}
+		}
+		applied := promotion.apply(lines, left)
+		if applied.Amount == 0 && !applied.FreeShipping {
+			return nil, &CodeError{Code: code, Err: ErrNotApplicable}
+		}
+		for _, d := range applied.Lines {
+			quote.LineDiscounts[d.Line] += d.Amount
+		}
+		quote.Discount += applied.Amount
+		quote.FreeShipping = quote.FreeShipping || applied.FreeShipping
+		quote.Promotions = append(quote.Promotions, applied)
+	}
+	quote.Total = quote.Subtotal - quote.Discount
+	return quote, nil
+}
+
+// usable loads the promotion behind code and checks userID may use it on a basket of subtotal at now
+func (s *promotionService) usable(ctx context.Context, code, userID string, subtotal int, now time.Time) (*Promotion, error) {
+	promotion, err := s.repo.GetByCode(ctx, code)
+	if errors.Is(err, ErrPromotionNotFound) {
+		return nil, &CodeError{Code: code, Err: ErrUnknownCode}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !promotion.ValidAt(now) {
+		return nil, &CodeError{Code: code, Err: ErrCodeNotActive}
+	}
+	if subtotal < promotion.MinSubtotal {
+		return nil, &CodeError{Code: code, Err: ErrMinimumNotMet}
+	}
+	if promotion.MaxUses > 0 && promotion.UsedCount >= promotion.MaxUses {
+		return nil, &CodeError{Code: code, Err: ErrUsageLimit}
+	}
+	if promotion.MaxUsesPerUser > 0 {
+		if userID == "" {
+			return nil, &CodeError{Code: code, Err: ErrSignInRequired}
+		}
+		used, err := s.repo.CountRedemptions(ctx, promotion.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if used >= int64(promotion.MaxUsesPerUser) {
+			return nil, &CodeError{Code: code, Err: ErrUserLimit}
+		}
+	}
+	return promotion, nil
+}
+
+func (s *promotionService) Release(ctx context.Context, orderID string) error {
+	return s.repo.Release(ctx, orderID)
+}
@@ -0,0 +1,243 @@
+package shipping
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"ecommerce-backend/common/middleware"
+	"ecommerce-backend/core/products"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type ShippingController struct {
+	service   ShippingService
+	validator *validator.Validate
+}
+
+func NewShippingController(s ShippingService) *ShippingController {
+	return &ShippingController{
+		service:   s,
+		validator: validator.New(),
+	}
+}
+
+type ZoneRequest struct {
+	Name     string   `json:"name" validate:"required,max=128"`
+	Regions  []Region `json:"regions" validate:"required,min=1"`
+	Position int      `json:"position"`
+}
+
+type MethodRequest struct {
+	Name              string `json:"name" validate:"required,max=128"`
+	Description       string `json:"description"`
+	Kind              string `json:"kind" validate:"required,oneof=flat weight price"`
+	Rate              int    `json:"rate" validate:"gte=0"`
+	Tiers             []Tier `json:"tiers"`
+	VolumetricDivisor int    `json:"volumetric_divisor" validate:"gte=0"`
+	IsActive          bool   `json:"is_active"`
+	Position          int    `json:"position"`
+}
+
+type quoteItem struct {
+	ProductID string `json:"product_id" validate:"required"`
+	VariantID string `json:"variant_id"`
+	Quantity  int    `json:"quantity" validate:"gt=0"`
+}
+
+type quoteAddress struct {
+	Country    string `json:"country" validate:"required"`
+	State      string `json:"state"`
+	PostalCode string `json:"postal_code"`
+}
+
+type quoteRequest struct {
+	Items   []quoteItem  `json:"items" validate:"required,min=1,dive"`
+	Address quoteAddress `json:"address"`
+}
+
+func (c *ShippingController) RegisterRoutes(r *gin.Engine) {
+	r.POST("/shipping/quote", c.Quote)
+
+	group := r.Group("/shipping/zones")
+	group.Use(middleware.AdminKeyMiddleware())
+	group.GET("", c.ListZones)
+	group.GET(":id", c.GetZone)
+	group.POST("", c.CreateZone)
+	group.PUT(":id", c.UpdateZone)
+	group.DELETE(":id", c.DeleteZone)
+	group.POST(":id/methods", c.CreateMethod)
+	group.PUT(":id/methods/:method_id", c.UpdateMethod)
+	group.DELETE(":id/methods/:method_id", c.DeleteMethod)
+}
+
+// Quote lists the shipping methods for cart lines and an address, with their costs at catalogue
+// prices. Coupon codes can lower price-tiered costs; /orders/preview gives the exact cost.
+func (c *ShippingController) Quote(ctx *gin.Context) {
+	var req quoteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lines := make([]Line, len(req.Items))
+	for i, it := range req.Items {
+		lines[i] = Line{ProductID: it.ProductID, VariantID: it.VariantID, Quantity: it.Quantity}
+	}
+	addr := Address{Country: req.Address.Country, State: req.Address.State, PostalCode: req.Address.PostalCode}
+	quote, err := c.service.QuoteAtCatalogue(context.Background(), addr, lines)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, quote)
+}
+
+func (c *ShippingController) ListZones(ctx *gin.Context) {
+	list, err := c.service.ListZones(context.Background())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, list)
+}
+
+func (c *ShippingController) GetZone(ctx *gin.Context) {
+	zone, err := c.service.GetZone(context.Background(), ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, zone)
+}
+
+func (c *ShippingController) CreateZone(ctx *gin.Context) {
+	var req ZoneRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	zone, err := c.service.CreateZone(context.Background(), req.toZone(""))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, zone)
+}
+
+func (c *ShippingController) UpdateZone(ctx *gin.Context) {
+	var req ZoneRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	zone, err := c.service.UpdateZone(context.Background(), req.toZone(ctx.Param("id")))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, zone)
+}
+
+// DeleteZone removes the zone with its methods; orders already placed keep the method and cost they were charged
+func (c *ShippingController) DeleteZone(ctx *gin.Context) {
+	if err := c.service.DeleteZone(context.Background(), ctx.Param("id")); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deleted": true})
+}
+
+func (c *ShippingController) CreateMethod(ctx *gin.Context) {
+	var req MethodRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	method, err := c.service.CreateMethod(context.Background(), req.toMethod(ctx.Param("id"), ""))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, method)
+}
+
+func (c *ShippingController) UpdateMethod(ctx *gin.Context) {
+	var req MethodRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	method, err := c.service.UpdateMethod(context.Background(), req.toMethod(ctx.Param("id"), ctx.Param("method_id")))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, method)
+}
+
+func (c *ShippingController) DeleteMethod(ctx *gin.Context) {
+	if err := c.service.DeleteMethod(context.Background(), ctx.Param("id"), ctx.Param("method_id")); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deleted": true})
+}
+
+func (c *ShippingController) Name() string {
+	return "shipping"
+}
+
+func (r ZoneRequest) toZone(id string) *Zone {
+	zone := &Zone{ID: id, Name: r.Name, Position: r.Position}
+	zone.SetRegions(r.Regions)
+	return zone
+}
+
+func (r MethodRequest) toMethod(zoneID, id string) *Method {
+	method := &Method{
+		ID:                id,
+		ZoneID:            zoneID,
+		Name:              r.Name,
+		Description:       r.Description,
+		Kind:              r.Kind,
+		Rate:              r.Rate,
+		VolumetricDivisor: r.VolumetricDivisor,
+		IsActive:          r.IsActive,
+		Position:          r.Position,
+	}
+	method.SetTiers(r.Tiers)
+	return method
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrZoneNotFound), errors.Is(err, ErrMethodNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidZone), errors.Is(err, ErrInvalidMethod),
+		errors.Is(err, ErrNoZone), errors.Is(err, products.ErrProductNotFound):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,100 @@
+package shipping
+
+import "strings"
+
+// parcelItem is a line to ship as sized by the catalogue
+type parcelItem struct {
+	Quantity    int
+	WeightGrams int
+	VolumeMM3   int
+}
+
+// specificity reports whether the zone covers addr and how narrowly, by its best region: a longer
+// postal prefix beats a shorter one, any postal prefix beats a state, a state beats the whole
+// country and a country beats AnyCountry
+func (z *Zone) specificity(addr Address) (int, bool) {
+	best, found := 0, false
+	for _, r := range z.RegionList() {
+		r.normalize()
+		score := 0
+		switch {
+		case r.Country == AnyCountry:
+		case r.Country != addr.Country:
+			continue
+		default:
+			score = 1
+		}
+		if r.State != "" {
+			if r.State != addr.State {
+				continue
+			}
+			score++
+		}
+		if r.PostalCode != "" {
+			if !strings.HasPrefix(addr.PostalCode, r.PostalCode) {
+				continue
+			}
+			score += len(r.PostalCode) * 2
+		}
+		if !found || score > best {
+			best, found = score, true
+		}
+	}
+	return best, found
+}
+
+// matchZone returns the zone addr belongs to, nil if none covers it. zones are in Position order.
+func matchZone(zones []Zone, addr Address) *Zone {
+	var matched *Zone
+	best := 0
+	for i := range zones {
+		score, ok := zones[i].specificity(addr)
+		if ok && (matched == nil || score > best) {
+			matched, best = &zones[i], score
+		}
+	}
+	return matched
+}
+
+// cost is what the method charges for the items, whose amounts add up to subtotal;
+// false when the parcel or order is beyond its last tier
+func (m *Method) cost(items []parcelItem, subtotal int) (int, bool) {
+	switch m.Kind {
+	case KindFlat:
+		return m.Rate, true
+	case KindWeight:
+		return tierCost(m.TierList(), chargeableWeight(items, m.VolumetricDivisor))
+	case KindPrice:
+		return tierCost(m.TierList(), subtotal)
+	default:
+		return 0, false
+	}
+}
+
+func tierCost(tiers []Tier, value int) (int, bool) {
+	for _, t := range tiers {
+		if t.UpTo == 0 || value <= t.UpTo {
+			return t.Cost, true
+		}
+	}
+	return 0, false
+}
+
+// chargeableWeight adds up the units, each weighing at least its volume over divisor when set
+func chargeableWeight(items []parcelItem, divisor int) int {
+	total := 0
+	for _, it := range items {
+		weight := it.WeightGrams
+		if divisor > 0 {
+			weight = max(weight, (it.VolumeMM3+divisor-1)/divisor)
+		}
+		total += weight * it.Quantity
+	}
+	return total
+}
+
+// normalize stores regions the way addresses are compared
+func (r *Region) normalize() {
+	addr := Address{Country: r.Country, State: r.State, PostalCode: r.PostalCode}.normalize()
+	r.Country, r.State, r.PostalCode = addr.Country, addr.State, addr.PostalCode
+}
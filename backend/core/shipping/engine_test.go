@@ -0,0 +1,109 @@
+package shipping
+
+import "testing"
+
+func testZone(id string, position int, regions ...Region) Zone {
+	zone := Zone{ID: id, Name: id, Position: position}
+	zone.SetRegions(regions)
+	return zone
+}
+
+func TestMatchZone(t *testing.T) {
+	zones := []Zone{
+		testZone("world", 0, Region{Country: AnyCountry}),
+		testZone("india", 1, Region{Country: "IN"}),
+		testZone("karnataka", 2, Region{Country: "IN", State: "KA"}),
+		testZone("bengaluru", 3, Region{Country: "IN", PostalCode: "560"}),
+		testZone("bengaluru-central", 4, Region{Country: "IN", PostalCode: "5600"}),
+		testZone("europe", 5, Region{Country: "DE"}, Region{Country: "FR"}),
+		testZone("germany", 6, Region{Country: "DE"}),
+	}
+	tests := []struct {
+		name string
+		addr Address
+		want string // zone ID, "" for none
+	}{
+		{"longest postal prefix wins", Address{Country: "IN", State: "KA", PostalCode: "560001"}, "bengaluru-central"},
+		{"any postal prefix beats a state", Address{Country: "IN", State: "KA", PostalCode: "560100"}, "bengaluru"},
+		{"a state beats the country", Address{Country: "IN", State: "KA", PostalCode: "570001"}, "karnataka"},
+		{"the country beats any country", Address{Country: "IN", State: "MH", PostalCode: "400001"}, "india"},
+		{"any country catches the rest", Address{Country: "BR"}, "world"},
+		{"addresses are normalized", Address{Country: " in ", State: "ka", PostalCode: "560 001"}, "bengaluru-central"},
+		{"the first zone by position wins a tie", Address{Country: "DE"}, "europe"},
+		{"a zone matches by any of its regions", Address{Country: "FR"}, "europe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if zone := matchZone(zones, tt.addr.normalize()); zone != nil {
+				got = zone.ID
+			}
+			if got != tt.want {
+				t.Errorf("matchZone = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if zone := matchZone(zones[1:3], Address{Country: "US"}); zone != nil {
+		t.Errorf("matchZone outside every zone = %q, want none", zone.ID)
+	}
+}
+
+func testMethod(kind string, rate, divisor int, tiers ...Tier) Method {
+	method := Method{Kind: kind, Rate: rate, VolumetricDivisor: divisor}
+	method.SetTiers(tiers)
+	return method
+}
+
+func TestMethodCost(t *testing.T) {
+	byWeight := []Tier{{UpTo: 500, Cost: 50}, {UpTo: 2000, Cost: 100}, {UpTo: 5000, Cost: 250}}
+	byPrice := []Tier{{UpTo: 1000, Cost: 99}, {UpTo: 5000, Cost: 49}, {UpTo: 0, Cost: 0}}
+	light := []parcelItem{{Quantity: 2, WeightGrams: 200}}
+	bulky := []parcelItem{{Quantity: 1, WeightGrams: 500, VolumeMM3: 400 * 300 * 200}} // 4800g at 5000
+	tests := []struct {
+		name     string
+		method   Method
+		items    []parcelItem
+		subtotal int
+		want     int
+		wantOK   bool
+	}{
+		{"flat rate", testMethod(KindFlat, 75, 0), light, 0, 75, true},
+		{"weight in the first tier", testMethod(KindWeight, 0, 0, byWeight...), light, 0, 50, true},
+		{"weight on a tier's upper bound", testMethod(KindWeight, 0, 0, byWeight...), []parcelItem{{Quantity: 4, WeightGrams: 500}}, 0, 100, true},
+		{"weight beyond the last tier", testMethod(KindWeight, 0, 0, byWeight...), []parcelItem{{Quantity: 11, WeightGrams: 500}}, 0, 0, false},
+		{"actual weight without a divisor", testMethod(KindWeight, 0, 0, byWeight...), bulky, 0, 50, true},
+		{"volumetric weight of a bulky parcel", testMethod(KindWeight, 0, 5000, byWeight...), bulky, 0, 250, true},
+		{"price in the first tier", testMethod(KindPrice, 0, 0, byPrice...), light, 800, 99, true},
+		{"price in a middle tier", testMethod(KindPrice, 0, 0, byPrice...), light, 1001, 49, true},
+		{"price in an open last tier", testMethod(KindPrice, 0, 0, byPrice...), light, 100000, 0, true},
+		{"unknown kind", testMethod("pigeon", 10, 0), light, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.method.cost(tt.items, tt.subtotal)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("cost = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestChargeableWeight(t *testing.T) {
+	items := []parcelItem{
+		{Quantity: 2, WeightGrams: 300, VolumeMM3: 100 * 100 * 100}, // 200g by volume at 5000
+		{Quantity: 1, WeightGrams: 100, VolumeMM3: 5001},
+	}
+	if got := chargeableWeight(items, 0); got != 700 {
+		t.Errorf("chargeableWeight without divisor = %d, want 700", got)
+	}
+	if got := chargeableWeight(items, 5000); got != 700 {
+		t.Errorf("chargeableWeight of dense items = %d, want their actual 700", got)
+	}
+	if got := chargeableWeight(items, 1000); got != 2*1000+100 {
+		t.Errorf("chargeableWeight at 1000 = %d, want %d", got, 2*1000+100)
+	}
+	if got := chargeableWeight([]parcelItem{{Quantity: 1, VolumeMM3: 5001}}, 5000); got != 2 {
+		t.Errorf("chargeableWeight rounds volume up: got %d, want 2", got)
+	}
+}
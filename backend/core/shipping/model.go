@@ -0,0 +1,186 @@
+package shipping
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrZoneNotFound   = errors.New("shipping zone not found")
+	ErrMethodNotFound = errors.New("shipping method not found")
+	ErrInvalidZone    = errors.New("invalid shipping zone")
+	ErrInvalidMethod  = errors.New("invalid shipping method")
+)
+
+// Reasons an order cannot be shipped as asked
+var (
+	ErrNoZone            = errors.New("we do not ship to this address")
+	ErrMethodRequired    = errors.New("choose a shipping method")
+	ErrMethodUnavailable = errors.New("shipping method is not available for this order")
+)
+
+// Kinds of shipping rate
+const (
+	KindFlat   = "flat"   // Rate per order
+	KindWeight = "weight" // the first of Tiers the parcel's chargeable weight in grams fits under
+	KindPrice  = "price"  // the first of Tiers the order subtotal fits under
+)
+
+// AnyCountry in a region's Country matches every address, for a rest-of-the-world zone
+const AnyCountry = "*"
+
+// Zone is an area shipped to with its own methods. An address belongs to the zone with the most
+// specific region covering it; zones as specific as each other go by Position.
+type Zone struct {
+	ID        string         `gorm:"primaryKey" json:"id"`
+	Name      string         `gorm:"not null" json:"name"`
+	Regions   datatypes.JSON `json:"regions"`
+	Position  int            `gorm:"not null;default:0" json:"position"`
+	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	Methods   []Method       `gorm:"foreignKey:ZoneID" json:"methods"`
+}
+
+func (Zone) TableName() string {
+	return "shipping_zones"
+}
+
+func (z *Zone) BeforeCreate(tx *gorm.DB) (err error) {
+	if z.ID == "" {
+		z.ID = uuid.New().String()
+	}
+	return
+}
+
+// Region is a country, optionally narrowed to a state and to postal codes starting with PostalCode
+type Region struct {
+	Country    string `json:"country"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+}
+
+func (z *Zone) RegionList() []Region {
+	var regions []Region
+	_ = json.Unmarshal(z.Regions, &regions)
+	return regions
+}
+
+func (z *Zone) SetRegions(regions []Region) {
+	b, _ := json.Marshal(regions)
+	z.Regions = b
+}
+
+// Method is a way of shipping to a zone and what it costs
+type Method struct {
+	ID          string         `gorm:"primaryKey" json:"id"`
+	ZoneID      string         `gorm:"index;not null" json:"zone_id"`
+	Name        string         `gorm:"not null" json:"name"`
+	Description string         `json:"description"`
+	Kind        string         `gorm:"not null" json:"kind"`
+	Rate        int            `gorm:"not null;default:0" json:"rate"` // KindFlat only
+	Tiers       datatypes.JSON `json:"tiers"`                          // KindWeight and KindPrice
+	// VolumetricDivisor charges bulky parcels by size: a unit weighs at least its volume in mm³ over
+	// this many grams, e.g. 5000. 0 charges by actual weight only.
+	VolumetricDivisor int       `gorm:"not null;default:0" json:"volumetric_divisor"`
+	IsActive          bool      `gorm:"not null" json:"is_active"`
+	Position          int       `gorm:"not null;default:0" json:"position"`
+	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (Method) TableName() string {
+	return "shipping_methods"
+}
+
+func (m *Method) BeforeCreate(tx *gorm.DB) (err error) {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	return
+}
+
+// Tier costs Cost for parcels or orders up to UpTo, inclusive. Tiers go in increasing UpTo;
+// the last may have UpTo 0 for no upper limit.
+type Tier struct {
+	UpTo int `json:"up_to"`
+	Cost int `json:"cost"`
+}
+
+func (m *Method) TierList() []Tier {
+	var tiers []Tier
+	_ = json.Unmarshal(m.Tiers, &tiers)
+	return tiers
+}
+
+func (m *Method) SetTiers(tiers []Tier) {
+	if len(tiers) == 0 {
+		m.Tiers = nil
+		return
+	}
+	b, _ := json.Marshal(tiers)
+	m.Tiers = b
+}
+
+// Address is where an order ships to, as far as zones are concerned
+type Address struct {
+	Country    string
+	State      string
+	PostalCode string
+}
+
+// normalize compares addresses the way regions are stored: upper case, postal codes without spaces
+func (a Address) normalize() Address {
+	return Address{
+		Country:    strings.ToUpper(strings.TrimSpace(a.Country)),
+		State:      strings.ToUpper(strings.TrimSpace(a.State)),
+		PostalCode: strings.ToUpper(strings.ReplaceAll(a.PostalCode, " ", "")),
+	}
+}
+
+// Line is a cart or order line to ship. Amount is what the line is charged, discounts taken
+// off; price-tiered methods go by the lines' amounts.
+type Line struct {
+	ProductID string
+	VariantID string
+	Quantity  int
+	Amount    int
+}
+
+// Option is one method an order can ship by, with its cost
+type Option struct {
+	MethodID    string `json:"method_id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Kind        string `json:"kind"`
+	Cost        int    `json:"cost"`
+}
+
+// Quote is what shipping lines to an address can cost. Orders of digital products only do not
+// need shipping and have no options.
+type Quote struct {
+	RequiresShipping bool     `json:"requires_shipping"`
+	ZoneID           string   `json:"zone_id,omitempty"`
+	Zone             string   `json:"zone,omitempty"`
+	Weight           int      `json:"weight_grams"` // actual weight of the parcel
+	Subtotal         int      `json:"subtotal"`     // amount charged for the lines shipped
+	Options          []Option `json:"options"`
+}
+
+// Option returns the option for methodID
+func (q *Quote) Option(methodID string) (Option, error) {
+	if methodID == "" {
+		return Option{}, ErrMethodRequired
+	}
+	for _, option := range q.Options {
+		if option.MethodID == methodID {
+			return option, nil
+		}
+	}
+	return Option{}, ErrMethodUnavailable
+}
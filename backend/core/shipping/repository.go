@@ -0,0 +1,121 @@
+package shipping
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type ShippingRepository interface {
+	CreateZone(ctx context.Context, zone *Zone) error
+	UpdateZone(ctx context.Context, zone *Zone) error
+	// DeleteZone removes the zone and its methods
+	DeleteZone(ctx context.Context, id string) error
+	GetZone(ctx context.Context, id string) (*Zone, error)
+	// ListZones returns every zone with its methods, in Position order
+	ListZones(ctx context.Context) ([]Zone, error)
+	CreateMethod(ctx context.Context, method *Method) error
+	UpdateMethod(ctx context.Context, method *Method) error
+	DeleteMethod(ctx context.Context, zoneID, id string) error
+}
+
+type shippingRepository struct {
+	db *gorm.DB
+}
+
+func NewShippingRepository(db *gorm.DB) ShippingRepository {
+	return &shippingRepository{db: db}
+}
+
+// withMethods loads zone methods in Position order
+func withMethods(db *gorm.DB) *gorm.DB {
+	return db.Order("position, name, id")
+}
+
+func (r *shippingRepository) CreateZone(ctx context.Context, zone *Zone) error {
+	return r.db.WithContext(ctx).Omit("Methods").Create(zone).Error
+}
+
+func (r *shippingRepository) UpdateZone(ctx context.Context, zone *Zone) error {
+	res := r.db.WithContext(ctx).Model(&Zone{}).Where("id = ?", zone.ID).
+		Updates(map[string]interface{}{
+			"name":     zone.Name,
+			"regions":  zone.Regions,
+			"position": zone.Position,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrZoneNotFound
+	}
+	return nil
+}
+
+func (r *shippingRepository) DeleteZone(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ?", id).Delete(&Zone{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrZoneNotFound
+		}
+		return tx.Where("zone_id = ?", id).Delete(&Method{}).Error
+	})
+}
+
+func (r *shippingRepository) GetZone(ctx context.Context, id string) (*Zone, error) {
+	var zone Zone
+	err := r.db.WithContext(ctx).Preload("Methods", withMethods).First(&zone, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrZoneNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+func (r *shippingRepository) ListZones(ctx context.Context) ([]Zone, error) {
+	var list []Zone
+	err := r.db.WithContext(ctx).Preload("Methods", withMethods).Order("position, name, id").Find(&list).Error
+	return list, err
+}
+
+func (r *shippingRepository) CreateMethod(ctx context.Context, method *Method) error {
+	return r.db.WithContext(ctx).Create(method).Error
+}
+
+func (r *shippingRepository) UpdateMethod(ctx context.Context, method *Method) error {
+	res := r.db.WithContext(ctx).Model(&Method{}).Where("id = ? AND zone_id = ?", method.ID, method.ZoneID).
+		Updates(map[string]interface{}{
+			"name":               method.Name,
+			"description":        method.Description,
+			"kind":               method.Kind,
+			"rate":               method.Rate,
+			"tiers":              method.Tiers,
+			"volumetric_divisor": method.VolumetricDivisor,
+			"is_active":          method.IsActive,
+			"position":           method.Position,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrMethodNotFound
+	}
+	return nil
+}
+
+func (r *shippingRepository) DeleteMethod(ctx context.Context, zoneID, id string) error {
+	res := r.db.WithContext(ctx).Where("id = ? AND zone_id = ?", id, zoneID).Delete(&Method{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrMethodNotFound
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package shipping
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"ecommerce-backend/core/products"
+)
+
+type ShippingService interface {
+	CreateZone(ctx context.Context, zone *Zone) (*Zone, error)
+	UpdateZone(ctx context.Context, zone *Zone) (*Zone, error)
+	DeleteZone(ctx context.Context, id string) error
+	GetZone(ctx context.Context, id string) (*Zone, error)
+	ListZones(ctx context.Context) ([]Zone, error)
+	CreateMethod(ctx context.Context, method *Method) (*Method, error)
+	UpdateMethod(ctx context.Context, method *Method) (*Method, error)
+	DeleteMethod(ctx context.Context, zoneID, id string) error
+	// Quote lists the methods the lines can ship to addr by, going by the amounts they are charged
+	Quote(ctx context.Context, addr Address, lines []Line) (*Quote, error)
+	// QuoteAtCatalogue quotes lines charged their catalogue price now, before any coupon code
+	QuoteAtCatalogue(ctx context.Context, addr Address, lines []Line) (*Quote, error)
+}
+
+type shippingService struct {
+	repo        ShippingRepository
+	productRepo products.ProductRepository
+}
+
+func NewShippingService(repo ShippingRepository, pr products.ProductRepository) ShippingService {
+	return &shippingService{repo: repo, productRepo: pr}
+}
+
+func (s *shippingService) CreateZone(ctx context.Context, zone *Zone) (*Zone, error) {
+	if err := prepareZone(zone); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateZone(ctx, zone); err != nil {
+		return nil, err
+	}
+	return s.repo.GetZone(ctx, zone.ID)
+}
+
+func (s *shippingService) UpdateZone(ctx context.Context, zone *Zone) (*Zone, error) {
+	if err := prepareZone(zone); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateZone(ctx, zone); err != nil {
+		return nil, err
+	}
+	return s.repo.GetZone(ctx, zone.ID)
+}
+
+// prepareZone stores the regions the way addresses are compared and checks them
+func prepareZone(zone *Zone) error {
+	zone.Name = strings.TrimSpace(zone.Name)
+	if zone.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidZone)
+	}
+	regions := zone.RegionList()
+	if len(regions) == 0 {
+		return fmt.Errorf("%w: at least one region is required", ErrInvalidZone)
+	}
+	for i := range regions {
+		regions[i].normalize()
+		if regions[i].Country != AnyCountry && len(regions[i].Country) != 2 {
+			return fmt.Errorf("%w: country must be a two-letter code or %q", ErrInvalidZone, AnyCountry)
+		}
+		if regions[i].Country == AnyCountry && (regions[i].State != "" || regions[i].PostalCode != "") {
+			return fmt.Errorf("%w: %q cannot be narrowed to a state or postal code", ErrInvalidZone, AnyCountry)
+		}
+	}
+	zone.SetRegions(regions)
+	return nil
+}
+
+func (s *shippingService) DeleteZone(ctx context.Context, id string) error {
+	return s.repo.DeleteZone(ctx, id)
+}
+
+func (s *shippingService) GetZone(ctx context.Context, id string) (*Zone, error) {
+	return s.repo.GetZone(ctx, id)
+}
+
+func (s *shippingService) ListZones(ctx context.Context) ([]Zone, error) {
+	return s.repo.ListZones(ctx)
+}
+
+func (s *shippingService) CreateMethod(ctx context.Context, method *Method) (*Method, error) {
+	if _, err := s.repo.GetZone(ctx, method.ZoneID); err != nil {
+		return nil, err
+	}
+	if err := prepareMethod(method); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateMethod(ctx, method); err != nil {
+		return nil, err
+	}
+	return method, nil
+}
+
+func (s *shippingService) UpdateMethod(ctx context.Context, method *Method) (*Method, error) {
+	if err := prepareMethod(method); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateMethod(ctx, method); err != nil {
+		return nil, err
+	}
+	zone, err := s.repo.GetZone(ctx, method.ZoneID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range zone.Methods {
+		if zone.Methods[i].ID == method.ID {
+			return &zone.Methods[i], nil
+		}
+	}
+	return nil, ErrMethodNotFound
+}
+
+// prepareMethod checks the fields the kind needs
+func prepareMethod(method *Method) error {
+	method.Name = strings.TrimSpace(method.Name)
+	if method.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidMethod)
+	}
+	if method.Rate < 0 || method.VolumetricDivisor < 0 {
+		return fmt.Errorf("%w: rate and volumetric_divisor cannot be negative", ErrInvalidMethod)
+	}
+	switch method.Kind {
+	case KindFlat:
+		method.SetTiers(nil)
+	case KindWeight, KindPrice:
+		tiers := method.TierList()
+		if len(tiers) == 0 {
+			return fmt.Errorf("%w: a %s rate needs tiers", ErrInvalidMethod, method.Kind)
+		}
+		for i, t := range tiers {
+			if t.Cost < 0 || t.UpTo < 0 {
+				return fmt.Errorf("%w: tiers cannot be negative", ErrInvalidMethod)
+			}
+			if t.UpTo == 0 && i != len(tiers)-1 {
+				return fmt.Errorf("%w: only the last tier may have no up_to", ErrInvalidMethod)
+			}
+			if i > 0 && t.UpTo != 0 && t.UpTo <= tiers[i-1].UpTo {
+				return fmt.Errorf("%w: tiers must go up in up_to", ErrInvalidMethod)
+			}
+		}
+		method.Rate = 0
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidMethod, method.Kind)
+	}
+	return nil
+}
+
+func (s *shippingService) DeleteMethod(ctx context.Context, zoneID, id string) error {
+	return s.repo.DeleteMethod(ctx, zoneID, id)
+}
+
+func (s *shippingService) Quote(ctx context.Context, addr Address, lines []Line) (*Quote, error) {
+	quote := &Quote{Options: []Option{}}
+	items, err := s.parcel(ctx, lines, quote)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return quote, nil
+	}
+	quote.RequiresShipping = true
+	zones, err := s.repo.ListZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zone := matchZone(zones, addr.normalize())
+	if zone == nil {
+		return nil, ErrNoZone
+	}
+	quote.ZoneID, quote.Zone = zone.ID, zone.Name
+	for i := range zone.Methods {
+		method := &zone.Methods[i]
+		if !method.IsActive {
+			continue
+		}
+		cost, ok := method.cost(items, quote.Subtotal)
+		if !ok {
+			continue
+		}
+		quote.Options = append(quote.Options, Option{MethodID: method.ID, Name: method.Name, Description: method.Description, Kind: method.Kind, Cost: cost})
+	}
+	return quote, nil
+}
+
+func (s *shippingService) QuoteAtCatalogue(ctx context.Context, addr Address, lines []Line) (*Quote, error) {
+	byID, err := s.products(ctx, lines)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	priced := make([]Line, len(lines))
+	for i, l := range lines {
+		p := byID[l.ProductID]
+		unit := p.PriceAt(now)
+		for _, v := range p.Variants {
+			if v.ID == l.VariantID {
+				unit = v.PriceAt(now)
+			}
+		}
+		priced[i] = l
+		priced[i].Amount = unit * l.Quantity
+	}
+	return s.Quote(ctx, addr, priced)
+}
+
+// parcel sizes the lines that need shipping from the catalogue and adds their weight and
+// amount to quote; digital products are left out
+func (s *shippingService) parcel(ctx context.Context, lines []Line, quote *Quote) ([]parcelItem, error) {
+	byID, err := s.products(ctx, lines)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]parcelItem, 0, len(lines))
+	for _, l := range lines {
+		p := byID[l.ProductID]
+		if p.Digital || l.Quantity <= 0 {
+			continue
+		}
+		items = append(items, parcelItem{Quantity: l.Quantity, WeightGrams: p.WeightGrams, VolumeMM3: p.LengthMM * p.WidthMM * p.HeightMM})
+		quote.Weight += p.WeightGrams * l.Quantity
+		quote.Subtotal += l.Amount
+	}
+	return items, nil
+}
+
+// products loads the products of the lines by ID, failing when one is missing
+func (s *shippingService) products(ctx context.Context, lines []Line) (map[string]*products.Product, error) {
+	ids := make([]string, 0, len(lines))
+	for _, l := range lines {
+		ids = append(ids, l.ProductID)
+	}
+	list, err := s.productRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*products.Product, len(list))
+	for i := range list {
+		byID[list[i].ID] = &list[i]
+	}
+	for _, l := range lines {
+		if _, ok := byID[l.ProductID]; !ok {
+			return nil, fmt.Errorf("%w: %s", products.ErrProductNotFound, l.ProductID)
+		}
+	}
+	return byID, nil
+}
@@ -0,0 +1,170 @@
+package tax
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"ecommerce-backend/common/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type TaxController struct {
+	service   TaxService
+	validator *validator.Validate
+}
+
+func NewTaxController(s TaxService) *TaxController {
+	return &TaxController{
+		service:   s,
+		validator: validator.New(),
+	}
+}
+
+type RateRequest struct {
+	Name        string `json:"name" validate:"required,max=64"`
+	Country     string `json:"country" validate:"required,len=2"`
+	State       string `json:"state" validate:"max=64"`
+	PostalCode  string `json:"postal_code" validate:"max=16"`
+	TaxClass    string `json:"tax_class" validate:"max=32"`
+	BasisPoints int    `json:"basis_points" validate:"gte=0,lte=10000"`
+}
+
+func (c *TaxController) RegisterRoutes(r *gin.Engine) {
+	group := r.Group("/tax/rates")
+	group.Use(middleware.AdminKeyMiddleware())
+	group.GET("", c.ListRates)
+	group.GET(":id", c.GetRate)
+	group.POST("", c.CreateRate)
+	group.PUT(":id", c.UpdateRate)
+	group.DELETE(":id", c.DeleteRate)
+}
+
+// ListRates lists the rate tables, of one country with ?country=
+func (c *TaxController) ListRates(ctx *gin.Context) {
+	skip, take := pagination(ctx)
+	list, total, err := c.service.ListRates(context.Background(), ctx.Query("country"), skip, take)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	ctx.JSON(http.StatusOK, list)
+}
+
+func (c *TaxController) GetRate(ctx *gin.Context) {
+	id, ok := rateID(ctx)
+	if !ok {
+		return
+	}
+	rate, err := c.service.GetRate(context.Background(), id)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, rate)
+}
+
+func (c *TaxController) CreateRate(ctx *gin.Context) {
+	var req RateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rate, err := c.service.CreateRate(context.Background(), req.toRate(0))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, rate)
+}
+
+func (c *TaxController) UpdateRate(ctx *gin.Context) {
+	id, ok := rateID(ctx)
+	if !ok {
+		return
+	}
+	var req RateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rate, err := c.service.UpdateRate(context.Background(), req.toRate(id))
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, rate)
+}
+
+// DeleteRate removes the rate; orders already placed keep the tax lines they were charged
+func (c *TaxController) DeleteRate(ctx *gin.Context) {
+	id, ok := rateID(ctx)
+	if !ok {
+		return
+	}
+	if err := c.service.DeleteRate(context.Background(), id); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"deleted": true})
+}
+
+func (c *TaxController) Name() string {
+	return "tax"
+}
+
+func (r RateRequest) toRate(id uint) *Rate {
+	return &Rate{
+		ID:          id,
+		Name:        r.Name,
+		Country:     r.Country,
+		State:       r.State,
+		PostalCode:  r.PostalCode,
+		TaxClass:    r.TaxClass,
+		BasisPoints: r.BasisPoints,
+	}
+}
+
+// rateID reads the :id parameter, answering 400 when it is not a number
+func rateID(ctx *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "rate id must be a number"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func pagination(ctx *gin.Context) (int, int) {
+	skip, _ := strconv.Atoi(ctx.DefaultQuery("skip", "0"))
+	take, _ := strconv.Atoi(ctx.DefaultQuery("take", "50"))
+	if skip < 0 {
+		skip = 0
+	}
+	if take <= 0 || take > 200 {
+		take = 50
+	}
+	return skip, take
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrRateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidRate):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,70 @@
+package tax
+
+// calculate applies the rates to the lines shipped to addr. Each line's tax is rounded to the
+// nearest unit per rate; with inclusive pricing it is the share of the amount the rates make up.
+func calculate(rates []Rate, addr Address, lines []Line, inclusive bool) *Result {
+	result := &Result{Inclusive: inclusive, LineTaxes: make([]int, len(lines)), Lines: []TaxLine{}}
+	addr = addr.normalize()
+	byRate := make(map[uint]int)
+	for i, l := range lines {
+		matched := match(rates, addr, NormalizeClass(l.TaxClass))
+		if len(matched) == 0 || l.Amount <= 0 {
+			continue
+		}
+		total := 0
+		for _, r := range matched {
+			total += r.BasisPoints
+		}
+		taxes := make([]int, len(matched))
+		for k, r := range matched {
+			if inclusive {
+				taxes[k] = roundDiv(l.Amount*r.BasisPoints, 10000+total)
+			} else {
+				taxes[k] = roundDiv(l.Amount*r.BasisPoints, 10000)
+			}
+			result.LineTaxes[i] += taxes[k]
+		}
+		taxable := l.Amount
+		if inclusive {
+			taxable -= result.LineTaxes[i]
+		}
+		for k, r := range matched {
+			at, ok := byRate[r.ID]
+			if !ok {
+				at = len(result.Lines)
+				byRate[r.ID] = at
+				result.Lines = append(result.Lines, TaxLine{RateID: r.ID, Name: r.Name, TaxClass: r.TaxClass, BasisPoints: r.BasisPoints})
+			}
+			result.Lines[at].Taxable += taxable
+			result.Lines[at].Amount += taxes[k]
+		}
+		result.Tax += result.LineTaxes[i]
+	}
+	return result
+}
+
+// match returns the most specific rates of class covering addr
+func match(rates []Rate, addr Address, class string) []Rate {
+	var matched []Rate
+	best := -1
+	for _, r := range rates {
+		if r.TaxClass != class {
+			continue
+		}
+		score, ok := r.specificity(addr)
+		if !ok || score < best {
+			continue
+		}
+		if score > best {
+			best = score
+			matched = matched[:0]
+		}
+		matched = append(matched, r)
+	}
+	return matched
+}
+
+// roundDiv divides non-negative a by b, rounding halves up
+func roundDiv(a, b int) int {
+	return (a + b/2) / b
+}
@@ -0,0 +1,152 @@
+package tax
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testRates = []Rate{
+	{ID: 1, Name: "VAT", Country: "DE", TaxClass: ClassStandard, BasisPoints: 1900},
+	{ID: 2, Name: "VAT", Country: "DE", TaxClass: "reduced", BasisPoints: 700},
+	{ID: 3, Name: "CGST", Country: "IN", TaxClass: ClassStandard, BasisPoints: 900},
+	{ID: 4, Name: "SGST", Country: "IN", TaxClass: ClassStandard, BasisPoints: 900},
+	{ID: 5, Name: "State tax", Country: "US", State: "CA", TaxClass: ClassStandard, BasisPoints: 725},
+	{ID: 6, Name: "City tax", Country: "US", State: "CA", PostalCode: "941", TaxClass: ClassStandard, BasisPoints: 863},
+	{ID: 7, Name: "Exempt zone", Country: "US", State: "CA", PostalCode: "9410", TaxClass: ClassStandard, BasisPoints: 0},
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name      string
+		addr      Address
+		lines     []Line
+		inclusive bool
+		wantLines []int // tax per line
+		wantTax   int
+	}{
+		{
+			name:      "exclusive adds the rate on top",
+			addr:      Address{Country: "DE"},
+			lines:     []Line{{TaxClass: ClassStandard, Amount: 1000}},
+			wantLines: []int{190},
+			wantTax:   190,
+		},
+		{
+			name:      "inclusive extracts the rate's share",
+			addr:      Address{Country: "DE"},
+			lines:     []Line{{TaxClass: ClassStandard, Amount: 1190}},
+			inclusive: true,
+			wantLines: []int{190},
+			wantTax:   190,
+		},
+		{
+			name:      "exclusive rounds half up",
+			addr:      Address{Country: "DE"},
+			lines:     []Line{{TaxClass: "reduced", Amount: 50}}, // 3.5
+			wantLines: []int{4},
+			wantTax:   4,
+		},
+		{
+			name:      "inclusive rounds to the nearest unit",
+			addr:      Address{Country: "DE"},
+			lines:     []Line{{TaxClass: ClassStandard, Amount: 999}}, // 159.50...
+			inclusive: true,
+			wantLines: []int{160},
+			wantTax:   160,
+		},
+		{
+			name:      "rates as specific as each other stack",
+			addr:      Address{Country: "in"},
+			lines:     []Line{{TaxClass: ClassStandard, Amount: 1000}},
+			wantLines: []int{180},
+			wantTax:   180,
+		},
+		{
+			name:      "stacked inclusive rates share the amount",
+			addr:      Address{Country: "IN"},
+			lines:     []Line{{TaxClass: ClassStandard, Amount: 1000}},
+			inclusive: true,
+			wantLines: []int{152}, // 76 + 76 of 1000 at 18%
+			wantTax:   152,
+		},
+		{
+			name:      "a postal prefix beats the state",
+			addr:      Address{Country: "US", State: "ca", PostalCode: "94 105"},
+			lines:     []Line{{TaxClass: ClassStandard, Amount: 10000}},
+			wantLines: []int{0}, // the longer 9410 prefix exempts it
+			wantTax:   0,
+		},
+		{
+			name:      "a shorter postal prefix beats the state",
+			addr:      Address{Country: "US", State: "CA", PostalCode: "94130"},
+			lines:     []Line{{TaxClass: ClassStandard, Amount: 10000}},
+			wantLines: []int{863},
+			wantTax:   863,
+		},
+		{
+			name:      "the state applies outside every postal prefix",
+			addr:      Address{Country: "US", State: "CA", PostalCode: "90001"},
+			lines:     []Line{{TaxClass: ClassStandard, Amount: 10000}},
+			wantLines: []int{725},
+			wantTax:   725,
+		},
+		{
+			name:      "addresses outside every rate are not taxed",
+			addr:      Address{Country: "US", State: "NY"},
+			lines:     []Line{{TaxClass: ClassStandard, Amount: 10000}},
+			wantLines: []int{0},
+			wantTax:   0,
+		},
+		{
+			name:      "classes without rates are not taxed and empty is standard",
+			addr:      Address{Country: "DE"},
+			lines:     []Line{{TaxClass: "exempt", Amount: 1000}, {TaxClass: "", Amount: 1000}, {TaxClass: " Reduced ", Amount: 1000}},
+			wantLines: []int{0, 190, 70},
+			wantTax:   260,
+		},
+		{
+			name:      "fully discounted lines are not taxed",
+			addr:      Address{Country: "DE"},
+			lines:     []Line{{TaxClass: ClassStandard, Amount: 0}},
+			wantLines: []int{0},
+			wantTax:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculate(testRates, tt.addr, tt.lines, tt.inclusive)
+			if !reflect.DeepEqual(got.LineTaxes, tt.wantLines) {
+				t.Errorf("LineTaxes = %v, want %v", got.LineTaxes, tt.wantLines)
+			}
+			if got.Tax != tt.wantTax {
+				t.Errorf("Tax = %d, want %d", got.Tax, tt.wantTax)
+			}
+			if got.Inclusive != tt.inclusive {
+				t.Errorf("Inclusive = %v, want %v", got.Inclusive, tt.inclusive)
+			}
+			sum := 0
+			for _, l := range got.Lines {
+				sum += l.Amount
+			}
+			if sum != got.Tax {
+				t.Errorf("tax lines add up to %d, want %d", sum, got.Tax)
+			}
+		})
+	}
+}
+
+// Tax lines add up every line a rate applied to, with the taxable amount net of tax
+func TestCalculateTaxLines(t *testing.T) {
+	lines := []Line{{TaxClass: ClassStandard, Amount: 1190}, {TaxClass: ClassStandard, Amount: 2380}}
+	got := calculate(testRates, Address{Country: "DE"}, lines, true)
+	want := []TaxLine{{RateID: 1, Name: "VAT", TaxClass: ClassStandard, BasisPoints: 1900, Taxable: 3000, Amount: 570}}
+	if !reflect.DeepEqual(got.Lines, want) {
+		t.Fatalf("Lines = %+v, want %+v", got.Lines, want)
+	}
+
+	got = calculate(testRates, Address{Country: "DE"}, lines, false)
+	want = []TaxLine{{RateID: 1, Name: "VAT", TaxClass: ClassStandard, BasisPoints: 1900, Taxable: 3570, Amount: 678}}
+	if !reflect.DeepEqual(got.Lines, want) {
+		t.Fatalf("Lines = %+v, want %+v", got.Lines, want)
+	}
+}
@@ -0,0 +1,105 @@
+package tax
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrRateNotFound = errors.New("tax rate not found")
+	ErrInvalidRate  = errors.New("invalid tax rate")
+)
+
+// ClassStandard is the tax class of rates and lines that do not name one
+const ClassStandard = "standard"
+
+// Rate is one row of the rate tables: a tax on products of TaxClass shipped to Country, narrowed
+// to a State and to postal codes starting with PostalCode when those are set. Only the most
+// specific rows matching a line apply; rows as specific as each other stack, so a line can carry
+// both a federal and a state tax. A 0 rate on a narrower row exempts that area.
+type Rate struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"not null" json:"name"`                                          // shown on the tax line, e.g. "VAT" or "CGST"
+	Country     string    `gorm:"index:idx_tax_rates_location;not null" json:"country"`          // ISO 3166-1 alpha-2, upper case
+	State       string    `gorm:"index:idx_tax_rates_location;not null;default:''" json:"state"` // empty for the whole country
+	PostalCode  string    `gorm:"not null;default:''" json:"postal_code"`                        // prefix, empty for the whole state
+	TaxClass    string    `gorm:"not null;default:'standard'" json:"tax_class"`
+	BasisPoints int       `gorm:"not null;default:0" json:"basis_points"` // hundredths of a percent: 1800 is 18%
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+func (Rate) TableName() string {
+	return "tax_rates"
+}
+
+// specificity reports whether the rate covers addr and how narrowly: a longer postal prefix
+// beats a shorter one, any postal prefix beats a state, and a state beats the whole country
+func (r *Rate) specificity(addr Address) (int, bool) {
+	if r.Country != addr.Country {
+		return 0, false
+	}
+	if r.State != "" && r.State != addr.State {
+		return 0, false
+	}
+	if r.PostalCode != "" && !strings.HasPrefix(addr.PostalCode, r.PostalCode) {
+		return 0, false
+	}
+	score := len(r.PostalCode) * 2
+	if r.State != "" {
+		score++
+	}
+	return score, true
+}
+
+// NormalizeClass makes tax classes case-insensitive; empty is ClassStandard
+func NormalizeClass(class string) string {
+	class = strings.ToLower(strings.TrimSpace(class))
+	if class == "" {
+		return ClassStandard
+	}
+	return class
+}
+
+// Address is where an order ships to, as far as tax is concerned
+type Address struct {
+	Country    string
+	State      string
+	PostalCode string
+}
+
+// normalize compares addresses the way rates are stored: upper case, postal codes without spaces
+func (a Address) normalize() Address {
+	return Address{
+		Country:    strings.ToUpper(strings.TrimSpace(a.Country)),
+		State:      strings.ToUpper(strings.TrimSpace(a.State)),
+		PostalCode: strings.ToUpper(strings.ReplaceAll(a.PostalCode, " ", "")),
+	}
+}
+
+// Line is an order line as charged, after discounts
+type Line struct {
+	ProductID string
+	TaxClass  string
+	Amount    int
+}
+
+// TaxLine is what one rate adds up to across an order
+type TaxLine struct {
+	RateID      uint   `json:"rate_id"`
+	Name        string `json:"name"`
+	TaxClass    string `json:"tax_class"`
+	BasisPoints int    `json:"basis_points"`
+	Taxable     int    `json:"taxable"` // the amount taxed, tax excluded
+	Amount      int    `json:"amount"`
+}
+
+// Result is the tax on an order. With Inclusive the line amounts already contain Tax;
+// otherwise Tax comes on top of them.
+type Result struct {
+	Inclusive bool      `json:"inclusive"`
+	Tax       int       `json:"tax"`
+	LineTaxes []int     `json:"line_taxes"` // tax per line, in line order
+	Lines     []TaxLine `json:"lines"`
+}
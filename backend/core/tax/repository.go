@@ -0,0 +1,95 @@
+package tax
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+type RateRepository interface {
+	Create(ctx context.Context, rate *Rate) error
+	Update(ctx context.Context, rate *Rate) error
+	Delete(ctx context.Context, id uint) error
+	GetByID(ctx context.Context, id uint) (*Rate, error)
+	// List pages through the rates, of one country when country is set
+	List(ctx context.Context, country string, skip, take int) ([]Rate, int64, error)
+	// ListByCountry returns every rate of the country, for calculating tax
+	ListByCountry(ctx context.Context, country string) ([]Rate, error)
+}
+
+type rateRepository struct {
+	db *gorm.DB
+}
+
+func NewRateRepository(db *gorm.DB) RateRepository {
+	return &rateRepository{db: db}
+}
+
+func (r *rateRepository) Create(ctx context.Context, rate *Rate) error {
+	return r.db.WithContext(ctx).Create(rate).Error
+}
+
+func (r *rateRepository) Update(ctx context.Context, rate *Rate) error {
+	res := r.db.WithContext(ctx).Model(&Rate{}).Where("id = ?", rate.ID).
+		Updates(map[string]interface{}{
+			"name":         rate.Name,
+			"country":      rate.Country,
+			"state":        rate.State,
+			"postal_code":  rate.PostalCode,
+			"tax_class":    rate.TaxClass,
+			"basis_points": rate.BasisPoints,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRateNotFound
+	}
+	return nil
+}
+
+func (r *rateRepository) Delete(ctx context.Context, id uint) error {
+	res := r.db.WithContext(ctx).Delete(&Rate{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRateNotFound
+	}
+	return nil
+}
+
+func (r *rateRepository) GetByID(ctx context.Context, id uint) (*Rate, error) {
+	var rate Rate
+	err := r.db.WithContext(ctx).First(&rate, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+func (r *rateRepository) List(ctx context.Context, country string, skip, take int) ([]Rate, int64, error) {
+	var list []Rate
+	var count int64
+	q := r.db.WithContext(ctx).Model(&Rate{})
+	if country != "" {
+		q = q.Where("country = ?", country)
+	}
+	if err := q.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := q.Order("country, state, postal_code, tax_class, id").Offset(skip).Limit(take).Find(&list).Error; err != nil {
+		return nil, 0, err
+	}
+	return list, count, nil
+}
+
+func (r *rateRepository) ListByCountry(ctx context.Context, country string) ([]Rate, error) {
+	var list []Rate
+	err := r.db.WithContext(ctx).Where("country = ?", country).Order("id").Find(&list).Error
+	return list, err
+}
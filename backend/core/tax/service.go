@@ -0,0 +1,90 @@
+package tax
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type TaxService interface {
+	CreateRate(ctx context.Context, rate *Rate) (*Rate, error)
+	UpdateRate(ctx context.Context, rate *Rate) (*Rate, error)
+	DeleteRate(ctx context.Context, id uint) error
+	GetRate(ctx context.Context, id uint) (*Rate, error)
+	ListRates(ctx context.Context, country string, skip, take int) ([]Rate, int64, error)
+	// Calculate works out the tax on lines shipped to addr. Without a country there is nothing
+	// to look rates up by and no tax is charged.
+	Calculate(ctx context.Context, addr Address, lines []Line) (*Result, error)
+}
+
+type taxService struct {
+	repo             RateRepository
+	pricesIncludeTax bool
+}
+
+// NewTaxService charges tax on top of prices, or takes it out of them when pricesIncludeTax
+func NewTaxService(repo RateRepository, pricesIncludeTax bool) TaxService {
+	return &taxService{repo: repo, pricesIncludeTax: pricesIncludeTax}
+}
+
+func (s *taxService) CreateRate(ctx context.Context, rate *Rate) (*Rate, error) {
+	if err := prepare(rate); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, rate); err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+func (s *taxService) UpdateRate(ctx context.Context, rate *Rate) (*Rate, error) {
+	if err := prepare(rate); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, rate); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, rate.ID)
+}
+
+// prepare stores the location the way addresses are compared and checks the rate
+func prepare(rate *Rate) error {
+	rate.Name = strings.TrimSpace(rate.Name)
+	location := Address{Country: rate.Country, State: rate.State, PostalCode: rate.PostalCode}.normalize()
+	rate.Country, rate.State, rate.PostalCode = location.Country, location.State, location.PostalCode
+	rate.TaxClass = NormalizeClass(rate.TaxClass)
+	if rate.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRate)
+	}
+	if len(rate.Country) != 2 {
+		return fmt.Errorf("%w: country must be a two-letter code", ErrInvalidRate)
+	}
+	if rate.BasisPoints < 0 || rate.BasisPoints > 10000 {
+		return fmt.Errorf("%w: basis_points must be between 0 and 10000", ErrInvalidRate)
+	}
+	return nil
+}
+
+func (s *taxService) DeleteRate(ctx context.Context, id uint) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *taxService) GetRate(ctx context.Context, id uint) (*Rate, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+func (s *taxService) ListRates(ctx context.Context, country string, skip, take int) ([]Rate, int64, error) {
+	return s.repo.List(ctx, strings.ToUpper(strings.TrimSpace(country)), skip, take)
+}
+
+func (s *taxService) Calculate(ctx context.Context, addr Address, lines []Line) (*Result, error) {
+	addr = addr.normalize()
+	if addr.Country == "" {
+		return calculate(nil, addr, lines, s.pricesIncludeTax), nil
+	}
+	rates, err := s.repo.ListByCountry(ctx, addr.Country)
+	if err != nil {
+		return nil, err
+	}
+	return calculate(rates, addr, lines, s.pricesIncludeTax), nil
+}
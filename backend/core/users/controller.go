@@ -118,6 +118,10 @@ func (c *UserController) SignIn(ctx *gin.Context) {
 		return
 	}
 
+	if req.CartToken == "" {
+		req.CartToken = ctx.GetHeader("X-Cart-Token")
+	}
+
 	ipAddress := getClientIP(ctx)
 	userAgent := ctx.GetHeader("User-Agent")
 
@@ -85,8 +85,9 @@ type SignUpRequest struct {
 }
 
 type SignInRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email     string `json:"email" binding:"required,email"`
+	Password  string `json:"password" binding:"required"`
+	CartToken string `json:"cart_token"` // guest cart to merge; the X-Cart-Token header also works
 }
 
 type AuthResponse struct {
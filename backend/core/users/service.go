@@ -40,9 +40,15 @@ type UserService interface {
 	ResetPassword(ctx context.Context, req *ResetPasswordRequest) error
 }
 
+// CartMerger moves a guest cart into the user's cart when they sign in
+type CartMerger interface {
+	MergeGuestCart(ctx context.Context, cartToken string, userID uuid.UUID) error
+}
+
 type userService struct {
 	repo       UserRepository
 	jwtManager *JWTManager
+	carts      CartMerger
 }
 
 func NewUserService(repo UserRepository) UserService {
@@ -52,6 +58,14 @@ func NewUserService(repo UserRepository) UserService {
 	}
 }
 
+func NewUserServiceWithCarts(repo UserRepository, carts CartMerger) UserService {
+	return &userService{
+		repo:       repo,
+		jwtManager: NewJWTManager(),
+		carts:      carts,
+	}
+}
+
 // Authentication methods
 
 func (s *userService) SignUp(ctx context.Context, req *SignUpRequest) (*AuthResponse, error) {
@@ -157,6 +171,13 @@ func (s *userService) SignIn(ctx context.Context, req *SignInRequest, ipAddress,
 	// Update last login
 	s.repo.UpdateLastLogin(ctx, user.ID)
 
+	// Merge the guest cart; a failure leaves it in place and must not block sign in
+	if s.carts != nil && req.CartToken != "" {
+		if err := s.carts.MergeGuestCart(ctx, req.CartToken, user.ID); err != nil {
+			fmt.Printf("Failed to merge guest cart: %v\n", err)
+		}
+	}
+
 	return &AuthResponse{
 		User:         *user,
 		AccessToken:  accessToken,
@@ -0,0 +1,75 @@
+package wishlists
+
+import (
+	"time"
+
+	"ecommerce-backend/common/constants"
+	"ecommerce-backend/core/products"
+)
+
+// Alert is one change worth telling users who wishlisted the product or variant. An empty
+// VariantID addresses product-level entries.
+type Alert struct {
+	Kind      string // constants.EVENT_WISHLIST_*
+	VariantID string
+	OldPrice  int
+	NewPrice  int
+}
+
+// watchState is what a wishlist entry watches: the current price and whether it can be bought
+type watchState struct {
+	price     int
+	available bool
+}
+
+// watchStates maps "" to the product as a whole and each active variant ID to that variant.
+// A product with variants costs as much as its cheapest active variant and is available when
+// any of them is.
+func watchStates(p *products.Product, now time.Time) map[string]watchState {
+	states := make(map[string]watchState, len(p.Variants)+1)
+	whole := watchState{}
+	hasVariants := false
+	for i := range p.Variants {
+		v := &p.Variants[i]
+		if !v.IsActive {
+			continue
+		}
+		state := watchState{price: v.PriceAt(now), available: v.InStock && (v.Available() > 0 || !p.TracksStock())}
+		states[v.ID] = state
+		if !hasVariants || state.price < whole.price {
+			whole.price = state.price
+		}
+		whole.available = whole.available || state.available
+		hasVariants = true
+	}
+	if !hasVariants {
+		whole = watchState{price: p.PriceAt(now), available: p.Available() > 0 || !p.TracksStock()}
+	}
+	states[""] = whole
+	return states
+}
+
+// DetectAlerts compares a product before and after an update. Nothing is reported while the
+// product is hidden from shoppers.
+func DetectAlerts(before, after *products.Product, now time.Time) []Alert {
+	if !after.IsVisible(now) {
+		return nil
+	}
+	old, current := watchStates(before, now), watchStates(after, now)
+	visibleBefore := before.IsVisible(now)
+
+	var alerts []Alert
+	for id, state := range current {
+		prev, ok := old[id]
+		if !ok {
+			continue
+		}
+		if state.price < prev.price {
+			alerts = append(alerts, Alert{Kind: constants.EVENT_WISHLIST_PRICE_DROP, VariantID: id, OldPrice: prev.price, NewPrice: state.price})
+		}
+		if state.available && (!prev.available || !visibleBefore) {
+			alerts = append(alerts, Alert{Kind: constants.EVENT_WISHLIST_BACK_IN_STOCK, VariantID: id, NewPrice: state.price})
+		}
+	}
+	return alerts
+}
@@ -0,0 +1,126 @@
+package wishlists
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"ecommerce-backend/common/middleware"
+	"ecommerce-backend/core/products"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type WishlistController struct {
+	service   WishlistService
+	authMW    gin.HandlerFunc
+	validator *validator.Validate
+}
+
+func NewWishlistController(s WishlistService, authMW gin.HandlerFunc) *WishlistController {
+	return &WishlistController{
+		service:   s,
+		authMW:    authMW,
+		validator: validator.New(),
+	}
+}
+
+func (c *WishlistController) RegisterRoutes(r *gin.Engine) {
+	r.GET("/wishlists/top", middleware.AdminKeyMiddleware(), c.MostWishlisted)
+
+	ug := r.Group("/user/wishlist")
+	if c.authMW != nil {
+		ug.Use(c.authMW)
+	}
+	ug.GET("", c.List)
+	ug.POST("", c.Add)
+	ug.DELETE(":id", c.Remove)
+}
+
+func userID(ctx *gin.Context) (string, bool) {
+	val, ok := ctx.Get("user_id")
+	if !ok {
+		return "", false
+	}
+	id, ok := val.(uuid.UUID)
+	return id.String(), ok
+}
+
+func (c *WishlistController) List(ctx *gin.Context) {
+	uid, ok := userID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	items, err := c.service.List(context.Background(), uid)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, items)
+}
+
+func (c *WishlistController) Add(ctx *gin.Context) {
+	uid, ok := userID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var req AddItemRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validator.Struct(req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	item, err := c.service.Add(context.Background(), uid, req)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, item)
+}
+
+func (c *WishlistController) Remove(ctx *gin.Context) {
+	uid, ok := userID(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if err := c.service.Remove(context.Background(), uid, ctx.Param("id")); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// MostWishlisted lists products by the number of users wishlisting them (admin)
+func (c *WishlistController) MostWishlisted(ctx *gin.Context) {
+	limit, _ := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	counts, err := c.service.MostWishlisted(context.Background(), limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, counts)
+}
+
+func (c *WishlistController) Name() string {
+	return "wishlists"
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrItemNotFound), errors.Is(err, ErrVariantNotFound), errors.Is(err, products.ErrProductNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
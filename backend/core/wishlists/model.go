@@ -0,0 +1,51 @@
+package wishlists
+
+import (
+	"errors"
+	"time"
+
+	"ecommerce-backend/core/products"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrItemNotFound    = errors.New("wishlist item not found")
+	ErrVariantNotFound = errors.New("variant not found")
+)
+
+// WishlistItem saves a product, or one of its variants when VariantID is set, for a user
+type WishlistItem struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	UserID    string    `gorm:"uniqueIndex:idx_wishlist_items_line;not null" json:"user_id"`
+	ProductID string    `gorm:"uniqueIndex:idx_wishlist_items_line;index;not null" json:"product_id"`
+	VariantID string    `gorm:"uniqueIndex:idx_wishlist_items_line;not null;default:''" json:"variant_id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (i *WishlistItem) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+	return
+}
+
+type AddItemRequest struct {
+	ProductID string `json:"product_id" validate:"required"`
+	VariantID string `json:"variant_id"`
+}
+
+// WishlistItemResponse carries the product as shoppers see it now; Product is nil once the
+// product has been deleted
+type WishlistItemResponse struct {
+	WishlistItem
+	Product *products.ProductResponse `json:"product"`
+}
+
+// WishlistCount is a product and how many users wishlisted it or one of its variants
+type WishlistCount struct {
+	ProductID string `json:"product_id"`
+	Name      string `json:"name"`
+	Users     int64  `json:"users"`
+	Items     int64  `json:"items"` // product and variant entries together
+}
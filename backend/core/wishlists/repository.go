@@ -0,0 +1,76 @@
+package wishlists
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type WishlistRepository interface {
+	// List returns the user's items, newest first
+	List(ctx context.Context, userID string) ([]WishlistItem, error)
+	// Add saves the item unless the user already has it, and returns the stored row either way
+	Add(ctx context.Context, item *WishlistItem) error
+	Delete(ctx context.Context, userID, id string) error
+	ListByProduct(ctx context.Context, productID string) ([]WishlistItem, error)
+	// MostWishlisted ranks products that are not deleted by the number of users wishlisting them
+	MostWishlisted(ctx context.Context, limit int) ([]WishlistCount, error)
+}
+
+type wishlistRepository struct {
+	db *gorm.DB
+}
+
+func NewWishlistRepository(db *gorm.DB) WishlistRepository {
+	return &wishlistRepository{db: db}
+}
+
+func (r *wishlistRepository) List(ctx context.Context, userID string) ([]WishlistItem, error) {
+	var items []WishlistItem
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC, id").Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *wishlistRepository) Add(ctx context.Context, item *WishlistItem) error {
+	return r.db.WithContext(ctx).
+		Where(WishlistItem{UserID: item.UserID, ProductID: item.ProductID, VariantID: item.VariantID}).
+		FirstOrCreate(item).Error
+}
+
+func (r *wishlistRepository) Delete(ctx context.Context, userID, id string) error {
+	res := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&WishlistItem{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrItemNotFound
+	}
+	return nil
+}
+
+func (r *wishlistRepository) ListByProduct(ctx context.Context, productID string) ([]WishlistItem, error) {
+	var items []WishlistItem
+	err := r.db.WithContext(ctx).Where("product_id = ?", productID).Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *wishlistRepository) MostWishlisted(ctx context.Context, limit int) ([]WishlistCount, error) {
+	var counts []WishlistCount
+	err := r.db.WithContext(ctx).Table("wishlist_items").
+		Select("wishlist_items.product_id, products.name, COUNT(DISTINCT wishlist_items.user_id) AS users, COUNT(*) AS items").
+		Joins("JOIN products ON products.id = wishlist_items.product_id AND products.deleted_at IS NULL").
+		Group("wishlist_items.product_id, products.name").
+		Order("users DESC, items DESC, wishlist_items.product_id").
+		Limit(limit).
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
@@ -0,0 +1,140 @@
+package wishlists
+
+import (
+	"context"
+	"time"
+
+	"ecommerce-backend/common/constants"
+	"ecommerce-backend/core/products"
+	"github.com/sirupsen/logrus"
+)
+
+// UserEventEmitter sends SSE events to one user's connections
+type UserEventEmitter interface {
+	EmitUserEvent(userID string, event interface{})
+}
+
+type WishlistService interface {
+	List(ctx context.Context, userID string) ([]WishlistItemResponse, error)
+	Add(ctx context.Context, userID string, req AddItemRequest) (*WishlistItem, error)
+	Remove(ctx context.Context, userID, id string) error
+	MostWishlisted(ctx context.Context, limit int) ([]WishlistCount, error)
+	// ProductUpdated implements products.UpdateListener and alerts users in the background
+	ProductUpdated(ctx context.Context, before, after *products.Product)
+}
+
+type wishlistService struct {
+	repo        WishlistRepository
+	productRepo products.ProductRepository
+	events      UserEventEmitter
+}
+
+func NewWishlistService(repo WishlistRepository, productRepo products.ProductRepository, events UserEventEmitter) WishlistService {
+	return &wishlistService{
+		repo:        repo,
+		productRepo: productRepo,
+		events:      events,
+	}
+}
+
+func (s *wishlistService) List(ctx context.Context, userID string) ([]WishlistItemResponse, error) {
+	items, err := s.repo.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ProductID
+	}
+	found, err := s.productRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]products.ProductResponse, len(found))
+	for i := range found {
+		byID[found[i].ID] = products.TransformProductToResponse(&found[i])
+	}
+
+	resp := make([]WishlistItemResponse, len(items))
+	for i, item := range items {
+		resp[i] = WishlistItemResponse{WishlistItem: item}
+		if p, ok := byID[item.ProductID]; ok {
+			resp[i].Product = &p
+		}
+	}
+	return resp, nil
+}
+
+func (s *wishlistService) Add(ctx context.Context, userID string, req AddItemRequest) (*WishlistItem, error) {
+	found, err := s.productRepo.GetByIDs(ctx, []string{req.ProductID})
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 || !found[0].IsVisible(time.Now()) {
+		return nil, products.ErrProductNotFound
+	}
+	if req.VariantID != "" {
+		ok := false
+		for _, v := range found[0].Variants {
+			ok = ok || (v.ID == req.VariantID && v.IsActive)
+		}
+		if !ok {
+			return nil, ErrVariantNotFound
+		}
+	}
+	item := &WishlistItem{UserID: userID, ProductID: req.ProductID, VariantID: req.VariantID}
+	if err := s.repo.Add(ctx, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *wishlistService) Remove(ctx context.Context, userID, id string) error {
+	return s.repo.Delete(ctx, userID, id)
+}
+
+func (s *wishlistService) MostWishlisted(ctx context.Context, limit int) ([]WishlistCount, error) {
+	return s.repo.MostWishlisted(ctx, limit)
+}
+
+func (s *wishlistService) ProductUpdated(ctx context.Context, before, after *products.Product) {
+	if s.events == nil {
+		return
+	}
+	alerts := DetectAlerts(before, after, time.Now())
+	if len(alerts) == 0 {
+		return
+	}
+	go s.notify(after, alerts)
+}
+
+// notify sends each alert to the users whose entry watches the changed product or variant
+func (s *wishlistService) notify(product *products.Product, alerts []Alert) {
+	items, err := s.repo.ListByProduct(context.Background(), product.ID)
+	if err != nil {
+		logrus.Errorf("Failed to load wishlists for product %s: %v", product.ID, err)
+		return
+	}
+	for _, alert := range alerts {
+		for _, item := range items {
+			if item.VariantID != alert.VariantID {
+				continue
+			}
+			data := map[string]interface{}{
+				"wishlist_item_id": item.ID,
+				"product_id":       product.ID,
+				"variant_id":       item.VariantID,
+				"name":             product.Name,
+				"price":            alert.NewPrice,
+			}
+			if alert.Kind == constants.EVENT_WISHLIST_PRICE_DROP {
+				data["old_price"] = alert.OldPrice
+			}
+			s.events.EmitUserEvent(item.UserID, map[string]interface{}{
+				"resource":      constants.CHAT_RESOURCE_WISHLIST,
+				"resource_type": alert.Kind,
+				"data":          data,
+			})
+		}
+	}
+}
@@ -23,6 +23,54 @@ type AudioStorageConfig struct {
 	MaxPayloadSizeMB int    `mapstructure:"max_payload_size_mb"`
 }
 
+// ImageStorageConfig configures managed product image uploads. Backend selects the storage
+// implementation; only "local" exists today.
+type ImageStorageConfig struct {
+	Backend         string `mapstructure:"backend"`
+	Path            string `mapstructure:"path"`
+	BaseURL         string `mapstructure:"base_url"`
+	MaxUploadSizeMB int    `mapstructure:"max_upload_size_mb"`
+	GCGraceHours    int    `mapstructure:"gc_grace_hours"`
+}
+
+// DownloadsConfig configures the files of digital products. They are kept apart from images and
+// only served through signed links that expire after LinkTTLMinutes. Each link of an order allows
+// MaxDownloads downloads within ExpiryDays of payment; 0 lifts either limit.
+type DownloadsConfig struct {
+	Path            string `mapstructure:"path"`
+	BaseURL         string `mapstructure:"base_url"`
+	SigningSecret   string `mapstructure:"signing_secret"`
+	LinkTTLMinutes  int    `mapstructure:"link_ttl_minutes"`
+	MaxDownloads    int    `mapstructure:"max_downloads"`
+	ExpiryDays      int    `mapstructure:"expiry_days"`
+	MaxUploadSizeMB int    `mapstructure:"max_upload_size_mb"`
+}
+
+// InventoryConfig holds the global low stock threshold, which products may override, and the
+// stock given on upgrade to products and variants that predate stock tracking
+type InventoryConfig struct {
+	LowStockThreshold int `mapstructure:"low_stock_threshold"`
+	InitialStock      int `mapstructure:"initial_stock"`
+}
+
+// OrdersConfig sets how long order creation responses are kept for replay to requests that
+// repeat an Idempotency-Key
+type OrdersConfig struct {
+	IdempotencyTTLHours int `mapstructure:"idempotency_ttl_hours"`
+}
+
+// TaxConfig says whether catalogue prices already contain tax. Rates themselves are kept in the
+// tax_rates table and managed through the admin API.
+type TaxConfig struct {
+	PricesIncludeTax bool `mapstructure:"prices_include_tax"`
+}
+
+// LocalizationConfig names the language product content is written in. Translations into other
+// locales are stored per product.
+type LocalizationConfig struct {
+	DefaultLocale string `mapstructure:"default_locale"`
+}
+
 type DatabaseConfig struct {
 	Host           string `mapstructure:"host"`
 	Port           int    `mapstructure:"port"`
@@ -41,6 +89,12 @@ type Config struct {
 	RateLimit           RateLimitConfig    `mapstructure:"ratelimit"`
 	AdminAPIKey         string             `mapstructure:"admin_api_key"`
 	AudioStorage        AudioStorageConfig `mapstructure:"audio_storage"`
+	ImageStorage        ImageStorageConfig `mapstructure:"image_storage"`
+	Downloads           DownloadsConfig    `mapstructure:"downloads"`
+	Inventory           InventoryConfig    `mapstructure:"inventory"`
+	Orders              OrdersConfig       `mapstructure:"orders"`
+	Tax                 TaxConfig          `mapstructure:"tax"`
+	Localization        LocalizationConfig `mapstructure:"localization"`
 	GrpcPort            string             `mapstructure:"grpc_port"`
 	RealtimeServiceAddr string             `mapstructure:"realtime_service_addr"`
 	JWTAccessSecret     string             `mapstructure:"jwt_access_secret"`
@@ -71,6 +125,23 @@ func loadConfig() *Config {
 	_ = v.BindEnv("audio_storage.path", "AUDIO_STORAGE_PATH")
 	_ = v.BindEnv("audio_storage.base_url", "AUDIO_STORAGE_BASE_URL")
 	_ = v.BindEnv("audio_storage.max_payload_size_mb", "AUDIO_STORAGE_MAX_PAYLOAD_SIZE_MB")
+	_ = v.BindEnv("image_storage.backend", "IMAGE_STORAGE_BACKEND")
+	_ = v.BindEnv("image_storage.path", "IMAGE_STORAGE_PATH")
+	_ = v.BindEnv("image_storage.base_url", "IMAGE_STORAGE_BASE_URL")
+	_ = v.BindEnv("image_storage.max_upload_size_mb", "IMAGE_STORAGE_MAX_UPLOAD_SIZE_MB")
+	_ = v.BindEnv("image_storage.gc_grace_hours", "IMAGE_STORAGE_GC_GRACE_HOURS")
+	_ = v.BindEnv("downloads.path", "DOWNLOADS_PATH")
+	_ = v.BindEnv("downloads.base_url", "DOWNLOADS_BASE_URL")
+	_ = v.BindEnv("downloads.signing_secret", "DOWNLOADS_SIGNING_SECRET")
+	_ = v.BindEnv("downloads.link_ttl_minutes", "DOWNLOADS_LINK_TTL_MINUTES")
+	_ = v.BindEnv("downloads.max_downloads", "DOWNLOADS_MAX_DOWNLOADS")
+	_ = v.BindEnv("downloads.expiry_days", "DOWNLOADS_EXPIRY_DAYS")
+	_ = v.BindEnv("downloads.max_upload_size_mb", "DOWNLOADS_MAX_UPLOAD_SIZE_MB")
+	_ = v.BindEnv("inventory.low_stock_threshold", "INVENTORY_LOW_STOCK_THRESHOLD")
+	_ = v.BindEnv("inventory.initial_stock", "INVENTORY_INITIAL_STOCK")
+	_ = v.BindEnv("orders.idempotency_ttl_hours", "ORDERS_IDEMPOTENCY_TTL_HOURS")
+	_ = v.BindEnv("tax.prices_include_tax", "TAX_PRICES_INCLUDE_TAX")
+	_ = v.BindEnv("localization.default_locale", "LOCALIZATION_DEFAULT_LOCALE")
 	_ = v.BindEnv("grpc_port")
 	_ = v.BindEnv("realtime_service_addr")
 	_ = v.BindEnv("jwt_access_secret", "JWT_ACCESS_SECRET")
@@ -91,6 +162,22 @@ func loadConfig() *Config {
 	v.SetDefault("audio_storage.path", "/app/data/audio_contacts")
 	v.SetDefault("audio_storage.base_url", "http://localhost:8080/api")
 	v.SetDefault("audio_storage.max_payload_size_mb", 10)
+	v.SetDefault("image_storage.backend", "local")
+	v.SetDefault("image_storage.path", "/app/data/images")
+	v.SetDefault("image_storage.base_url", "http://localhost:8080/api")
+	v.SetDefault("image_storage.max_upload_size_mb", 10)
+	v.SetDefault("image_storage.gc_grace_hours", 24)
+	v.SetDefault("downloads.path", "/app/data/downloads")
+	v.SetDefault("downloads.base_url", "http://localhost:8080/api")
+	v.SetDefault("downloads.signing_secret", "")
+	v.SetDefault("downloads.link_ttl_minutes", 15)
+	v.SetDefault("downloads.max_downloads", 5)
+	v.SetDefault("downloads.expiry_days", 30)
+	v.SetDefault("downloads.max_upload_size_mb", 100)
+	v.SetDefault("inventory.low_stock_threshold", 5)
+	v.SetDefault("orders.idempotency_ttl_hours", 24)
+	v.SetDefault("tax.prices_include_tax", false)
+	v.SetDefault("localization.default_locale", "en")
 	v.SetDefault("grpc_port", "10000")
 	v.SetDefault("realtime_service_addr", "localhost:9999")
 	v.SetDefault("jwt_access_secret", "")
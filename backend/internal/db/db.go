@@ -7,13 +7,21 @@ import (
 
 	"ecommerce-backend/core/analytics"
 	"ecommerce-backend/core/audiocontact"
+	"ecommerce-backend/core/carts"
+	"ecommerce-backend/core/categories"
 	chat "ecommerce-backend/core/chat"
 	"ecommerce-backend/core/comments"
 	"ecommerce-backend/core/contactus"
+	"ecommerce-backend/core/downloads"
+	"ecommerce-backend/core/media"
 	"ecommerce-backend/core/newsletter"
 	"ecommerce-backend/core/orders"
 	"ecommerce-backend/core/products"
+	"ecommerce-backend/core/promotions"
+	"ecommerce-backend/core/shipping"
+	"ecommerce-backend/core/tax"
 	"ecommerce-backend/core/users"
+	"ecommerce-backend/core/wishlists"
 	"ecommerce-backend/internal/config"
 	"github.com/sirupsen/logrus"
 	"gorm.io/driver/postgres"
@@ -24,10 +32,10 @@ const schemaMigrationLockID int64 = 0x4553434f4d
 
 var DB *gorm.DB
 
-func InitDB() {
+// DSN builds the connection string from the configuration
+func DSN() string {
 	cfg := config.Get()
-
-	dsn := fmt.Sprintf(
+	return fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
 		cfg.Database.Host,
 		cfg.Database.User,
@@ -37,8 +45,12 @@ func InitDB() {
 		cfg.Database.SSLMode,
 		cfg.Database.TimeZone,
 	)
+}
+
+func InitDB() {
+	cfg := config.Get()
 
-	pgDB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	pgDB, err := gorm.Open(postgres.Open(DSN()), &gorm.Config{})
 	if err != nil {
 		logrus.Fatalf("failed to connect database: %v", err)
 	}
@@ -71,9 +83,39 @@ func InitDB() {
 	if err := DB.AutoMigrate(&contactus.ContactUs{}, &contactus.FAQ{}); err != nil {
 		logrus.Fatalf("failed to migrate database: %v", err)
 	}
-	if err := DB.AutoMigrate(&products.Product{}, &products.ProductImage{}, &products.ProductVariant{}, &products.CartInvalidation{}); err != nil {
+	// The unique SKU index cannot be built while older rows repeat a SKU
+	if err := products.DedupeVariantSKUs(DB); err != nil {
+		logrus.Fatalf("failed to deduplicate variant skus: %v", err)
+	}
+	stockTracked := DB.Migrator().HasColumn(&products.ProductVariant{}, "stock_quantity")
+	if err := DB.AutoMigrate(&products.Product{}, &products.ProductImage{}, &products.ProductVariant{}, &products.CartInvalidation{}, &products.ProductRevision{}, &products.PriceHistory{}, &products.ProductRelation{}, &products.BundleComponent{}, &products.ProductSlug{}, &products.ProductTranslation{}, &products.StockAlert{}); err != nil {
 		logrus.Fatalf("failed to migrate products tables: %v", err)
 	}
+	// Catalogues from before stock tracking start at 0 on hand, which would sell nothing
+	if !stockTracked && cfg.Inventory.InitialStock > 0 {
+		if err := products.BackfillStock(DB, cfg.Inventory.InitialStock); err != nil {
+			logrus.Fatalf("failed to backfill product stock: %v", err)
+		}
+	}
+	if err := products.BackfillSlugs(DB); err != nil {
+		logrus.Fatalf("failed to backfill product slugs: %v", err)
+	}
+	if err := products.ReleaseDigitalReservations(DB); err != nil {
+		logrus.Fatalf("failed to release digital product reservations: %v", err)
+	}
+	if err := products.InstallChangeNotifications(DB); err != nil {
+		logrus.Fatalf("failed to install catalog change notifications: %v", err)
+	}
+	if err := DB.AutoMigrate(&media.Image{}); err != nil {
+		logrus.Fatalf("failed to migrate media tables: %v", err)
+	}
+	if err := DB.AutoMigrate(&categories.Category{}); err != nil {
+		logrus.Fatalf("failed to migrate categories tables: %v", err)
+	}
+	// Link products that still carry a free-form category string
+	if err := categories.NewCategoryRepository(DB).MigrateLegacy(context.Background()); err != nil {
+		logrus.Warnf("failed to migrate legacy product categories: %v", err)
+	}
 	if err := DB.AutoMigrate(&comments.Comment{}); err != nil {
 		logrus.Fatalf("failed to migrate comments tables: %v", err)
 	}
@@ -89,9 +131,27 @@ func InitDB() {
 	if err := DB.AutoMigrate(&audiocontact.AudioContact{}); err != nil {
 		logrus.Fatalf("failed to migrate audio contact tables: %v", err)
 	}
-	if err := DB.AutoMigrate(&orders.Order{}, &orders.OrderStatusEvent{}); err != nil {
+	if err := DB.AutoMigrate(&promotions.Promotion{}, &promotions.Redemption{}); err != nil {
+		logrus.Fatalf("failed to migrate promotions tables: %v", err)
+	}
+	if err := DB.AutoMigrate(&tax.Rate{}); err != nil {
+		logrus.Fatalf("failed to migrate tax tables: %v", err)
+	}
+	if err := DB.AutoMigrate(&shipping.Zone{}, &shipping.Method{}); err != nil {
+		logrus.Fatalf("failed to migrate shipping tables: %v", err)
+	}
+	if err := DB.AutoMigrate(&orders.Order{}, &orders.OrderStatusEvent{}, &orders.IdempotencyKey{}); err != nil {
 		logrus.Fatalf("failed to migrate orders tables: %v", err)
 	}
+	if err := DB.AutoMigrate(&downloads.ProductFile{}, &downloads.Download{}); err != nil {
+		logrus.Fatalf("failed to migrate downloads tables: %v", err)
+	}
+	if err := DB.AutoMigrate(&carts.Cart{}, &carts.CartItem{}); err != nil {
+		logrus.Fatalf("failed to migrate carts tables: %v", err)
+	}
+	if err := DB.AutoMigrate(&wishlists.WishlistItem{}); err != nil {
+		logrus.Fatalf("failed to migrate wishlists tables: %v", err)
+	}
 	if err := DB.AutoMigrate(&chat.Thread{}, &chat.Message{}); err != nil {
 		logrus.Fatalf("failed to migrate chat tables: %v", err)
 	}
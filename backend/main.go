@@ -7,13 +7,21 @@ import (
 	"ecommerce-backend/core/admin"
 	"ecommerce-backend/core/analytics"
 	"ecommerce-backend/core/audiocontact"
+	"ecommerce-backend/core/carts"
+	"ecommerce-backend/core/categories"
 	chat "ecommerce-backend/core/chat"
 	"ecommerce-backend/core/comments"
 	"ecommerce-backend/core/contactus"
+	"ecommerce-backend/core/downloads"
+	"ecommerce-backend/core/media"
 	"ecommerce-backend/core/newsletter"
 	"ecommerce-backend/core/orders"
 	"ecommerce-backend/core/products"
+	"ecommerce-backend/core/promotions"
+	"ecommerce-backend/core/shipping"
+	"ecommerce-backend/core/tax"
 	"ecommerce-backend/core/users"
+	"ecommerce-backend/core/wishlists"
 	"ecommerce-backend/internal/config"
 	"ecommerce-backend/internal/db"
 	notificationsGrpc "ecommerce-backend/internal/grpc/notifications"
@@ -38,8 +46,8 @@ func main() {
 	corsCfg := cors.Config{
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Admin-API-Key", "ngrok-skip-browser-warning"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Admin-API-Key", "X-Cart-Token", "Idempotency-Key", "ngrok-skip-browser-warning"},
+		ExposeHeaders:    []string{"Content-Length", "X-Total-Count", "X-Cart-Token", "Idempotent-Replayed"},
 		AllowCredentials: false,
 	}
 	r.Use(cors.New(corsCfg))
@@ -63,18 +71,27 @@ func main() {
 	svc := contactus.NewContactUsService(repo)
 	ctrl := contactus.NewContactUsController(svc)
 
+	categoryRepo := categories.NewCategoryRepository(db.DB)
+	categorySvc := categories.NewCategoryService(categoryRepo)
+	categoryCtrl := categories.NewCategoryController(categorySvc)
+
 	productRepo := products.NewProductRepository(db.DB)
 	cartInvalidationRepo := products.NewCartInvalidationRepository(db.DB)
-	productSvc := products.NewProductService(productRepo, cartInvalidationRepo)
-	productCtrl := products.NewProductController(productSvc)
+
+	// Carts are created before users so sign in can merge guest carts
+	cartRepo := carts.NewCartRepository(db.DB)
+	cartSvc := carts.NewCartService(cartRepo, productRepo)
+	guestCartCleaner := carts.NewGuestCartCleaner(cartSvc, time.Hour)
+	defer guestCartCleaner.Stop()
 
 	// Initialize Users module (before orders to inject auth)
 	userRepo := users.NewUserRepository(db.DB)
-	userSvc := users.NewUserService(userRepo)
+	userSvc := users.NewUserServiceWithCarts(userRepo, cartSvc)
 	userCtrl := users.NewUserController(userSvc)
 
 	// Create unified auth middleware
 	authMW := middleware.AuthMiddleware(userSvc)
+	cartCtrl := carts.NewCartController(cartSvc, authMW)
 
 	cfg := config.Get()
 
@@ -110,14 +127,82 @@ func main() {
 	// Initialize Chat module - stateless, uses gRPC for notifications
 	sseEmitter := chat.NewGRPCEventEmitter(notificationClient)
 
+	// Product updates feed wishlist price-drop and back-in-stock alerts
+	wishlistRepo := wishlists.NewWishlistRepository(db.DB)
+	wishlistSvc := wishlists.NewWishlistService(wishlistRepo, productRepo, sseEmitter)
+	wishlistCtrl := wishlists.NewWishlistController(wishlistSvc, authMW)
+
+	// Orders and product updates that take stock below its threshold raise admin alerts
+	stockMonitor := products.NewStockMonitor(productRepo, sseEmitter, cfg.Inventory.LowStockThreshold)
+
+	productSvc := products.NewProductServiceWithListeners(productRepo, cartInvalidationRepo, categoryRepo, wishlistSvc, stockMonitor)
+	// Public catalogue reads are cached per instance; every instance clears its cache on
+	// catalog_changed notifications raised by any write to the catalogue tables
+	catalogCache := products.NewResponseCache(time.Minute, 1000)
+	catalogCacheListener := products.NewCacheListener(db.DSN(), catalogCache)
+	defer catalogCacheListener.Stop()
+	productCtrl := products.NewProductControllerWithCache(productSvc, catalogCache)
+
 	threadRepo := chat.NewThreadRepository(db.DB)
 	messageRepo := chat.NewMessageRepository(db.DB)
 	threadSvc := chat.NewThreadService(threadRepo, sseEmitter)
 	messageSvc := chat.NewMessageService(messageRepo, threadRepo, orderRepo, sseEmitter)
 	threadCreatorAdapter := chat.NewThreadCreatorAdapter(threadSvc)
 
-	orderSvc := orders.NewOrderServiceWithChat(orderRepo, orderStatusRepo, productRepo, eventAdapter, sseEmitter, threadCreatorAdapter)
-	orderCtrl := orders.NewController(orderSvc, authMW, productRepo, userRepo)
+	// Apply scheduled publish_at / unpublish_at transitions
+	publishScheduler := products.NewPublishScheduler(productRepo, cartInvalidationRepo, sseEmitter, time.Minute)
+	defer publishScheduler.Stop()
+
+	// Precompute "frequently bought together" products from order history
+	relatedJob := products.NewRelatedJob(productRepo, 6*time.Hour)
+	defer relatedJob.Stop()
+
+	// Digital products: files live apart from images and are only served through signed links
+	downloadStorage, err := media.NewStorage("local", cfg.Downloads.Path)
+	if err != nil {
+		logrus.Fatalf("Failed to initialize download storage: %v", err)
+	}
+	downloadSecret := cfg.Downloads.SigningSecret
+	if downloadSecret == "" {
+		downloadSecret = cfg.JWTAccessSecret
+	}
+	if downloadSecret == "" {
+		logrus.Fatal("downloads.signing_secret or jwt_access_secret is required to sign download links")
+	}
+	downloadConfig := &downloads.DownloadConfig{
+		BaseURL:      cfg.Downloads.BaseURL,
+		Secret:       []byte(downloadSecret),
+		LinkTTL:      time.Duration(cfg.Downloads.LinkTTLMinutes) * time.Minute,
+		MaxDownloads: cfg.Downloads.MaxDownloads,
+		Expiry:       time.Duration(cfg.Downloads.ExpiryDays) * 24 * time.Hour,
+	}
+	downloadSvc := downloads.NewDownloadService(downloads.NewDownloadRepository(db.DB), orderRepo, productRepo, downloadStorage, downloadConfig)
+	downloadCtrl := downloads.NewDownloadController(downloadSvc, authMW, downloads.MaxUploadBytes(cfg.Downloads.MaxUploadSizeMB))
+
+	promotionSvc := promotions.NewPromotionService(promotions.NewPromotionRepository(db.DB))
+	promotionCtrl := promotions.NewPromotionController(promotionSvc)
+
+	taxSvc := tax.NewTaxService(tax.NewRateRepository(db.DB), cfg.Tax.PricesIncludeTax)
+	taxCtrl := tax.NewTaxController(taxSvc)
+
+	shippingSvc := shipping.NewShippingService(shipping.NewShippingRepository(db.DB), productRepo)
+	shippingCtrl := shipping.NewShippingController(shippingSvc)
+
+	orderSvc := orders.NewOrderService(orderRepo, orderStatusRepo, productRepo, orders.OrderServiceOptions{
+		Events:        eventAdapter,
+		SSE:           sseEmitter,
+		Threads:       threadCreatorAdapter,
+		Downloads:     downloadSvc,
+		Promotions:    promotionSvc,
+		Taxes:         taxSvc,
+		Shipping:      shippingSvc,
+		StockWatchers: []orders.StockWatcher{stockMonitor},
+	})
+	// Order creations repeating an Idempotency-Key get the first response back instead of a second order
+	idempotencyRepo := orders.NewIdempotencyRepository(db.DB)
+	idempotencyCleaner := orders.NewIdempotencyKeyCleaner(idempotencyRepo, time.Hour)
+	defer idempotencyCleaner.Stop()
+	orderCtrl := orders.NewControllerWithIdempotency(orderSvc, authMW, productRepo, userRepo, idempotencyRepo, time.Duration(cfg.Orders.IdempotencyTTLHours)*time.Hour)
 
 	// Chat controller - only handles business logic, no SSE routes
 	chatCtrl := chat.NewChatController(threadSvc, messageSvc, orderRepo, userRepo, authMW)
@@ -151,6 +236,21 @@ func main() {
 	audioContactSvc := audiocontact.NewAudioContactService(audioContactRepo, audioConfig)
 	audioContactCtrl := audiocontact.NewAudioContactController(audioContactSvc)
 
+	// Initialize media module
+	imageStorage, err := media.NewStorage(cfg.ImageStorage.Backend, cfg.ImageStorage.Path)
+	if err != nil {
+		logrus.Fatalf("Failed to initialize image storage: %v", err)
+	}
+	imageRepo := media.NewImageRepository(db.DB)
+	imageConfig := &media.ImageConfig{
+		BaseURL: cfg.ImageStorage.BaseURL,
+		GCGrace: time.Duration(cfg.ImageStorage.GCGraceHours) * time.Hour,
+	}
+	imageSvc := media.NewImageService(imageRepo, imageStorage, imageConfig)
+	imageCtrl := media.NewImageController(imageSvc, media.MaxUploadBytes(cfg.ImageStorage.MaxUploadSizeMB))
+	imageCollector := media.NewImageCollector(imageSvc, time.Hour)
+	defer imageCollector.Stop()
+
 	// Health check
 	r.GET("/healthz", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
@@ -171,12 +271,21 @@ func main() {
 
 	ctrl.RegisterRoutes(r)
 	productCtrl.RegisterRoutes(r)
+	categoryCtrl.RegisterRoutes(r)
 	orderCtrl.RegisterRoutes(r)
+	promotionCtrl.RegisterRoutes(r)
+	taxCtrl.RegisterRoutes(r)
+	shippingCtrl.RegisterRoutes(r)
+	downloadCtrl.RegisterRoutes(r)
+	cartCtrl.RegisterRoutes(r)
+	wishlistCtrl.RegisterRoutes(r)
 	commentCtrl.RegisterRoutes(r)
 	analyticsCtrl.RegisterRoutes(r)
 	userCtrl.RegisterRoutes(r)
 	newsletterCtrl.RegisterRoutes(r)
 
+	imageCtrl.RegisterRoutes(r)
+
 	// Register audio contact routes
 	audioContactCtrl.RegisterRoutes(r)
 
@@ -26,20 +26,58 @@ export interface CreateUserOrderReq {
   items: CreateOrderItemReq[];
   shipping: ShippingAddressReq;
   total: number;
+  codes?: string[];
+  shipping_method_id?: string;
 }
 
-export async function createUserOrder(payload: CreateUserOrderReq) {
+export interface OrderPreview {
+  subtotal: number;
+  discount: number;
+  tax: number;
+  tax_inclusive: boolean; // prices already contain tax
+  total: number;
+  free_shipping: boolean;
+  line_discounts: number[];
+  line_taxes: number[];
+  promotions: Array<{ code: string; kind: string; description?: string; amount: number; free_shipping?: boolean }>;
+  tax_lines: Array<{ rate_id: number; name: string; tax_class: string; basis_points: number; taxable: number; amount: number }>;
+  shipping: number; // 0 when a coupon code made it free
+  shipping_method?: { method_id: string; name: string; cost: number };
+}
+
+// Retries sending the same idempotencyKey and payload get the first order back instead of a new one
+export async function createUserOrder(payload: CreateUserOrderReq, idempotencyKey?: string) {
   const token = TokenManager.getAccessToken();
   const res = await fetch(`${API_BASE}/user/orders`, {
     method: "POST",
     headers: {
       "Content-Type": "application/json",
       ...(token ? { Authorization: `Bearer ${token}` } : {}),
+      ...(idempotencyKey ? { "Idempotency-Key": idempotencyKey } : {}),
     },
     body: JSON.stringify(payload),
   });
   if (!res.ok) throw new Error(`createUserOrder failed: ${res.status}`);
-  return res.json() as Promise<{ id: string; backend_total: number }>; 
+  return res.json() as Promise<{ id: string; subtotal: number; discount_total: number; tax_total: number; tax_inclusive: boolean; shipping_cost: number; backend_total: number }>;
+}
+
+// previewUserOrder prices the cart with coupon codes applied, tax for the shipping address and the
+// cost of shippingMethodId when given; refused codes throw with the reason
+export async function previewUserOrder(items: CreateOrderItemReq[], codes: string[], shipping?: ShippingAddressReq, shippingMethodId?: string): Promise<OrderPreview> {
+  const token = TokenManager.getAccessToken();
+  const res = await fetch(`${API_BASE}/user/orders/preview`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      ...(token ? { Authorization: `Bearer ${token}` } : {}),
+    },
+    body: JSON.stringify({ items, codes, shipping, shipping_method_id: shippingMethodId }),
+  });
+  if (!res.ok) {
+    const body = await res.json().catch(() => null);
+    throw new Error(body?.error || `previewUserOrder failed: ${res.status}`);
+  }
+  return res.json();
 }
 
 export async function getMyOrder(id: string) {
@@ -106,6 +144,14 @@ export async function listOrderStatus(orderId: string, adminKey?: string) {
   return res.json();
 }
 
+export async function listNextOrderStatuses(orderId: string, adminKey?: string): Promise<{ current_status: string; next_statuses: string[] }> {
+  const res = await fetch(`${API_BASE}/orders/${orderId}/next-statuses`, {
+    headers: adminKey ? { "X-Admin-API-Key": adminKey } : undefined,
+  });
+  if (!res.ok) throw new Error(`listNextOrderStatuses failed: ${res.status}`);
+  return res.json();
+}
+
 export async function cancelMyOrder(orderId: string) {
   const token = TokenManager.getAccessToken();
   const res = await fetch(`${API_BASE}/user/orders/${orderId}/cancel`, {
@@ -20,7 +20,11 @@ export const fetchProductsPaginated = async (skip = 0, take = 3): Promise<Produc
   return response.data;
 };
 
-export const fetchCartHash = async (): Promise<string> => {
-  const response = await axios.get<{ hash: string }>(`${API_BASE_URL}/products/cart/hash`);
+// The hash only changes when one of the given products does
+export const fetchCartHash = async (productIds: string[]): Promise<string> => {
+  const response = await axios.get<{ hash: string }>(`${API_BASE_URL}/products/cart/hash`, {
+    params: { product_id: productIds },
+    paramsSerializer: { indexes: null },
+  });
   return response.data.hash;
 }; 
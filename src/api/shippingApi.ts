@@ -0,0 +1,44 @@
+import { getApiBaseUrl } from '../config/api';
+import type { CreateOrderItemReq } from './ordersApi';
+
+const API_BASE = getApiBaseUrl();
+
+export interface ShippingOption {
+  method_id: string;
+  name: string;
+  description?: string;
+  kind: 'flat' | 'weight' | 'price';
+  cost: number;
+}
+
+export interface ShippingQuote {
+  requires_shipping: boolean; // false when the cart is digital only
+  zone_id?: string;
+  zone?: string;
+  weight_grams: number;
+  subtotal: number;
+  options: ShippingOption[];
+}
+
+export interface ShippingQuoteAddress {
+  country: string;
+  state?: string;
+  postal_code?: string;
+}
+
+// quoteShipping lists the methods the cart can ship to the address by; an address outside every zone throws
+export async function quoteShipping(items: CreateOrderItemReq[], address: ShippingQuoteAddress): Promise<ShippingQuote> {
+  const res = await fetch(`${API_BASE}/shipping/quote`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({
+      items: items.map(it => ({ product_id: it.product_id, variant_id: it.variant_id, quantity: it.quantity })),
+      address,
+    }),
+  });
+  if (!res.ok) {
+    const body = await res.json().catch(() => null);
+    throw new Error(body?.error || `quoteShipping failed: ${res.status}`);
+  }
+  return res.json();
+}
@@ -1,6 +1,6 @@
-import { useEffect } from 'react';
+import { useEffect, useRef } from 'react';
 import { useDispatch, useSelector } from 'react-redux';
-import { validateCartHash } from '../store/slices/cartSlice';
+import { setCartHash, validateCartHash } from '../store/slices/cartSlice';
 import { fetchCartHash } from '../api/productsApi';
 import { toast } from '@/hooks/use-toast';
 import { RootState } from '../store/store';
@@ -8,39 +8,49 @@ import { RootState } from '../store/store';
 /**
  * CartHashValidator component
  * This component validates the cart hash on mount and keeps it synchronized
- * with the backend to ensure cart data is always fresh
+ * with the backend to ensure cart data is always fresh. The hash covers only
+ * the products in the cart, so edits to other products leave the cart alone.
  */
 export function CartHashValidator() {
   const dispatch = useDispatch();
   const cartItems = useSelector((state: RootState) => state.cart.items);
   const storedHash = useSelector((state: RootState) => state.cart.hash);
+  const productIds = Array.from(new Set(cartItems.map((item) => item.productId))).sort();
+  const productKey = productIds.join(',');
 
-  useEffect(() => {
-    const validateHash = async () => {
-      try {
-        const currentHash = await fetchCartHash();
-        
-        // Check if cart will be cleared before dispatching
-        const hadItems = cartItems.length > 0;
-        const willClear = storedHash && storedHash !== currentHash && hadItems;
-        
-        dispatch(validateCartHash(currentHash));
-        
-        // Show notification if cart was cleared
-        if (willClear) {
-          toast({
-            title: "Cart Updated",
-            description: "Your cart has been cleared because product information was updated. Please add items again.",
-            variant: "default",
-          });
-        }
-      } catch (error) {
-        console.error('Failed to validate cart hash:', error);
+  const latest = useRef({ productIds, storedHash });
+  latest.current = { productIds, storedHash };
+  const checkedKey = useRef<string | null>(null);
+
+  // Clears the cart when one of its products changed since the hash was stored
+  const validateHash = async () => {
+    const { productIds, storedHash } = latest.current;
+    if (productIds.length === 0) {
+      return;
+    }
+    try {
+      const currentHash = await fetchCartHash(productIds);
+      const willClear = storedHash && storedHash !== currentHash;
+
+      dispatch(validateCartHash(currentHash));
+
+      // Show notification if cart was cleared
+      if (willClear) {
+        toast({
+          title: "Cart Updated",
+          description: "Your cart has been cleared because product information was updated. Please add items again.",
+          variant: "default",
+        });
       }
-    };
+    } catch (error) {
+      console.error('Failed to validate cart hash:', error);
+    }
+  };
 
+  useEffect(() => {
     // Validate immediately on mount
     validateHash();
+    checkedKey.current = latest.current.productIds.join(',');
 
     // Optionally validate periodically (e.g., every 5 minutes)
     const interval = setInterval(validateHash, 5 * 60 * 1000);
@@ -48,5 +58,19 @@ export function CartHashValidator() {
     return () => clearInterval(interval);
   }, [dispatch]); // Only run once on mount
 
+  // Products just added to or removed from the cart are current: store the hash of the new set
+  useEffect(() => {
+    if (checkedKey.current === null || checkedKey.current === productKey) {
+      return;
+    }
+    checkedKey.current = productKey;
+    if (productIds.length === 0) {
+      return;
+    }
+    fetchCartHash(productIds)
+      .then((hash) => dispatch(setCartHash(hash)))
+      .catch((error) => console.error('Failed to refresh cart hash:', error));
+  }, [productKey, dispatch]);
+
   return null;
-} 
\ No newline at end of file
+}
@@ -7,7 +7,8 @@ import { CheckoutForm } from '../types/checkout';
 import { AnimationController } from '../utils/animations';
 import { ArrowLeft, Check, CheckCircle } from 'lucide-react';
 import { useAuth } from '../contexts/AuthContext';
-import { cartToOrderItems, createUserOrder } from '../api/ordersApi';
+import { cartToOrderItems, createUserOrder, OrderPreview, previewUserOrder } from '../api/ordersApi';
+import { quoteShipping, ShippingQuote } from '../api/shippingApi';
 
 const Checkout = () => {
   const navigate = useNavigate();
@@ -18,6 +19,15 @@ const Checkout = () => {
   const successRef = useRef<HTMLDivElement>(null);
   const [isSubmitting, setIsSubmitting] = useState(false);
   const [showSuccess, setShowSuccess] = useState(false);
+  // One key per checkout attempt, so a double submit or retry cannot place the order twice
+  const idempotencyKeyRef = useRef<string | null>(null);
+  const [couponCode, setCouponCode] = useState('');
+  const [couponError, setCouponError] = useState<string | null>(null);
+  const [codes, setCodes] = useState<string[]>([]);
+  const [preview, setPreview] = useState<OrderPreview | null>(null);
+  const [shippingQuote, setShippingQuote] = useState<ShippingQuote | null>(null);
+  const [shippingMethodId, setShippingMethodId] = useState('');
+  const [shippingError, setShippingError] = useState<string | null>(null);
 
   const [formData, setFormData] = useState<CheckoutForm>({
     fullName: '',
@@ -62,6 +72,64 @@ const Checkout = () => {
     }
   }, [isAuthenticated, user]);
 
+  // Tax depends on where the order ships to, so the address goes with the preview too
+  const shippingAddress = () => ({
+    full_name: formData.fullName,
+    line1: formData.address,
+    city: user?.city,
+    state: user?.state,
+    country: user?.country,
+    phone: formData.phone,
+    postal_code: formData.zipCode,
+  });
+
+  // Shipping methods and their costs depend on the cart and the address
+  useEffect(() => {
+    if (items.length === 0 || !user?.country) {
+      setShippingQuote(null);
+      setShippingError(user?.country ? null : 'Add your country to your profile to see shipping options');
+      return;
+    }
+    let cancelled = false;
+    const timer = setTimeout(() => {
+      quoteShipping(cartToOrderItems(items), { country: user.country!, state: user.state, postal_code: formData.zipCode })
+        .then(q => {
+          if (cancelled) return;
+          setShippingQuote(q);
+          setShippingError(q.requires_shipping && q.options.length === 0 ? 'No shipping method can take this order' : null);
+          setShippingMethodId(prev => q.options.some(o => o.method_id === prev) ? prev : (q.options[0]?.method_id ?? ''));
+        })
+        .catch((err: any) => {
+          if (cancelled) return;
+          setShippingQuote(null);
+          setShippingMethodId('');
+          setShippingError(err?.message || 'Could not load shipping options');
+        });
+    }, 300);
+    return () => {
+      cancelled = true;
+      clearTimeout(timer);
+    };
+  }, [items, formData.zipCode, user?.country, user?.state]);
+
+  useEffect(() => {
+    if (!isAuthenticated || items.length === 0) {
+      setPreview(null);
+      return;
+    }
+    let cancelled = false;
+    const timer = setTimeout(() => {
+      previewUserOrder(cartToOrderItems(items), codes, shippingAddress(), shippingMethodId || undefined)
+        .then(p => { if (!cancelled) setPreview(p); })
+        .catch(() => { if (!cancelled) setPreview(null); });
+    }, 300);
+    return () => {
+      cancelled = true;
+      clearTimeout(timer);
+    };
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [isAuthenticated, items, codes, shippingMethodId, formData.zipCode, user?.country, user?.state]);
+
   const validateForm = (): boolean => {
     const newErrors: Partial<CheckoutForm> = {};
 
@@ -94,16 +162,16 @@ const Checkout = () => {
       navigate('/login');
       return;
     }
+    if (shippingQuote?.requires_shipping !== false && !shippingMethodId) {
+      setShippingError(shippingError || 'Choose a shipping method');
+      return;
+    }
     setIsSubmitting(true);
     try {
       const itemsReq = cartToOrderItems(items);
-      const shipping = {
-        full_name: formData.fullName,
-        line1: formData.address,
-        phone: formData.phone,
-        postal_code: formData.zipCode,
-      };
-      await createUserOrder({ items: itemsReq, shipping, total: Math.round(total) });
+      const shipping = shippingAddress();
+      if (!idempotencyKeyRef.current) idempotencyKeyRef.current = crypto.randomUUID();
+      await createUserOrder({ items: itemsReq, shipping, total: Math.round(preview ? preview.total : total), codes, shipping_method_id: shippingMethodId || undefined }, idempotencyKeyRef.current);
       setShowSuccess(true);
       if (successRef.current) {
         AnimationController.staggerFadeIn([successRef.current], 0.1);
@@ -117,15 +185,39 @@ const Checkout = () => {
     }
   };
 
+  const applyCoupon = async () => {
+    const code = couponCode.trim();
+    if (!code) return;
+    setCouponError(null);
+    try {
+      const next = [...codes, code];
+      setPreview(await previewUserOrder(cartToOrderItems(items), next, shippingAddress(), shippingMethodId || undefined));
+      setCodes(next);
+      setCouponCode('');
+      idempotencyKeyRef.current = null;
+    } catch (err: any) {
+      setCouponError(err?.message || 'Could not apply the code');
+    }
+  };
+
+  const removeCoupons = () => {
+    setCodes([]);
+    setCouponError(null);
+    idempotencyKeyRef.current = null;
+  };
+
   const handleInputChange = (field: keyof CheckoutForm, value: string) => {
     setFormData(prev => ({ ...prev, [field]: value }));
+    // A changed form is a new attempt
+    idempotencyKeyRef.current = null;
     if (errors[field]) {
       setErrors(prev => ({ ...prev, [field]: undefined }));
     }
   };
 
-  const shipping = 0;
-  const finalTotal = total + shipping;
+  const selectedShipping = shippingQuote?.options.find(o => o.method_id === shippingMethodId);
+  // The preview already includes shipping; without one, add the chosen method's cost
+  const finalTotal = preview ? preview.total : total + (selectedShipping?.cost ?? 0);
 
   if (showSuccess) {
     return (
@@ -325,14 +417,80 @@ const Checkout = () => {
                 ))}
               </div>
 
+              <div className="mb-6">
+                <div className="flex gap-2">
+                  <input
+                    value={couponCode}
+                    onChange={(e) => setCouponCode(e.target.value)}
+                    placeholder={isAuthenticated ? 'Coupon code' : 'Sign in to use coupon codes'}
+                    disabled={!isAuthenticated}
+                    className="flex-1 border border-neutral-300 px-4 py-2 rounded-lg uppercase"
+                  />
+                  <button type="button" onClick={applyCoupon} disabled={!isAuthenticated || !couponCode.trim()} className="px-4 py-2 border border-neutral-900 rounded-lg">
+                    Apply
+                  </button>
+                </div>
+                {couponError && <p className="text-sm text-red-600 mt-2">{couponError}</p>}
+                {codes.length > 0 && preview && preview.promotions.length > 0 && (
+                  <div className="flex items-center justify-between text-sm text-green-700 mt-2">
+                    <span>{preview.promotions.map(p => p.code).join(', ')} applied</span>
+                    <button type="button" onClick={removeCoupons} className="text-neutral-600 underline">Remove</button>
+                  </div>
+                )}
+              </div>
+
+              {shippingQuote?.requires_shipping && shippingQuote.options.length > 0 && (
+                <div className="mb-6 space-y-2">
+                  <p className="text-sm font-medium text-neutral-900">Shipping method</p>
+                  {shippingQuote.options.map(option => (
+                    <label key={option.method_id} className="flex items-center justify-between text-sm border border-neutral-200 rounded-lg px-4 py-2 cursor-pointer">
+                      <span className="flex items-center gap-2">
+                        <input
+                          type="radio"
+                          name="shippingMethod"
+                          checked={shippingMethodId === option.method_id}
+                          onChange={() => {
+                            setShippingMethodId(option.method_id);
+                            idempotencyKeyRef.current = null;
+                          }}
+                        />
+                        <span>{option.name}{option.description ? ` · ${option.description}` : ''}</span>
+                      </span>
+                      <span className="font-medium">{option.cost > 0 ? `₹${option.cost.toFixed(2)}` : 'Free'}</span>
+                    </label>
+                  ))}
+                </div>
+              )}
+              {shippingError && <p className="text-sm text-red-600 mb-4">{shippingError}</p>}
+
               <div className="space-y-3 border-t-2 border-neutral-200 pt-5">
                 <div className="flex justify-between text-base">
                   <span className="text-neutral-600">Subtotal</span>
-                  <span className="text-neutral-900 font-medium">₹{total.toFixed(2)}</span>
+                  <span className="text-neutral-900 font-medium">₹{(preview ? preview.subtotal : total).toFixed(2)}</span>
                 </div>
+                {preview && preview.discount > 0 && (
+                  <div className="flex justify-between text-base">
+                    <span className="text-neutral-600">Discount</span>
+                    <span className="text-green-600 font-medium">-₹{preview.discount.toFixed(2)}</span>
+                  </div>
+                )}
+                {preview && preview.tax > 0 && (
+                  <div className="flex justify-between text-base">
+                    <span className="text-neutral-600">{preview.tax_inclusive ? 'Tax (included)' : 'Tax'}</span>
+                    <span className="text-neutral-900 font-medium">₹{preview.tax.toFixed(2)}</span>
+                  </div>
+                )}
                 <div className="flex justify-between text-base">
                   <span className="text-neutral-600">Shipping</span>
-                  <span className="text-green-600 font-medium">Free</span>
+                  {shippingQuote && !shippingQuote.requires_shipping ? (
+                    <span className="text-neutral-600">Not needed</span>
+                  ) : !selectedShipping ? (
+                    <span className="text-neutral-600">—</span>
+                  ) : (preview ? preview.shipping : selectedShipping.cost) > 0 ? (
+                    <span className="text-neutral-900 font-medium">₹{(preview ? preview.shipping : selectedShipping.cost).toFixed(2)}</span>
+                  ) : (
+                    <span className="text-green-600 font-medium">Free</span>
+                  )}
                 </div>
                 <div className="flex justify-between text-2xl font-bold pt-3 border-t-2 border-neutral-900">
                   <span className="text-neutral-900">Total</span>
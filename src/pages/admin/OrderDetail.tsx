@@ -1,5 +1,5 @@
 import { useEffect, useMemo, useState } from 'react';
-import { appendOrderStatus, getOrder, listOrderStatus } from '../../api/ordersApi';
+import { appendOrderStatus, getOrder, listNextOrderStatuses, listOrderStatus } from '../../api/ordersApi';
 import { fetchProductById } from '../../api/productsApi';
 import { useParams, Link } from 'react-router-dom';
 import OrderChatWidget from '../../components/OrderChatWidget';
@@ -42,6 +42,7 @@ export default function OrderDetail() {
   const [error, setError] = useState<string | null>(null);
   const [status, setStatus] = useState('');
   const [reason, setReason] = useState('');
+  const [nextStatuses, setNextStatuses] = useState<string[]>([]);
   const [productsMap, setProductsMap] = useState<Record<string, any>>({});
 
   useEffect(() => {
@@ -54,9 +55,11 @@ export default function OrderDetail() {
         const adminKey = sessionStorage.getItem(ADMIN_KEY_STORAGE) || undefined;
         const o = await getOrder(id, adminKey || undefined);
         const s = await listOrderStatus(id, adminKey || undefined);
+        const next = await listNextOrderStatuses(id, adminKey || undefined);
         if (!mounted) return;
         setOrder(o as Order);
         setEvents(s as StatusEvent[]);
+        setNextStatuses(next.next_statuses);
         const items = (o as any).items as Order['items'] | undefined;
         if (items && items.length > 0) {
           const uniqueIds = Array.from(new Set(items.map(i => i.product_id)));
@@ -87,9 +90,17 @@ export default function OrderDetail() {
     e.preventDefault();
     if (!id || !status) return;
     const adminKey = sessionStorage.getItem(ADMIN_KEY_STORAGE) || undefined;
-    await appendOrderStatus(id, status, reason || undefined, adminKey || undefined);
+    setError(null);
+    try {
+      await appendOrderStatus(id, status, reason || undefined, adminKey || undefined);
+    } catch (e: any) {
+      setError(e?.message || 'Failed to update status');
+    }
     const s = await listOrderStatus(id, adminKey || undefined);
+    const next = await listNextOrderStatuses(id, adminKey || undefined);
     setEvents(s as StatusEvent[]);
+    setNextStatuses(next.next_statuses);
+    setOrder(o => o ? { ...o, current_status: next.current_status } : o);
     setStatus('');
     setReason('');
   };
@@ -174,25 +185,12 @@ export default function OrderDetail() {
             <form onSubmit={handleUpdate} className="flex flex-col sm:flex-row gap-3">
               <select value={status} onChange={(e)=> setStatus(e.target.value)} className="border px-3 py-2 rounded w-full sm:w-auto">
                 <option value="">Select status</option>
-                <option value="pending">pending</option>
-                <option value="seller_notified">seller_notified</option>
-                <option value="seller_processing">seller_processing</option>
-                <option value="seller_waiting_dispatch">seller_waiting_dispatch</option>
-                <option value="seller_dispatched">seller_dispatched</option>
-                <option value="agent_picked">agent_picked</option>
-                <option value="agent_transporting">agent_transporting</option>
-                <option value="agent_out_for_delivery">agent_out_for_delivery</option>
-                <option value="order_delivered">order_delivered</option>
-                <option value="user_cancelled">user_cancelled</option>
-                <option value="user_returned">user_returned</option>
-                <option value="user_returning">user_returning</option>
-                <option value="user_return_received">user_return_received</option>
-                <option value="user_refund_initiated">user_refund_initiated</option>
-                <option value="user_refund_failed">user_refund_failed</option>
-                <option value="user_refund_processed">user_refund_processed</option>
+                {nextStatuses.map(st => (
+                  <option key={st} value={st}>{st}</option>
+                ))}
               </select>
               <input value={reason} onChange={(e)=> setReason(e.target.value)} placeholder="Reason (optional)" className="border px-3 py-2 rounded flex-1" />
-              <button className="px-4 py-2 border rounded">Update</button>
+              <button className="px-4 py-2 border rounded" disabled={nextStatuses.length === 0}>Update</button>
             </form>
           </div>
 
@@ -60,6 +60,7 @@ export default function OrdersAdmin() {
           >
             <option value="">All Status</option>
             <option value="pending">pending</option>
+            <option value="paid">paid</option>
             <option value="seller_notified">seller_notified</option>
             <option value="seller_processing">seller_processing</option>
             <option value="seller_waiting_dispatch">seller_waiting_dispatch</option>